@@ -0,0 +1,9 @@
+// Package api embeds the service contracts kept in this directory.
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 document of the REST API.
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth/oidctest"
+)
+
+// Command dev-idp serves a stand-in OpenID Connect provider that signs in
+// everyone as the given user, for trying -oidc-issuer locally. It is kept out
+// of the shortener binary; never expose it.
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "dev-idp:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("dev-idp", flag.ContinueOnError)
+	addr := flags.String("addr", "localhost:9096", "address to listen on")
+	clientID := flags.String("client-id", "shortener", "the only client known to the provider")
+	secret := flags.String("client-secret", "", "secret of the client, empty for a public one")
+	subject := flags.String("subject", "dev-user", "subject of the signed in user")
+	email := flags.String("email", "dev-user@example.com", "email of the signed in user")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(*addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errors.New("-addr must be a loopback address")
+	}
+
+	provider, err := oidctest.New("http://"+*addr, *clientID, *secret)
+	if err != nil {
+		return err
+	}
+	provider.SignInAs(*subject, *email)
+
+	fmt.Printf("issuer http://%s, client %s\n", *addr, *clientID)
+	return http.ListenAndServe(*addr, provider)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+)
+
+// rotateKeys adds a signing key to the keys file. Running replicas pick it up
+// on their next reload and start signing with it after the activation delay,
+// so the delay must exceed -jwt-keys-reload. Older keys keep verifying the
+// tokens they signed until they are dropped beyond -keep.
+func rotateKeys(args []string) error {
+	flags := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	file := flags.String("file", cmp.Or(os.Getenv("JWT_KEYS_FILE"), auth.DefaultKeysFile), "JSON file with the JWT signing keys, created when missing")
+	delay := flags.Duration("activate-after", 2*time.Minute, "how long the new key only verifies before it starts signing")
+	keep := flags.Int("keep", 3, "keys kept in the file, at least 2")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+
+	set, err := auth.LoadKeySet(*file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	key, err := set.Rotate(time.Now(), *delay, *keep)
+	if err != nil {
+		return err
+	}
+	if err = set.Save(*file); err != nil {
+		return err
+	}
+
+	fmt.Printf("added key %s, signing from %s\n", key.ID, key.NotBefore.Format(time.RFC3339))
+	return nil
+}
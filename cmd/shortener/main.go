@@ -1,7 +1,20 @@
 package main
 
-import "github.com/MV7VM/url-shortener/internal/app"
+import (
+	"fmt"
+	"os"
+
+	"github.com/MV7VM/url-shortener/internal/app"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		if err := rotateKeys(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "rotate-keys:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	app.New().Run()
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/delivery/grpc"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/delivery/http"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/repository"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
@@ -17,8 +19,10 @@ func New() *fx.App {
 	return fx.New(
 		fx.Options(
 			repository.New(), //
+			auth.New(),
 			usecase.New(),
 			http.New(),
+			grpc.New(),
 		),
 		fx.Provide(
 			config.NewConfig,
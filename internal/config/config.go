@@ -3,8 +3,8 @@ package config
 import (
 	"flag"
 	"os"
-
-	"github.com/gofrs/uuid"
+	"strings"
+	"time"
 )
 
 func NewConfig() (*Model, error) {
@@ -12,26 +12,147 @@ func NewConfig() (*Model, error) {
 
 	flag.StringVar(&cfg.HTTP.Host, "a", "localhost:8080", "address and port to run server")
 	flag.StringVar(&cfg.HTTP.ReturningURL, "b", "http://localhost:8080/", "prefix of returning shart url")
+	flag.DurationVar(&cfg.HTTP.ReadTimeout, "http-read-timeout", 15*time.Second, "maximum duration for reading an entire request")
+	flag.DurationVar(&cfg.HTTP.ReadHeaderTimeout, "http-read-header-timeout", 5*time.Second, "maximum duration for reading request headers")
+	flag.DurationVar(&cfg.HTTP.WriteTimeout, "http-write-timeout", 30*time.Second, "maximum duration before timing out writes of a response")
+	flag.DurationVar(&cfg.HTTP.IdleTimeout, "http-idle-timeout", 2*time.Minute, "how long keep-alive connections stay open between requests")
+	flag.DurationVar(&cfg.HTTP.ShutdownDelay, "http-shutdown-delay", 5*time.Second, "how long the server reports not ready before it stops accepting connections")
+	flag.StringVar(&cfg.HTTP.NotFoundPage, "not-found-page", "", "HTML page served to browsers for unknown short urls")
+
+	flag.Func("trusted-proxies", "comma-separated proxy addresses or CIDRs trusted to set X-Forwarded-For", func(v string) error {
+		cfg.HTTP.TrustedProxies = splitList(v)
+		return nil
+	})
+
+	flag.StringVar(&cfg.HTTP.TLS.CertFile, "tls-cert", "", "PEM certificate file, enables HTTPS")
+	flag.StringVar(&cfg.HTTP.TLS.KeyFile, "tls-key", "", "PEM private key file")
+	flag.StringVar(&cfg.HTTP.TLS.MinVersion, "tls-min-version", "1.2", "minimum TLS version: 1.2 or 1.3")
+	flag.StringVar(&cfg.HTTP.TLS.CipherPolicy, "tls-ciphers", "default", "TLS 1.2 cipher policy: default or modern")
+	flag.DurationVar(&cfg.HTTP.TLS.ReloadInterval, "tls-reload-interval", 30*time.Second, "how often certificate files are checked for changes")
+	flag.StringVar(&cfg.HTTP.TLS.RedirectHost, "tls-redirect-addr", "", "address of a plain HTTP listener redirecting to HTTPS")
+	flag.BoolVar(&cfg.HTTP.TLS.HTTP3, "http3", false, "also serve HTTP/3 over QUIC on the same port, requires TLS")
+
+	flag.StringVar(&cfg.Auth.Secret, "jwt-secret", "", "static JWT signing secret; without it and a keys file, keys are generated into ./jwt-keys.json")
+	flag.StringVar(&cfg.Auth.KeysFile, "jwt-keys-file", "", "JSON file with rotated JWT signing keys, see the rotate-keys command")
+	flag.DurationVar(&cfg.Auth.KeysReload, "jwt-keys-reload", 30*time.Second, "how often the JWT keys file is checked for rotations")
+	flag.StringVar(&cfg.Auth.Issuer, "jwt-issuer", "url-shortener", "issuer claim of auth tokens, tokens of other issuers are rejected")
+	flag.DurationVar(&cfg.Auth.TokenTTL, "jwt-ttl", 30*24*time.Hour, "lifetime of an auth token")
+	flag.DurationVar(&cfg.Auth.RefreshBefore, "jwt-refresh-before", 7*24*time.Hour, "a presented token expiring sooner than this is re-issued")
+	flag.StringVar(&cfg.Auth.Cookie.Domain, "cookie-domain", "", "domain attribute of the auth cookie")
+	flag.StringVar(&cfg.Auth.Cookie.Secure, "cookie-secure", "auto", "secure attribute of the auth cookie: auto (with TLS), true or false")
+	flag.StringVar(&cfg.Auth.Cookie.SameSite, "cookie-samesite", "lax", "SameSite attribute of the auth cookie: lax, strict or none")
+	flag.BoolVar(&cfg.Auth.Cookie.HTTPOnly, "cookie-httponly", true, "hide the auth cookie from scripts")
+
+	flag.StringVar(&cfg.Auth.OIDC.Issuer, "oidc-issuer", "", "OpenID Connect issuer URL, enables single sign-on")
+	flag.StringVar(&cfg.Auth.OIDC.ClientID, "oidc-client-id", "", "client id registered with the OpenID Connect provider")
+	flag.StringVar(&cfg.Auth.OIDC.ClientSecret, "oidc-client-secret", "", "client secret, empty for a public client")
+	flag.StringVar(&cfg.Auth.OIDC.RedirectURL, "oidc-redirect-url", "", "callback URL registered with the provider, derived from -b when empty")
+	flag.StringVar(&cfg.Auth.OIDC.AfterLogin, "oidc-after-login", "", "where browsers are sent after signing in, -b when empty")
+	cfg.Auth.OIDC.Scopes = []string{"openid", "email"}
+	flag.Func("oidc-scopes", "comma-separated scopes requested from the provider (default openid,email)", func(v string) error {
+		cfg.Auth.OIDC.Scopes = splitList(v)
+		return nil
+	})
+
+	flag.Func("admins", "comma-separated user ids with the admin role", func(v string) error {
+		cfg.Auth.Admins = splitList(v)
+		return nil
+	})
+
+	flag.StringVar(&cfg.GRPC.Host, "grpc-addr", "", "address and port to run gRPC server, disabled when empty")
 
 	flag.StringVar(&cfg.Repo.SavingFilePath, "f", "./data.json", "file for recovery storage")
+	flag.StringVar(&cfg.Repo.AuditFilePath, "audit-file", "./audit.jsonl", "append-only audit log of the in-memory storage")
 	flag.StringVar(&cfg.Repo.PsqlConnString, "d", "", "file for recovery storage")
 
+	flag.IntVar(&cfg.Clicks.SubscriberBuffer, "clicks-buffer", 64, "buffered click events per live stream subscriber")
+	flag.DurationVar(&cfg.Clicks.Heartbeat, "clicks-heartbeat", 15*time.Second, "keep-alive interval of the live click stream")
+	flag.IntVar(&cfg.Clicks.QueueSize, "clicks-queue", 1024, "clicks waiting to be notified to live streams and webhooks")
+	flag.DurationVar(&cfg.Clicks.FlushInterval, "clicks-flush", 5*time.Second, "how often counted clicks are written to storage")
+
+	flag.DurationVar(&cfg.Webhooks.PollInterval, "webhook-poll", time.Second, "how often the webhook queue is polled")
+	flag.DurationVar(&cfg.Webhooks.Timeout, "webhook-timeout", 10*time.Second, "timeout of a single webhook delivery")
+	flag.IntVar(&cfg.Webhooks.MaxAttempts, "webhook-max-attempts", 8, "delivery attempts before a webhook event is dead-lettered")
+	flag.DurationVar(&cfg.Webhooks.BaseBackoff, "webhook-backoff", 5*time.Second, "initial webhook retry delay, doubled on every attempt")
+	flag.DurationVar(&cfg.Webhooks.MaxBackoff, "webhook-max-backoff", time.Hour, "upper bound of the webhook retry delay")
+	flag.IntVar(&cfg.Webhooks.BatchSize, "webhook-batch", 32, "webhook deliveries claimed per poll")
+
+	flag.IntVar(&cfg.Deletion.Workers, "delete-workers", 4, "workers applying queued url deletions")
+	flag.IntVar(&cfg.Deletion.QueueSize, "delete-queue", 1024, "deletion jobs waiting for a worker before requests are rejected")
+	flag.DurationVar(&cfg.Deletion.BatchWindow, "delete-window", 100*time.Millisecond, "how long deletions are accumulated before they are flushed")
+	flag.IntVar(&cfg.Deletion.BatchSize, "delete-batch", 1000, "urls flushed in one deletion statement")
+	flag.DurationVar(&cfg.Deletion.JobTTL, "delete-job-ttl", time.Hour, "how long finished deletion jobs stay queryable")
+
+	flag.StringVar(&cfg.RateLimit.Store, "ratelimit-store", "memory", "rate limit bucket store: memory or postgres")
+	flag.Float64Var(&cfg.RateLimit.Create.Rate, "ratelimit-create-rate", 5, "short urls a client may create per second")
+	flag.IntVar(&cfg.RateLimit.Create.Burst, "ratelimit-create-burst", 50, "short urls a client may create at once, 0 disables the limit")
+	flag.Float64Var(&cfg.RateLimit.Batch.Rate, "ratelimit-batch-rate", 0.5, "batches a client may submit per second")
+	flag.IntVar(&cfg.RateLimit.Batch.Burst, "ratelimit-batch-burst", 10, "batches a client may submit at once, 0 disables the limit")
+	flag.Float64Var(&cfg.RateLimit.Redirect.Rate, "ratelimit-redirect-rate", 50, "redirects a client may follow per second")
+	flag.IntVar(&cfg.RateLimit.Redirect.Burst, "ratelimit-redirect-burst", 200, "redirects a client may follow at once, 0 disables the limit")
+	flag.Float64Var(&cfg.RateLimit.Login.Rate, "ratelimit-login-rate", 0.1, "sign-ups and logins a client may attempt per second")
+	flag.IntVar(&cfg.RateLimit.Login.Burst, "ratelimit-login-burst", 10, "sign-ups and logins a client may attempt at once, 0 disables the limit")
+
+	flag.Int64Var(&cfg.Limits.MaxBodyBytes, "max-body-bytes", 1<<20, "maximum size of a request body as sent, 0 disables the limit")
+	flag.Int64Var(&cfg.Limits.MaxDecompressedBytes, "max-decompressed-bytes", 8<<20, "maximum size of a gzip request body once decompressed, 0 disables the limit")
+	flag.IntVar(&cfg.Limits.MaxBatchSize, "max-batch-size", 1000, "maximum urls in one batch, 0 disables the limit")
+	flag.IntVar(&cfg.Limits.MaxURLLength, "max-url-length", 8192, "maximum length of a shortened url in bytes, 0 disables the limit")
+
+	flag.StringVar(&cfg.Policy.BlocklistFile, "blocklist", "", "file of domains links must not point to, one per line")
+	flag.StringVar(&cfg.Policy.AllowlistFile, "allowlist", "", "file of domains links may point to, one per line")
+	flag.BoolVar(&cfg.Policy.AllowlistOnly, "allowlist-only", false, "refuse links to domains that are not on the allowlist")
+	flag.BoolVar(&cfg.Policy.AllowPrivate, "allow-private", false, "allow links to localhost, private and local addresses")
+	flag.BoolVar(&cfg.Policy.StripTracking, "strip-tracking", false, "remove utm_* and click id parameters from links")
+	flag.DurationVar(&cfg.Policy.Reload, "policy-reload", 30*time.Second, "how often the blocklist and allowlist files are checked for changes")
+
 	flag.Parse()
 
 	if filePath := os.Getenv("FILE_STORAGE_PATH"); filePath != "" {
 		cfg.Repo.SavingFilePath = filePath
 	}
 
+	if auditPath := os.Getenv("AUDIT_FILE_PATH"); auditPath != "" {
+		cfg.Repo.AuditFilePath = auditPath
+	}
+
 	if dbConn := os.Getenv("DATABASE_DSN"); dbConn != "" {
 		cfg.Repo.SavingFilePath = dbConn
 	}
 
-	secretKey, err := uuid.NewV7()
-	if err != nil {
-		return nil, err
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		cfg.Auth.Secret = secret
+	}
+
+	if keysFile := os.Getenv("JWT_KEYS_FILE"); keysFile != "" {
+		cfg.Auth.KeysFile = keysFile
+	}
+
+	if secret := os.Getenv("OIDC_CLIENT_SECRET"); secret != "" {
+		cfg.Auth.OIDC.ClientSecret = secret
+	}
+
+	if blocklist := os.Getenv("BLOCKLIST_FILE"); blocklist != "" {
+		cfg.Policy.BlocklistFile = blocklist
 	}
 
-	cfg.HTTP.SecretToken = secretKey.String()
+	if allowlist := os.Getenv("ALLOWLIST_FILE"); allowlist != "" {
+		cfg.Policy.AllowlistFile = allowlist
+	}
+
+	if admins := os.Getenv("ADMIN_USER_IDS"); admins != "" {
+		cfg.Auth.Admins = splitList(admins)
+	}
 
 	return &cfg, nil
 }
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -1,14 +1,93 @@
 package config
 
+import "time"
+
 type Model struct {
-	HTTP HTTPConfig `yaml:"HTTP"`
-	Repo RepoConfig `yaml:"Repo"`
+	HTTP      HTTPConfig      `yaml:"HTTP"`
+	Auth      AuthConfig      `yaml:"Auth"`
+	GRPC      GRPCConfig      `yaml:"GRPC"`
+	Repo      RepoConfig      `yaml:"Repo"`
+	Clicks    ClicksConfig    `yaml:"Clicks"`
+	Webhooks  WebhooksConfig  `yaml:"Webhooks"`
+	Deletion  DeletionConfig  `yaml:"Deletion"`
+	RateLimit RateLimitConfig `yaml:"RateLimit"`
+	Limits    LimitsConfig    `yaml:"Limits"`
+	Policy    PolicyConfig    `yaml:"Policy"`
+}
+
+type GRPCConfig struct {
+	// Host is the gRPC listen address; the gRPC API is disabled when empty.
+	Host string
 }
 
 type HTTPConfig struct {
-	Host         string
-	ReturningURL string
-	SecretToken  string
+	Host              string
+	ReturningURL      string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownDelay     time.Duration
+	// NotFoundPage is an optional HTML file served to browsers for unknown
+	// short URLs instead of a problem document.
+	NotFoundPage string
+	// TrustedProxies are the addresses whose X-Forwarded-For is believed when
+	// the client IP is determined; none by default.
+	TrustedProxies []string
+	TLS            TLSConfig
+}
+
+// AuthConfig holds the JWT signing keys: rotated keys from KeysFile or a
+// single static Secret. Without either a keys file is generated in the
+// working directory.
+type AuthConfig struct {
+	Secret     string
+	KeysFile   string
+	KeysReload time.Duration
+	Issuer     string
+	TokenTTL   time.Duration
+	// RefreshBefore is how close to expiry a presented token is re-issued.
+	RefreshBefore time.Duration
+	Cookie        CookieConfig
+	OIDC          OIDCConfig
+	// Admins are the user ids with the admin role, who moderate links of all
+	// users.
+	Admins []string
+}
+
+// OIDCConfig enables single sign-on with an OpenID Connect provider; it is
+// disabled when Issuer is empty. A client without ClientSecret is public and
+// relies on PKCE alone.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the provider, by default
+	// /api/auth/oidc/callback under the returning URL.
+	RedirectURL string
+	Scopes      []string
+	// AfterLogin is where browsers are sent once signed in.
+	AfterLogin string
+}
+
+type CookieConfig struct {
+	Domain string
+	// Secure is "auto" (only when TLS is enabled), "true" or "false".
+	Secure   string
+	SameSite string
+	HTTPOnly bool
+}
+
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	MinVersion     string
+	CipherPolicy   string
+	ReloadInterval time.Duration
+	// RedirectHost is an optional plain-HTTP address redirecting to HTTPS.
+	RedirectHost string
+	// HTTP3 additionally serves the routes over QUIC on the UDP port of Host.
+	HTTP3 bool
 }
 
 type RepoConfig struct {
@@ -18,8 +97,82 @@ type RepoConfig struct {
 
 type CacheConfig struct {
 	SavingFilePath string
+	// AuditFilePath is the append-only audit log of the in-memory backend,
+	// one JSON entry per line; empty keeps the log in memory only.
+	AuditFilePath string
 }
 
 type PsqlConfig struct {
 	PsqlConnString string
 }
+
+type ClicksConfig struct {
+	SubscriberBuffer int
+	Heartbeat        time.Duration
+	// QueueSize bounds the clicks waiting to be notified to their owners.
+	QueueSize int
+	// FlushInterval is how often counted clicks are written.
+	FlushInterval time.Duration
+}
+
+type WebhooksConfig struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	BatchSize    int
+}
+
+type DeletionConfig struct {
+	Workers     int
+	QueueSize   int
+	BatchWindow time.Duration
+	BatchSize   int
+	JobTTL      time.Duration
+}
+
+type RateLimitConfig struct {
+	// Store is "memory" for a single replica or "postgres" to share buckets
+	// between replicas.
+	Store    string
+	Create   LimitConfig
+	Batch    LimitConfig
+	Redirect LimitConfig
+	// Login guards sign-up and login against password guessing.
+	Login LimitConfig
+}
+
+// LimitConfig is a token bucket: Rate tokens per second up to Burst. A zero
+// Burst disables the limit.
+type LimitConfig struct {
+	Rate  float64
+	Burst int
+}
+
+// LimitsConfig bounds the size of requests; a zero value disables a limit.
+type LimitsConfig struct {
+	// MaxBodyBytes bounds bodies as sent, MaxDecompressedBytes once gzip is
+	// undone.
+	MaxBodyBytes         int64
+	MaxDecompressedBytes int64
+	MaxBatchSize         int
+	MaxURLLength         int
+}
+
+// PolicyConfig restricts the destinations links may point to. The block and
+// allow lists are files of domains, one per line; a domain matches its
+// subdomains too.
+type PolicyConfig struct {
+	BlocklistFile string
+	AllowlistFile string
+	// AllowlistOnly refuses every destination that is not on the allowlist.
+	AllowlistOnly bool
+	// AllowPrivate permits loopback, private and local destinations, which
+	// are refused by default.
+	AllowPrivate bool
+	// StripTracking removes utm_* and click id parameters from destinations
+	// before they are stored.
+	StripTracking bool
+	Reload        time.Duration
+}
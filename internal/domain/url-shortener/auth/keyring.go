@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+const defaultKeysReload = 30 * time.Second
+
+// Keyring signs tokens with the current key and verifies them with any known
+// one. Keys come from the keys file, which is polled for rotations, or from a
+// static secret. Without either, a keys file is generated at DefaultKeysFile,
+// so sessions survive restarts.
+type Keyring struct {
+	log      *zap.Logger
+	path     string
+	interval time.Duration
+	now      func() time.Time
+	parser   *jwt.Parser
+
+	issuer        string
+	ttl           time.Duration
+	refreshBefore time.Duration
+
+	mu   sync.RWMutex
+	set  KeySet
+	mod  time.Time
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewKeyring(l *zap.Logger, cfg *config.Model) (*Keyring, error) {
+	k := newKeyring(l.Named("keys"))
+	if cfg.Auth.Issuer != "" {
+		k.issuer = cfg.Auth.Issuer
+	}
+	if cfg.Auth.TokenTTL > 0 {
+		k.ttl = cfg.Auth.TokenTTL
+	}
+	if cfg.Auth.RefreshBefore > 0 {
+		k.refreshBefore = cfg.Auth.RefreshBefore
+	}
+
+	keysFile := cfg.Auth.KeysFile
+	if keysFile == "" && cfg.Auth.Secret == "" {
+		created, err := CreateKeySet(DefaultKeysFile, k.now())
+		if err != nil {
+			return nil, fmt.Errorf("create signing keys: %w", err)
+		}
+		if created {
+			k.log.Warn("no signing key configured, generated one; share the file with every replica",
+				zap.String("path", DefaultKeysFile))
+		}
+		keysFile = DefaultKeysFile
+	}
+
+	if keysFile != "" {
+		k.path = keysFile
+		k.interval = cfg.Auth.KeysReload
+		if k.interval <= 0 {
+			k.interval = defaultKeysReload
+		}
+		if _, err := k.reload(); err != nil {
+			return nil, fmt.Errorf("load signing keys: %w", err)
+		}
+		return k, nil
+	}
+
+	k.set = staticKeySet([]byte(cfg.Auth.Secret))
+
+	return k, nil
+}
+
+// NewStaticKeyring holds a single key with DefaultKeyID and issues tokens
+// with the default claims.
+func NewStaticKeyring(secret []byte) *Keyring {
+	k := newKeyring(zap.NewNop())
+	k.set = staticKeySet(secret)
+
+	return k
+}
+
+func newKeyring(l *zap.Logger) *Keyring {
+	return &Keyring{
+		log: l,
+		now: time.Now,
+		// Registered claims are checked by Parse against now.
+		parser:        jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithoutClaimsValidation()),
+		issuer:        DefaultIssuer,
+		ttl:           DefaultTokenTTL,
+		refreshBefore: DefaultTokenTTL / 4,
+	}
+}
+
+func staticKeySet(secret []byte) KeySet {
+	return KeySet{Keys: []Key{{ID: DefaultKeyID, Secret: secret}}}
+}
+
+// Sign issues a token signed by the current key and names it in the kid
+// header.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key, ok := k.set.signing(k.now())
+	k.mu.RUnlock()
+	if !ok {
+		return "", errNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Secret)
+}
+
+// Keyfunc resolves the verification key of a token for jwt.Parse.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, jwt.ErrSignatureInvalid
+	}
+
+	id := DefaultKeyID
+	if kid, ok := token.Header["kid"]; ok {
+		if id, ok = kid.(string); !ok {
+			return nil, fmt.Errorf("malformed kid %v", kid)
+		}
+	}
+
+	k.mu.RLock()
+	key, ok := k.set.lookup(id)
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", id)
+	}
+
+	return key.Secret, nil
+}
+
+// OnStart polls the keys file for rotations.
+func (k *Keyring) OnStart(_ context.Context) error {
+	if k.path == "" {
+		return nil
+	}
+
+	k.stop, k.done = make(chan struct{}), make(chan struct{})
+	go k.watch()
+
+	return nil
+}
+
+func (k *Keyring) OnStop(_ context.Context) error {
+	if k.stop == nil {
+		return nil
+	}
+
+	close(k.stop)
+	<-k.done
+
+	return nil
+}
+
+// reload loads the keys file if it changed since the last load. A broken
+// file is refused and the loaded keys stay in use.
+func (k *Keyring) reload() (bool, error) {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return false, err
+	}
+
+	k.mu.RLock()
+	unchanged := len(k.set.Keys) > 0 && info.ModTime().Equal(k.mod)
+	k.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	set, err := LoadKeySet(k.path)
+	if err != nil {
+		return false, err
+	}
+
+	k.mu.Lock()
+	k.set, k.mod = set, info.ModTime()
+	k.mu.Unlock()
+
+	return true, nil
+}
+
+func (k *Keyring) watch() {
+	defer close(k.done)
+
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+			reloaded, err := k.reload()
+			if err != nil {
+				k.log.Error("failed to reload signing keys", zap.Error(err))
+				continue
+			}
+			if reloaded {
+				k.log.Info("signing keys reloaded", zap.String("file", k.path))
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func parse(t *testing.T, k *Keyring, raw string) (*jwt.Token, error) {
+	t.Helper()
+	return jwt.Parse(raw, k.Keyfunc)
+}
+
+func TestKeyring_Static(t *testing.T) {
+	k := NewStaticKeyring([]byte("secret"))
+
+	raw, err := k.Sign(jwt.MapClaims{"userID": "u1"})
+	require.NoError(t, err)
+
+	token, err := parse(t, k, raw)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultKeyID, token.Header["kid"])
+	assert.Equal(t, "u1", token.Claims.(jwt.MapClaims)["userID"])
+
+	// Tokens issued before keys had ids are checked with the default key.
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userID": "u2"}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = parse(t, k, legacy)
+	assert.NoError(t, err)
+
+	_, err = parse(t, NewStaticKeyring([]byte("other")), raw)
+	assert.Error(t, err)
+}
+
+func TestKeyring_RejectsOtherAlgorithms(t *testing.T) {
+	k := NewStaticKeyring([]byte("secret"))
+
+	raw, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"userID": "u1"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	_, err = parse(t, k, raw)
+	assert.Error(t, err)
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	now := time.Now()
+
+	var set KeySet
+	first, err := set.Rotate(now, time.Minute, 3)
+	require.NoError(t, err)
+	assert.False(t, first.NotBefore.After(now), "the first key signs at once")
+	require.NoError(t, set.Save(path))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	k, err := NewKeyring(zap.NewNop(), &config.Model{Auth: config.AuthConfig{KeysFile: path}})
+	require.NoError(t, err)
+	k.now = func() time.Time { return now }
+
+	old, err := k.Sign(jwt.MapClaims{"userID": "u1"})
+	require.NoError(t, err)
+
+	second, err := set.Rotate(now, time.Minute, 3)
+	require.NoError(t, err)
+	require.NoError(t, set.Save(path))
+	// Some file systems keep the mtime resolution coarse.
+	require.NoError(t, os.Chtimes(path, now.Add(time.Second), now.Add(time.Second)))
+
+	reloaded, err := k.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	// The new key is not used before it activates but already verifies.
+	raw, err := k.Sign(jwt.MapClaims{"userID": "u1"})
+	require.NoError(t, err)
+	token, err := parse(t, k, raw)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, token.Header["kid"])
+
+	k.now = func() time.Time { return now.Add(2 * time.Minute) }
+	raw, err = k.Sign(jwt.MapClaims{"userID": "u1"})
+	require.NoError(t, err)
+	token, err = parse(t, k, raw)
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, token.Header["kid"])
+
+	// Tokens of the previous key keep validating.
+	_, err = parse(t, k, old)
+	assert.NoError(t, err)
+}
+
+func TestKeySet_RotateKeepsSigningKey(t *testing.T) {
+	now := time.Now()
+
+	var set KeySet
+	first, err := set.Rotate(now, time.Minute, 2)
+	require.NoError(t, err)
+
+	// Rotating again before the previous key activates must not drop the
+	// only key that may sign.
+	for i := 0; i < 3; i++ {
+		_, err = set.Rotate(now, time.Minute, 2)
+		require.NoError(t, err)
+	}
+
+	signing, ok := set.signing(now)
+	require.True(t, ok)
+	assert.Equal(t, first.ID, signing.ID)
+
+	// Once newer keys sign, the old ones are pruned down to keep.
+	_, err = set.Rotate(now.Add(time.Hour), time.Minute, 2)
+	require.NoError(t, err)
+	assert.Len(t, set.Keys, 2)
+}
+
+func TestKeyring_BrokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[]}`), 0o600))
+
+	_, err := NewKeyring(zap.NewNop(), &config.Model{Auth: config.AuthConfig{KeysFile: path}})
+	assert.Error(t, err)
+}
+
+func TestKeyring_GeneratesKeysFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// Without a configured key, replicas and restarts share a generated one.
+	first, err := NewKeyring(zap.NewNop(), &config.Model{})
+	require.NoError(t, err)
+	raw, _, err := first.Issue("u1")
+	require.NoError(t, err)
+
+	second, err := NewKeyring(zap.NewNop(), &config.Model{})
+	require.NoError(t, err)
+	claims, err := second.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", claims.UserID)
+
+	info, err := os.Stat(DefaultKeysFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// Tokens of keys that are gone are told apart from malformed ones.
+	_, err = NewStaticKeyring([]byte("other secret")).Parse(raw)
+	assert.ErrorIs(t, err, ErrTokenUnverifiable)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	_, err = second.Parse("not-a-token")
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	assert.NotErrorIs(t, err, ErrTokenUnverifiable)
+}
+
+func TestKeyring_IssueAndParse(t *testing.T) {
+	now := time.Now()
+	k := NewStaticKeyring([]byte("secret"))
+	k.now = func() time.Time { return now }
+
+	raw, issued, err := k.Issue("u1")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultIssuer, issued.Issuer)
+	assert.Equal(t, now.Add(DefaultTokenTTL).Unix(), issued.ExpiresAt.Unix())
+
+	claims, err := k.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", claims.UserID)
+	assert.False(t, k.NeedsRefresh(claims))
+	token, _, err := k.Refresh(claims)
+	require.NoError(t, err)
+	assert.Empty(t, token)
+
+	k.now = func() time.Time { return now.Add(DefaultTokenTTL - time.Hour) }
+	claims, err = k.Parse(raw)
+	require.NoError(t, err)
+	assert.True(t, k.NeedsRefresh(claims))
+	token, refreshed, err := k.Refresh(claims)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, "u1", refreshed.UserID)
+
+	_, anonymous, err := k.IssueAnonymous()
+	require.NoError(t, err)
+	assert.NotEmpty(t, anonymous.UserID)
+	assert.NotEqual(t, "u1", anonymous.UserID)
+
+	k.now = func() time.Time { return now.Add(DefaultTokenTTL + time.Hour) }
+	_, err = k.Parse(raw)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestKeyring_ParseStrict(t *testing.T) {
+	k := NewStaticKeyring([]byte("secret"))
+	now := time.Now()
+
+	sign := func(claims jwt.Claims) string {
+		raw, err := k.Sign(claims)
+		require.NoError(t, err)
+		return raw
+	}
+	registered := func(issuer string, iat, exp time.Time) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "u1",
+			IssuedAt:  jwt.NewNumericDate(iat),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		}
+	}
+
+	tests := map[string]string{
+		"legacy without claims": sign(jwt.MapClaims{"userID": "u1"}),
+		"other issuer":          sign(Claims{UserID: "u1", RegisteredClaims: registered("someone-else", now, now.Add(time.Hour))}),
+		"issued in the future":  sign(Claims{UserID: "u1", RegisteredClaims: registered(DefaultIssuer, now.Add(time.Hour), now.Add(2*time.Hour))}),
+		"subject mismatch":      sign(Claims{UserID: "u2", RegisteredClaims: registered(DefaultIssuer, now, now.Add(time.Hour))}),
+		"no expiry": sign(Claims{UserID: "u1", RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: DefaultIssuer, Subject: "u1", IssuedAt: jwt.NewNumericDate(now),
+		}}),
+		"garbage": "not-a-token",
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := k.Parse(raw)
+			assert.ErrorIs(t, err, ErrTokenInvalid)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package auth signs and verifies the JWTs that identify callers of the
+// HTTP and gRPC APIs.
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// DefaultKeyID identifies the static secret and is assumed for tokens
+// without a kid header.
+const DefaultKeyID = "default"
+
+const secretSize = 32
+
+// DefaultKeysFile is where keys are generated when none are configured.
+const DefaultKeysFile = "./jwt-keys.json"
+
+// Key is one HMAC signing key. A rotated key verifies tokens right away but
+// signs them only from NotBefore on, when every replica has loaded it.
+type Key struct {
+	ID        string    `json:"kid"`
+	Secret    []byte    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+	NotBefore time.Time `json:"not_before"`
+}
+
+// KeySet is the content of the keys file.
+type KeySet struct {
+	Keys []Key `json:"keys"`
+}
+
+func LoadKeySet(path string) (KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return KeySet{}, err
+	}
+
+	var set KeySet
+	if err = json.Unmarshal(data, &set); err != nil {
+		return KeySet{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(set.Keys) == 0 {
+		return KeySet{}, fmt.Errorf("%s holds no keys", path)
+	}
+	for _, key := range set.Keys {
+		if key.ID == "" || len(key.Secret) < secretSize/2 {
+			return KeySet{}, fmt.Errorf("%s: key %q has no id or a short secret", path, key.ID)
+		}
+	}
+
+	return set, nil
+}
+
+// CreateKeySet writes a set with one key to path unless the file exists, and
+// reports whether it did.
+func CreateKeySet(path string, now time.Time) (bool, error) {
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	var set KeySet
+	if _, err := set.Rotate(now, 0, 1); err != nil {
+		return false, err
+	}
+
+	return true, set.Save(path)
+}
+
+// Save replaces the file atomically, so replicas never read a partial set.
+func (s KeySet) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Rotate adds a key that starts signing after delay and drops the oldest
+// keys beyond keep. The first key of a set signs immediately, there is no
+// one to wait for.
+func (s *KeySet) Rotate(now time.Time, delay time.Duration, keep int) (Key, error) {
+	key, err := newKey(now)
+	if err != nil {
+		return Key{}, err
+	}
+	if len(s.Keys) > 0 {
+		key.NotBefore = now.Add(delay).UTC()
+	}
+
+	s.Keys = append(s.Keys, key)
+	sort.SliceStable(s.Keys, func(i, j int) bool {
+		return s.Keys[i].NotBefore.Before(s.Keys[j].NotBefore)
+	})
+
+	// Only keys older than the signing one are dropped, so rotating faster
+	// than keys activate never leaves the set without a signing key.
+	signing, _ := s.signing(now)
+	for len(s.Keys) > max(keep, 2) && s.Keys[0].ID != signing.ID {
+		s.Keys = s.Keys[1:]
+	}
+
+	return key, nil
+}
+
+// signing returns the most recent key allowed to sign at now, the later one
+// of the set on ties.
+func (s KeySet) signing(now time.Time) (Key, bool) {
+	var (
+		found Key
+		ok    bool
+	)
+	for _, key := range s.Keys {
+		if key.NotBefore.After(now) {
+			continue
+		}
+		if !ok || !key.NotBefore.Before(found.NotBefore) {
+			found, ok = key, true
+		}
+	}
+
+	return found, ok
+}
+
+func (s KeySet) lookup(id string) (Key, bool) {
+	for _, key := range s.Keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+
+	return Key{}, false
+}
+
+func newKey(now time.Time) (Key, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return Key{}, err
+	}
+
+	secret := make([]byte, secretSize)
+	if _, err = rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+
+	return Key{ID: id.String(), Secret: secret, CreatedAt: now.UTC(), NotBefore: now.UTC()}, nil
+}
+
+var errNoSigningKey = errors.New("no signing key is active yet")
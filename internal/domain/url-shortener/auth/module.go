@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"go.uber.org/fx"
+)
+
+func New() fx.Option {
+	return fx.Module("auth",
+		fx.Provide(
+			NewKeyring,
+			NewOIDC,
+		),
+		fx.Invoke(
+			func(lc fx.Lifecycle, k *Keyring) {
+				lc.Append(fx.Hook{
+					OnStart: k.OnStart,
+					OnStop:  k.OnStop,
+				})
+			},
+		),
+	)
+}
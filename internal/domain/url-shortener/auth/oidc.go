@@ -0,0 +1,439 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	oidcTimeout = 10 * time.Second
+	// jwksMinRefresh bounds how often an unknown kid makes the provider keys
+	// be fetched again.
+	jwksMinRefresh = time.Minute
+
+	loginStateAudience = "oidc-login"
+)
+
+// LoginStateTTL is how long a user may take to sign in at the provider.
+const LoginStateTTL = 10 * time.Minute
+
+var (
+	ErrOIDCDisabled = errors.New("single sign-on is not configured")
+	ErrOIDCFailed   = errors.New("single sign-on failed")
+)
+
+// OIDC signs users in with an external OpenID Connect provider through the
+// authorization code flow with PKCE. The provider is discovered on first use.
+type OIDC struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	provider *providerMetadata
+	keys     map[string]crypto.PublicKey
+	keysAt   time.Time
+}
+
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDClaims are the claims of a verified ID token.
+type IDClaims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	AuthorizedBy  string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// NewOIDC returns nil when single sign-on is not configured. The redirect URL
+// defaults to the callback route under the returning URL.
+func NewOIDC(cfg *config.Model) (*OIDC, error) {
+	oidc := cfg.Auth.OIDC
+	if oidc.Issuer == "" {
+		return nil, nil
+	}
+	if oidc.ClientID == "" {
+		return nil, errors.New("oidc: client id is required")
+	}
+
+	oidc.Issuer = strings.TrimRight(oidc.Issuer, "/")
+	if oidc.RedirectURL == "" {
+		oidc.RedirectURL = strings.TrimRight(cfg.HTTP.ReturningURL, "/") + "/api/auth/oidc/callback"
+	}
+	if len(oidc.Scopes) == 0 {
+		oidc.Scopes = []string{"openid"}
+	}
+	if !slices.Contains(oidc.Scopes, "openid") {
+		oidc.Scopes = append([]string{"openid"}, oidc.Scopes...)
+	}
+
+	return &OIDC{
+		cfg:    oidc,
+		client: &http.Client{Timeout: oidcTimeout},
+		now:    time.Now,
+	}, nil
+}
+
+func (o *OIDC) Issuer() string {
+	return o.cfg.Issuer
+}
+
+// AuthCodeURL is where the browser is sent to sign in. The provider returns
+// it to the redirect URL with a code and state.
+func (o *OIDC) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.cfg.ClientID},
+		"redirect_uri":          {o.cfg.RedirectURL},
+		"scope":                 {strings.Join(o.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return provider.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange redeems the code and verifies the ID token the provider answers
+// with, including its nonce.
+func (o *OIDC) Exchange(ctx context.Context, code, verifier, nonce string) (IDClaims, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return IDClaims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"client_id":     {o.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = o.do(req, &token); err != nil {
+		return IDClaims{}, fmt.Errorf("%w: token exchange: %v", ErrOIDCFailed, err)
+	}
+	if token.IDToken == "" {
+		return IDClaims{}, fmt.Errorf("%w: no id token", ErrOIDCFailed)
+	}
+
+	return o.verify(ctx, token.IDToken, nonce)
+}
+
+// verify checks the ID token signature against the provider keys and the
+// claims OpenID Connect Core requires of a client.
+func (o *OIDC) verify(ctx context.Context, raw, nonce string) (IDClaims, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return IDClaims{}, err
+	}
+
+	var claims IDClaims
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "PS256"}),
+		jwt.WithoutClaimsValidation(),
+	)
+	_, err = parser.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return o.publicKey(ctx, kid)
+	})
+	if err != nil {
+		return IDClaims{}, fmt.Errorf("%w: id token: %v", ErrOIDCFailed, err)
+	}
+
+	now := o.now()
+	switch {
+	// The exact issuer string of the provider, trailing slash included.
+	case claims.Issuer != provider.Issuer:
+		return IDClaims{}, fmt.Errorf("%w: unexpected issuer %q", ErrOIDCFailed, claims.Issuer)
+	case claims.Subject == "":
+		return IDClaims{}, fmt.Errorf("%w: no subject", ErrOIDCFailed)
+	case !claims.VerifyAudience(o.cfg.ClientID, true):
+		return IDClaims{}, fmt.Errorf("%w: issued for another client", ErrOIDCFailed)
+	case len(claims.Audience) > 1 && claims.AuthorizedBy != o.cfg.ClientID:
+		return IDClaims{}, fmt.Errorf("%w: unexpected authorized party", ErrOIDCFailed)
+	case claims.ExpiresAt == nil || !now.Before(claims.ExpiresAt.Add(clockSkew)):
+		return IDClaims{}, fmt.Errorf("%w: id token expired", ErrOIDCFailed)
+	case claims.IssuedAt == nil || claims.IssuedAt.After(now.Add(clockSkew)):
+		return IDClaims{}, fmt.Errorf("%w: missing or future iat", ErrOIDCFailed)
+	case claims.Nonce != nonce:
+		return IDClaims{}, fmt.Errorf("%w: nonce mismatch", ErrOIDCFailed)
+	}
+
+	return claims, nil
+}
+
+func (o *OIDC) discover(ctx context.Context) (providerMetadata, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.provider != nil {
+		return *o.provider, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return providerMetadata{}, err
+	}
+
+	var provider providerMetadata
+	if err = o.do(req, &provider); err != nil {
+		return providerMetadata{}, fmt.Errorf("oidc discovery: %w", err)
+	}
+	// The issuer must match exactly, or tokens of another tenant would pass.
+	if strings.TrimRight(provider.Issuer, "/") != o.cfg.Issuer {
+		return providerMetadata{}, fmt.Errorf("oidc discovery: issuer %q does not match %q", provider.Issuer, o.cfg.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return providerMetadata{}, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	o.provider = &provider
+	return provider, nil
+}
+
+// publicKey returns the provider key kid names. Keys are fetched again when
+// the kid is unknown, so that provider key rotations are picked up.
+func (o *OIDC) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key, ok := o.lookupKey(kid); ok {
+		return key, nil
+	}
+	if o.keys != nil && o.now().Sub(o.keysAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown provider key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jwkSet
+	if err = o.do(req, &set); err != nil {
+		return nil, fmt.Errorf("fetch provider keys: %w", err)
+	}
+	o.keys, o.keysAt = set.publicKeys(), o.now()
+
+	if key, ok := o.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown provider key %q", kid)
+}
+
+// lookupKey accepts a missing kid only when the provider has a single key.
+func (o *OIDC) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(o.keys) == 1 {
+		for _, key := range o.keys {
+			return key, true
+		}
+	}
+
+	key, ok := o.keys[kid]
+	return key, ok
+}
+
+func (o *OIDC) do(req *http.Request, out any) error {
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKeys skips encryption keys and keys of unsupported types.
+func (s jwkSet) publicKeys() map[string]crypto.PublicKey {
+	keys := make(map[string]crypto.PublicKey, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	return keys
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("malformed rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ec point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("malformed key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+// LoginState travels through the browser from the login redirect to the
+// callback, signed by the keyring so that replicas share no sessions.
+type LoginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// NewLoginState draws the random state, nonce and PKCE verifier of a login.
+func NewLoginState() (LoginState, error) {
+	var values [3]string
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return LoginState{}, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return LoginState{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// SignLoginState seals st for a short while. It is not an auth token: Parse
+// rejects it for the missing user.
+func (k *Keyring) SignLoginState(st LoginState) (string, error) {
+	now := k.now()
+	st.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    k.issuer,
+		Audience:  jwt.ClaimStrings{loginStateAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(LoginStateTTL)),
+	}
+
+	return k.Sign(st)
+}
+
+func (k *Keyring) ParseLoginState(raw string) (LoginState, error) {
+	var st LoginState
+	if _, err := k.parser.ParseWithClaims(raw, &st, k.Keyfunc); err != nil {
+		return LoginState{}, fmt.Errorf("%w: login state: %v", ErrOIDCFailed, err)
+	}
+
+	switch {
+	case st.Issuer != k.issuer || !st.VerifyAudience(loginStateAudience, true):
+		return LoginState{}, fmt.Errorf("%w: not a login state", ErrOIDCFailed)
+	case st.ExpiresAt == nil || !k.now().Before(st.ExpiresAt.Time):
+		return LoginState{}, fmt.Errorf("%w: login took too long", ErrOIDCFailed)
+	}
+
+	return st, nil
+}
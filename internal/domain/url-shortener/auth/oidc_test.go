@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURL = "http://shortener.test/api/auth/oidc/callback"
+
+func newTestOIDC(t *testing.T, secret string) (*OIDC, *oidctest.Provider) {
+	t.Helper()
+
+	provider, srv, err := oidctest.NewServer("shortener", "client-secret")
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	o, err := NewOIDC(&config.Model{Auth: config.AuthConfig{OIDC: config.OIDCConfig{
+		Issuer:       provider.Issuer(),
+		ClientID:     "shortener",
+		ClientSecret: secret,
+		RedirectURL:  testRedirectURL,
+	}}})
+	require.NoError(t, err)
+
+	return o, provider
+}
+
+// authorize follows the login redirect to the provider and returns the code
+// and state it answers with.
+func authorize(t *testing.T, o *OIDC, st LoginState) (string, string) {
+	t.Helper()
+
+	target, err := o.AuthCodeURL(context.Background(), st.State, st.Nonce, st.Verifier)
+	require.NoError(t, err)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(target)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, testRedirectURL, location.Scheme+"://"+location.Host+location.Path)
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestOIDC_Exchange(t *testing.T) {
+	o, provider := newTestOIDC(t, "client-secret")
+	provider.SignInAs("alice", "Alice@example.com")
+
+	st, err := NewLoginState()
+	require.NoError(t, err)
+
+	code, state := authorize(t, o, st)
+	assert.Equal(t, st.State, state)
+
+	claims, err := o.Exchange(context.Background(), code, st.Verifier, st.Nonce)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.Subject)
+	assert.Equal(t, "Alice@example.com", claims.Email)
+
+	// Codes are single use.
+	_, err = o.Exchange(context.Background(), code, st.Verifier, st.Nonce)
+	assert.ErrorIs(t, err, ErrOIDCFailed)
+}
+
+func TestOIDC_ExchangeRejects(t *testing.T) {
+	tests := map[string]struct {
+		secret   string
+		verifier func(LoginState) string
+		nonce    func(LoginState) string
+	}{
+		"wrong pkce verifier": {
+			secret:   "client-secret",
+			verifier: func(LoginState) string { return "guessed" },
+			nonce:    func(st LoginState) string { return st.Nonce },
+		},
+		"nonce of another login": {
+			secret:   "client-secret",
+			verifier: func(st LoginState) string { return st.Verifier },
+			nonce:    func(LoginState) string { return "replayed" },
+		},
+		"wrong client secret": {
+			secret:   "guessed",
+			verifier: func(st LoginState) string { return st.Verifier },
+			nonce:    func(st LoginState) string { return st.Nonce },
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, _ := newTestOIDC(t, tt.secret)
+			st, err := NewLoginState()
+			require.NoError(t, err)
+
+			code, _ := authorize(t, o, st)
+			_, err = o.Exchange(context.Background(), code, tt.verifier(st), tt.nonce(st))
+			assert.ErrorIs(t, err, ErrOIDCFailed)
+		})
+	}
+}
+
+func TestOIDC_DiscoveryIssuerMismatch(t *testing.T) {
+	provider, srv, err := oidctest.NewServer("shortener", "")
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// The same provider reachable under another URL is not trusted for it.
+	mirror := httptest.NewServer(provider)
+	defer mirror.Close()
+
+	o, err := NewOIDC(&config.Model{Auth: config.AuthConfig{OIDC: config.OIDCConfig{
+		Issuer:   mirror.URL,
+		ClientID: "shortener",
+	}}})
+	require.NoError(t, err)
+
+	_, err = o.AuthCodeURL(context.Background(), "s", "n", "v")
+	assert.ErrorContains(t, err, "does not match")
+}
+
+func TestKeyring_LoginState(t *testing.T) {
+	k := NewStaticKeyring([]byte("secret"))
+	now := time.Now()
+	k.now = func() time.Time { return now }
+
+	st, err := NewLoginState()
+	require.NoError(t, err)
+	sealed, err := k.SignLoginState(st)
+	require.NoError(t, err)
+
+	opened, err := k.ParseLoginState(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, st.State, opened.State)
+	assert.Equal(t, st.Verifier, opened.Verifier)
+
+	// A login state is not an auth token, nor the other way round.
+	_, err = k.Parse(sealed)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+	token, _, err := k.Issue("u1")
+	require.NoError(t, err)
+	_, err = k.ParseLoginState(token)
+	assert.ErrorIs(t, err, ErrOIDCFailed)
+
+	k.now = func() time.Time { return now.Add(LoginStateTTL + time.Second) }
+	_, err = k.ParseLoginState(sealed)
+	assert.ErrorIs(t, err, ErrOIDCFailed)
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	DefaultIssuer   = "url-shortener"
+	DefaultTokenTTL = 30 * 24 * time.Hour
+
+	// clockSkew is tolerated between the replicas issuing and checking tokens.
+	clockSkew = time.Minute
+)
+
+var (
+	ErrTokenInvalid = errors.New("invalid auth token")
+	ErrTokenExpired = errors.New("auth token expired")
+	// ErrTokenUnverifiable is an invalid token whose signature does not
+	// verify, typically because its key was rotated out.
+	ErrTokenUnverifiable = fmt.Errorf("%w: unknown signing key or bad signature", ErrTokenInvalid)
+)
+
+// Claims of an auth token. UserID repeats the subject; Parse refuses tokens
+// where the two differ.
+type Claims struct {
+	UserID string `json:"userID"`
+	jwt.RegisteredClaims
+}
+
+// Issue signs a token for userID that lives for the configured lifetime.
+func (k *Keyring) Issue(userID string) (string, Claims, error) {
+	now := k.now()
+	claims := Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    k.issuer,
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(k.ttl)),
+		},
+	}
+
+	token, err := k.Sign(claims)
+	if err != nil {
+		return "", Claims{}, err
+	}
+
+	return token, claims, nil
+}
+
+// IssueAnonymous signs a token for a new anonymous identity.
+func (k *Keyring) IssueAnonymous() (string, Claims, error) {
+	userID, err := uuid.NewV7()
+	if err != nil {
+		return "", Claims{}, err
+	}
+
+	return k.Issue(userID.String())
+}
+
+// Refresh re-issues a valid token close to its expiry, so active users stay
+// signed in. The token is empty when the current one is kept.
+func (k *Keyring) Refresh(claims Claims) (string, Claims, error) {
+	if !k.NeedsRefresh(claims) {
+		return "", claims, nil
+	}
+
+	return k.Issue(claims.UserID)
+}
+
+// Parse verifies the signature and requires the registered claims Issue
+// sets. Expired tokens fail with ErrTokenExpired, tokens of unknown keys or
+// with bad signatures with ErrTokenUnverifiable, anything else with
+// ErrTokenInvalid.
+func (k *Keyring) Parse(raw string) (Claims, error) {
+	var claims Claims
+	_, err := k.parser.ParseWithClaims(raw, &claims, k.Keyfunc)
+	var ve *jwt.ValidationError
+	if errors.As(err, &ve) && ve.Errors&(jwt.ValidationErrorUnverifiable|jwt.ValidationErrorSignatureInvalid) != 0 {
+		return Claims{}, fmt.Errorf("%w: %v", ErrTokenUnverifiable, err)
+	}
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrTokenInvalid, err)
+	}
+
+	now := k.now()
+	switch {
+	case claims.UserID == "" || claims.Subject != claims.UserID:
+		return Claims{}, fmt.Errorf("%w: no user", ErrTokenInvalid)
+	case claims.Issuer != k.issuer:
+		return Claims{}, fmt.Errorf("%w: unexpected issuer %q", ErrTokenInvalid, claims.Issuer)
+	case claims.IssuedAt == nil || claims.IssuedAt.After(now.Add(clockSkew)):
+		return Claims{}, fmt.Errorf("%w: missing or future iat", ErrTokenInvalid)
+	case claims.NotBefore != nil && claims.NotBefore.After(now.Add(clockSkew)):
+		return Claims{}, fmt.Errorf("%w: not valid yet", ErrTokenInvalid)
+	case claims.ExpiresAt == nil:
+		return Claims{}, fmt.Errorf("%w: no expiry", ErrTokenInvalid)
+	case !now.Before(claims.ExpiresAt.Add(clockSkew)):
+		return Claims{}, ErrTokenExpired
+	}
+
+	return claims, nil
+}
+
+// NeedsRefresh reports whether a valid token is close enough to its expiry
+// to be re-issued.
+func (k *Keyring) NeedsRefresh(claims Claims) bool {
+	return claims.ExpiresAt != nil && claims.ExpiresAt.Sub(k.now()) < k.refreshBefore
+}
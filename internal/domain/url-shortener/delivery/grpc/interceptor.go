@@ -0,0 +1,184 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
+	shortenerv1 "github.com/MV7VM/url-shortener/pkg/shortener/v1"
+	"github.com/gofrs/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AuthMetadata carries the same JWT as the "auth" cookie of the REST API or
+// an API key.
+const AuthMetadata = "authorization"
+
+// readOnlyMethods are the calls allowed to read-only API keys.
+var readOnlyMethods = map[string]bool{
+	shortenerv1.Shortener_Resolve_FullMethodName:      true,
+	shortenerv1.Shortener_ListUserURLs_FullMethodName: true,
+}
+
+const (
+	userIDKey entities.CtxKeyString = "userID"
+	// newUserKey marks calls for which auth has just minted an identity.
+	newUserKey entities.CtxKeyString = "newUser"
+)
+
+// RequestIDMetadata identifies a call like the X-Request-Id header of the
+// REST API: a sane id sent by the client is kept, otherwise one is generated,
+// and either way it is returned in the response header metadata.
+const RequestIDMetadata = "x-request-id"
+
+// requestInfo puts the id and the peer address of the call into its context
+// for the audit log.
+func (s *Server) requestInfo(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var id string
+	if ids := md.Get(RequestIDMetadata); len(ids) > 0 && usecase.ValidRequestID(ids[0]) {
+		id = ids[0]
+	} else {
+		generated, err := uuid.NewV7()
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to create request id")
+		}
+		id = generated.String()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadata, id))
+
+	info := entities.RequestInfo{RequestID: id}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		info.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(info.IP); err == nil {
+			info.IP = host
+		}
+	}
+
+	return handler(entities.WithRequestInfo(ctx, info), req)
+}
+
+// auth is the gRPC counterpart of the cookie auth middleware: a valid token
+// identifies the caller, a missing one mints a new anonymous identity that is
+// returned in the response header metadata. So is a token re-issued close to
+// its expiry. Unlike browsers, RPC clients hold tokens explicitly, so an
+// expired one is refused instead of silently replaced.
+func (s *Server) auth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	tokens := md.Get(AuthMetadata)
+	if len(tokens) == 0 {
+		token, claims, err := s.keys.IssueAnonymous()
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to create auth token")
+		}
+
+		if err = grpc.SetHeader(ctx, metadata.Pairs(AuthMetadata, token)); err != nil {
+			return nil, err
+		}
+
+		ctx = context.WithValue(ctx, newUserKey, true)
+		return handler(context.WithValue(ctx, userIDKey, claims.UserID), req)
+	}
+
+	raw := strings.TrimPrefix(tokens[0], "Bearer ")
+	if strings.HasPrefix(raw, usecase.APIKeyPrefix) {
+		key, err := s.uc.AuthenticateAPIKey(ctx, raw)
+		if errors.Is(err, usecase.ErrInvalidAPIKey) {
+			return nil, status.Error(codes.Unauthenticated, "invalid api key")
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, "storage unavailable")
+		}
+		if key.ReadOnly && !readOnlyMethods[info.FullMethod] {
+			return nil, status.Error(codes.PermissionDenied, "api key is read-only")
+		}
+
+		return handler(context.WithValue(ctx, userIDKey, key.UserID), req)
+	}
+
+	claims, err := s.keys.Parse(raw)
+	if errors.Is(err, auth.ErrTokenExpired) {
+		return nil, status.Error(codes.Unauthenticated, "auth token expired")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid auth token")
+	}
+
+	if token, _, err := s.keys.Refresh(claims); err == nil && token != "" {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(AuthMetadata, token))
+	}
+
+	return handler(context.WithValue(ctx, userIDKey, claims.UserID), req)
+}
+
+// RetryAfterMetadata is the number of seconds a rate limited caller should
+// wait, like the Retry-After header of the REST API.
+const RetryAfterMetadata = "retry-after"
+
+// rateLimit admits a call only if the caller's buckets of its class still
+// have a token. The buckets are those of the REST API: every call takes a
+// token from the bucket of the peer IP, calls with a presented identity from
+// the bucket of their user too.
+func (s *Server) rateLimit(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	class, cfg := s.rateLimitClass(info.FullMethod)
+	limit := entities.RateLimit{Rate: cfg.Rate, Burst: cfg.Burst}
+	if class == "" || !limit.Enabled() {
+		return handler(ctx, req)
+	}
+
+	keys := []string{class + ":ip:" + entities.RequestInfoFrom(ctx).IP}
+	if userID := userIDFromContext(ctx); userID != "" && ctx.Value(newUserKey) == nil {
+		keys = append(keys, class+":user:"+userID)
+	}
+
+	var decision entities.RateDecision
+	for i, key := range keys {
+		if d := s.uc.TakeToken(ctx, key, limit); i == 0 || d.Restricts(decision) {
+			decision = d
+		}
+	}
+
+	if !decision.Allowed {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RetryAfterMetadata, seconds(decision.RetryAfter)))
+		return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+
+	return handler(ctx, req)
+}
+
+// rateLimitClass returns the rate limit class of a method, empty for calls
+// that are not limited.
+func (s *Server) rateLimitClass(method string) (string, config.LimitConfig) {
+	switch method {
+	case shortenerv1.Shortener_Shorten_FullMethodName:
+		return "create", s.cfg.RateLimit.Create
+	case shortenerv1.Shortener_BatchShorten_FullMethodName:
+		return "batch", s.cfg.RateLimit.Batch
+	default:
+		return "", config.LimitConfig{}
+	}
+}
+
+// seconds rounds d up, so clients never retry too early.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+func userIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey).(string)
+	return userID
+}
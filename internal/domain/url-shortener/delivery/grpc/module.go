@@ -0,0 +1,25 @@
+package grpc
+
+import (
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func New() fx.Option {
+	return fx.Module("NewGRPCServer",
+		fx.Provide(
+			NewServer,
+		),
+		fx.Invoke(
+			func(lc fx.Lifecycle, s *Server) {
+				lc.Append(fx.Hook{
+					OnStart: s.OnStart,
+					OnStop:  s.OnStop,
+				})
+			},
+		),
+		fx.Decorate(func(log *zap.Logger) *zap.Logger {
+			return log.Named("grpc")
+		}),
+	)
+}
@@ -0,0 +1,247 @@
+// Package grpc implements the gRPC API facade over the business use-case
+// layer. It mirrors the REST endpoints of the http package.
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
+	shortenerv1 "github.com/MV7VM/url-shortener/pkg/shortener/v1"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Server struct {
+	shortenerv1.UnimplementedShortenerServer
+
+	logger     *zap.Logger
+	cfg        *config.Model
+	uc         uc
+	keys       *auth.Keyring
+	returning  string
+	grpcServer *grpc.Server
+}
+
+type uc interface {
+	GetByID(context.Context, string) (string, bool, error)
+	CreateShortURL(context.Context, string, string) (string, bool, error)
+	BatchURLs(ctx context.Context, urls []entities.BatchItem, userID string) error
+	GetUsersUrls(ctx context.Context, userID string, q entities.URLQuery) (entities.URLPage, error)
+	EnqueueDeletion(ctx context.Context, shortURL []string, userID string) (entities.DeletionJob, error)
+	AuthenticateAPIKey(ctx context.Context, raw string) (entities.APIKey, error)
+	TakeToken(ctx context.Context, key string, limit entities.RateLimit) entities.RateDecision
+}
+
+func NewServer(logger *zap.Logger, cfg *config.Model, uc *usecase.Usecase, keys *auth.Keyring) *Server {
+	returning := cfg.HTTP.ReturningURL
+	if !strings.HasSuffix(returning, "/") {
+		returning += "/"
+	}
+
+	return &Server{
+		logger:    logger,
+		cfg:       cfg,
+		uc:        uc,
+		keys:      keys,
+		returning: returning,
+	}
+}
+
+// OnStart binds the listener synchronously so a busy port fails the start.
+func (s *Server) OnStart(_ context.Context) error {
+	if s.cfg.GRPC.Host == "" {
+		s.logger.Info("gRPC server disabled")
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", s.cfg.GRPC.Host)
+	if err != nil {
+		return err
+	}
+
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(s.requestInfo, s.auth, s.rateLimit)}
+	if limit := s.cfg.Limits.MaxBodyBytes; limit > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(int(limit)))
+	}
+
+	s.grpcServer = grpc.NewServer(opts...)
+	shortenerv1.RegisterShortenerServer(s.grpcServer, s)
+
+	go func() {
+		s.logger.Info("gRPC server started", zap.String("addr", listener.Addr().String()))
+		if err := s.grpcServer.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			s.logger.Error("gRPC server exited", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// OnStop waits for in-flight calls and cancels them when the fx stop context
+// expires.
+func (s *Server) OnStop(ctx context.Context) error {
+	if s.grpcServer == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
+
+	s.logger.Info("gRPC server stopped")
+	return nil
+}
+
+func (s *Server) Shorten(ctx context.Context, req *shortenerv1.ShortenRequest) (*shortenerv1.ShortenResponse, error) {
+	target := strings.TrimSpace(req.GetUrl())
+	if err := s.checkURLLength(target); err != nil {
+		return nil, err
+	}
+	if !usecase.ValidURL(target) {
+		return nil, status.Error(codes.InvalidArgument, "invalid url")
+	}
+
+	shortURL, conflict, err := s.uc.CreateShortURL(ctx, target, userIDFromContext(ctx))
+	if errors.Is(err, usecase.ErrInvalidURL) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to shorten url")
+	}
+
+	return &shortenerv1.ShortenResponse{
+		ShortUrl: s.returning + shortURL,
+		Conflict: conflict,
+	}, nil
+}
+
+func (s *Server) BatchShorten(ctx context.Context, req *shortenerv1.BatchShortenRequest) (*shortenerv1.BatchShortenResponse, error) {
+	if len(req.GetItems()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "batch payload is empty")
+	}
+	if limit := s.cfg.Limits.MaxBatchSize; limit > 0 && len(req.GetItems()) > limit {
+		return nil, status.Errorf(codes.ResourceExhausted, "batch of %d urls exceeds the limit of %d", len(req.GetItems()), limit)
+	}
+
+	items := make([]entities.BatchItem, 0, len(req.GetItems()))
+	for _, item := range req.GetItems() {
+		if err := s.checkURLLength(item.GetOriginalUrl()); err != nil {
+			return nil, err
+		}
+		items = append(items, entities.BatchItem{
+			CorrelationID: item.GetCorrelationId(),
+			OriginalURL:   item.GetOriginalUrl(),
+		})
+	}
+
+	err := s.uc.BatchURLs(ctx, items, userIDFromContext(ctx))
+	if errors.Is(err, usecase.ErrInvalidURL) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to shorten urls")
+	}
+
+	resp := &shortenerv1.BatchShortenResponse{Items: make([]*shortenerv1.BatchItem, 0, len(items))}
+	for _, item := range items {
+		resp.Items = append(resp.Items, &shortenerv1.BatchItem{
+			CorrelationId: item.CorrelationID,
+			ShortUrl:      s.returning + item.ShortURL,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *Server) Resolve(ctx context.Context, req *shortenerv1.ResolveRequest) (*shortenerv1.ResolveResponse, error) {
+	original, isDeleted, err := s.uc.GetByID(ctx, req.GetId())
+	if errors.Is(err, usecase.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "url not found")
+	}
+	if errors.Is(err, usecase.ErrDisabled) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if errors.Is(err, usecase.ErrDeleted) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, "storage unavailable")
+	}
+
+	if isDeleted {
+		return nil, status.Error(codes.FailedPrecondition, "url is deleted")
+	}
+
+	return &shortenerv1.ResolveResponse{OriginalUrl: original}, nil
+}
+
+func (s *Server) ListUserURLs(ctx context.Context, req *shortenerv1.ListUserURLsRequest) (*shortenerv1.ListUserURLsResponse, error) {
+	page, err := s.uc.GetUsersUrls(ctx, userIDFromContext(ctx), entities.URLQuery{
+		Limit:  int(req.GetPageSize()),
+		Desc:   true,
+		Cursor: req.GetPageToken(),
+	})
+	if errors.Is(err, usecase.ErrInvalidQuery) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to get urls", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get urls")
+	}
+
+	resp := &shortenerv1.ListUserURLsResponse{
+		Urls:          make([]*shortenerv1.URL, 0, len(page.Items)),
+		NextPageToken: page.Next,
+	}
+	for _, item := range page.Items {
+		resp.Urls = append(resp.Urls, &shortenerv1.URL{
+			ShortUrl:    s.returning + item.ShortURL,
+			OriginalUrl: item.OriginalURL,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *Server) DeleteURLs(ctx context.Context, req *shortenerv1.DeleteURLsRequest) (*shortenerv1.DeleteURLsResponse, error) {
+	job, err := s.uc.EnqueueDeletion(ctx, req.GetIds(), userIDFromContext(ctx))
+	if errors.Is(err, usecase.ErrDeletionQueueFull) || errors.Is(err, usecase.ErrDeletionStopped) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to delete urls")
+	}
+
+	return &shortenerv1.DeleteURLsResponse{
+		JobId:  job.ID,
+		Status: job.Status,
+		Total:  int32(job.Total),
+	}, nil
+}
+
+// checkURLLength refuses urls longer than configured, like oversized
+// messages are refused.
+func (s *Server) checkURLLength(url string) error {
+	if limit := s.cfg.Limits.MaxURLLength; limit > 0 && len(url) > limit {
+		return status.Errorf(codes.ResourceExhausted, "url of %d bytes exceeds the limit of %d", len(url), limit)
+	}
+
+	return nil
+}
@@ -0,0 +1,357 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/repository/cache"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
+	shortenerv1 "github.com/MV7VM/url-shortener/pkg/shortener/v1"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type mockUsecase struct {
+	urls    map[string]entities.Item
+	deleted map[string]bool
+	owners  map[string]string
+	queued  []string
+	request entities.RequestInfo
+	full    bool
+	apiKeys map[string]entities.APIKey
+	// limiter takes the rate limit tokens; without one every call passes.
+	limiter *cache.RateLimiter
+}
+
+func (m *mockUsecase) TakeToken(ctx context.Context, key string, limit entities.RateLimit) entities.RateDecision {
+	if m.limiter == nil {
+		return entities.RateDecision{Allowed: true}
+	}
+	d, _ := m.limiter.TakeToken(ctx, key, limit)
+	return d
+}
+
+func (m *mockUsecase) AuthenticateAPIKey(_ context.Context, raw string) (entities.APIKey, error) {
+	key, ok := m.apiKeys[raw]
+	if !ok {
+		return entities.APIKey{}, usecase.ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+func newMockUsecase() *mockUsecase {
+	return &mockUsecase{
+		urls:    make(map[string]entities.Item),
+		deleted: make(map[string]bool),
+		owners:  make(map[string]string),
+	}
+}
+
+func (m *mockUsecase) GetByID(_ context.Context, id string) (string, bool, error) {
+	if id == "broken" {
+		return "", false, errors.New("connection refused")
+	}
+	item, ok := m.urls[id]
+	if !ok {
+		return "", false, usecase.ErrLinkNotFound
+	}
+	if item.DisabledReason != "" {
+		return "", false, &usecase.LinkDisabledError{Reason: item.DisabledReason}
+	}
+	return item.OriginalURL, m.deleted[id], nil
+}
+
+func (m *mockUsecase) CreateShortURL(_ context.Context, url, userID string) (string, bool, error) {
+	if strings.Contains(url, "blocked.example") {
+		return "", false, fmt.Errorf("%w: blocked.example is blocked", usecase.ErrURLNotAllowed)
+	}
+	for id, item := range m.urls {
+		if item.OriginalURL == url {
+			return id, true, nil
+		}
+	}
+
+	id := string(rune('a' + len(m.urls)))
+	m.urls[id] = entities.Item{ShortURL: id, OriginalURL: url}
+	m.owners[id] = userID
+	return id, false, nil
+}
+
+func (m *mockUsecase) BatchURLs(ctx context.Context, urls []entities.BatchItem, userID string) error {
+	for i := range urls {
+		id, _, err := m.CreateShortURL(ctx, urls[i].OriginalURL, userID)
+		if err != nil {
+			return err
+		}
+		urls[i].OriginalURL, urls[i].ShortURL = "", id
+	}
+	return nil
+}
+
+func (m *mockUsecase) GetUsersUrls(_ context.Context, userID string, q entities.URLQuery) (entities.URLPage, error) {
+	if q.Cursor == "bogus" {
+		return entities.URLPage{}, usecase.ErrInvalidCursor
+	}
+
+	var page entities.URLPage
+	for id, item := range m.urls {
+		if m.owners[id] == userID {
+			page.Items = append(page.Items, item)
+		}
+	}
+	return page, nil
+}
+
+func (m *mockUsecase) EnqueueDeletion(ctx context.Context, shortURL []string, _ string) (entities.DeletionJob, error) {
+	m.request = entities.RequestInfoFrom(ctx)
+	if m.full {
+		return entities.DeletionJob{}, usecase.ErrDeletionQueueFull
+	}
+	m.queued = append(m.queued, shortURL...)
+	return entities.DeletionJob{ID: "job", Status: entities.JobQueued, Total: len(shortURL)}, nil
+}
+
+func newTestClient(t *testing.T, uc *mockUsecase) shortenerv1.ShortenerClient {
+	t.Helper()
+
+	s := &Server{
+		logger: zap.NewNop(),
+		cfg: &config.Model{
+			Limits:    config.LimitsConfig{MaxBatchSize: 2, MaxURLLength: 100},
+			RateLimit: config.RateLimitConfig{Create: config.LimitConfig{Rate: 0.01, Burst: 2}},
+		},
+		keys:      auth.NewStaticKeyring([]byte("secret")),
+		uc:        uc,
+		returning: "http://localhost:8080/",
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(s.requestInfo, s.auth, s.rateLimit))
+	shortenerv1.RegisterShortenerServer(server, s)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return shortenerv1.NewShortenerClient(conn)
+}
+
+func TestServer_AuthIssuesAndAcceptsToken(t *testing.T) {
+	uc := newMockUsecase()
+	client := newTestClient(t, uc)
+
+	var header metadata.MD
+	resp, err := client.Shorten(context.Background(), &shortenerv1.ShortenRequest{Url: "https://example.com"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/a", resp.GetShortUrl())
+	assert.False(t, resp.GetConflict())
+
+	tokens := header.Get(AuthMetadata)
+	require.Len(t, tokens, 1)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), AuthMetadata, "Bearer "+tokens[0])
+	list, err := client.ListUserURLs(ctx, &shortenerv1.ListUserURLsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetUrls(), 1)
+	assert.Equal(t, "https://example.com", list.GetUrls()[0].GetOriginalUrl())
+
+	list, err = client.ListUserURLs(ctx, &shortenerv1.ListUserURLsRequest{PageToken: "bogus"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// A fresh identity owns nothing.
+	list, err = client.ListUserURLs(context.Background(), &shortenerv1.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, list.GetUrls())
+}
+
+func TestServer_AuthRejectsInvalidToken(t *testing.T) {
+	client := newTestClient(t, newMockUsecase())
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), AuthMetadata, "broken")
+	_, err := client.ListUserURLs(ctx, &shortenerv1.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// RPC clients hold their token explicitly, so an expired one is refused
+	// rather than replaced by a new identity.
+	expired, err := auth.NewStaticKeyring([]byte("secret")).Sign(auth.Claims{
+		UserID: "u1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    auth.DefaultIssuer,
+			Subject:   "u1",
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-48 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-24 * time.Hour)),
+		},
+	})
+	require.NoError(t, err)
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), AuthMetadata, "Bearer "+expired)
+	_, err = client.ListUserURLs(ctx, &shortenerv1.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "expired")
+}
+
+func TestServer_AuthAPIKey(t *testing.T) {
+	uc := newMockUsecase()
+	uc.apiKeys = map[string]entities.APIKey{
+		"shk_rw": {ID: "k1", UserID: "user-1"},
+		"shk_ro": {ID: "k2", UserID: "user-1", ReadOnly: true},
+	}
+	client := newTestClient(t, uc)
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), AuthMetadata, "Bearer "+key)
+	}
+
+	_, err := client.Shorten(withKey("shk_rw"), &shortenerv1.ShortenRequest{Url: "https://example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", uc.owners["a"])
+
+	_, err = client.Shorten(withKey("shk_ro"), &shortenerv1.ShortenRequest{Url: "https://example.org"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	list, err := client.ListUserURLs(withKey("shk_ro"), &shortenerv1.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.GetUrls(), 1)
+
+	_, err = client.ListUserURLs(withKey("shk_unknown"), &shortenerv1.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestServer_Shorten_InvalidURL(t *testing.T) {
+	client := newTestClient(t, newMockUsecase())
+
+	_, err := client.Shorten(context.Background(), &shortenerv1.ShortenRequest{Url: "ftp://example.com"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Destinations refused by the policy are invalid arguments too.
+	_, err = client.Shorten(context.Background(), &shortenerv1.ShortenRequest{Url: "https://blocked.example/"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "blocked.example is blocked")
+
+	_, err = client.BatchShorten(context.Background(), &shortenerv1.BatchShortenRequest{
+		Items: []*shortenerv1.BatchItem{{CorrelationId: "1", OriginalUrl: "https://blocked.example/"}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Shorten_RateLimited(t *testing.T) {
+	uc := newMockUsecase()
+	uc.limiter = cache.NewRateLimiter()
+	client := newTestClient(t, uc)
+
+	var header metadata.MD
+	_, err := client.Shorten(context.Background(), &shortenerv1.ShortenRequest{Url: "https://example.com/1"}, grpc.Header(&header))
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), AuthMetadata, header.Get(AuthMetadata)[0])
+	_, err = client.Shorten(ctx, &shortenerv1.ShortenRequest{Url: "https://example.com/2"})
+	require.NoError(t, err)
+
+	_, err = client.Shorten(ctx, &shortenerv1.ShortenRequest{Url: "https://example.com/3"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.NotEmpty(t, header.Get(RetryAfterMetadata))
+
+	// A fresh identity draws from the same peer bucket.
+	_, err = client.Shorten(context.Background(), &shortenerv1.ShortenRequest{Url: "https://example.com/4"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// Calls outside the limited classes pass.
+	_, err = client.ListUserURLs(ctx, &shortenerv1.ListUserURLsRequest{})
+	require.NoError(t, err)
+}
+
+func TestServer_BatchShorten(t *testing.T) {
+	client := newTestClient(t, newMockUsecase())
+
+	resp, err := client.BatchShorten(context.Background(), &shortenerv1.BatchShortenRequest{
+		Items: []*shortenerv1.BatchItem{
+			{CorrelationId: "1", OriginalUrl: "https://one.example"},
+			{CorrelationId: "2", OriginalUrl: "https://two.example"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.GetItems(), 2)
+	assert.Equal(t, "2", resp.GetItems()[1].GetCorrelationId())
+	assert.Equal(t, "http://localhost:8080/b", resp.GetItems()[1].GetShortUrl())
+
+	_, err = client.BatchShorten(context.Background(), &shortenerv1.BatchShortenRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.BatchShorten(context.Background(), &shortenerv1.BatchShortenRequest{
+		Items: []*shortenerv1.BatchItem{{CorrelationId: "1"}, {CorrelationId: "2"}, {CorrelationId: "3"}},
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = client.BatchShorten(context.Background(), &shortenerv1.BatchShortenRequest{
+		Items: []*shortenerv1.BatchItem{{CorrelationId: "1", OriginalUrl: "https://example.com/" + strings.Repeat("a", 100)}},
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestServer_Resolve(t *testing.T) {
+	uc := newMockUsecase()
+	uc.urls["a"] = entities.Item{ShortURL: "a", OriginalURL: "https://example.com"}
+	uc.urls["b"] = entities.Item{ShortURL: "b", OriginalURL: "https://gone.example"}
+	uc.deleted["b"] = true
+	client := newTestClient(t, uc)
+
+	resp, err := client.Resolve(context.Background(), &shortenerv1.ResolveRequest{Id: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", resp.GetOriginalUrl())
+
+	_, err = client.Resolve(context.Background(), &shortenerv1.ResolveRequest{Id: "b"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	uc.urls["c"] = entities.Item{ShortURL: "c", OriginalURL: "https://phish.example", DisabledReason: "phishing"}
+	_, err = client.Resolve(context.Background(), &shortenerv1.ResolveRequest{Id: "c"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "phishing")
+
+	_, err = client.Resolve(context.Background(), &shortenerv1.ResolveRequest{Id: "zzz"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Resolve(context.Background(), &shortenerv1.ResolveRequest{Id: "broken"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestServer_DeleteURLs(t *testing.T) {
+	uc := newMockUsecase()
+	client := newTestClient(t, uc)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDMetadata, "req-1")
+	resp, err := client.DeleteURLs(ctx, &shortenerv1.DeleteURLsRequest{Ids: []string{"a", "b"}}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, "job", resp.GetJobId())
+	assert.Equal(t, int32(2), resp.GetTotal())
+	assert.Equal(t, []string{"a", "b"}, uc.queued)
+
+	// The deletion is audited with the id of the call.
+	assert.Equal(t, "req-1", uc.request.RequestID)
+	assert.Equal(t, []string{"req-1"}, header.Get(RequestIDMetadata))
+
+	uc.full = true
+	_, err = client.DeleteURLs(context.Background(), &shortenerv1.DeleteURLsRequest{Ids: []string{"c"}})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/gin-gonic/gin"
+)
+
+type CredentialsReq struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (s *Server) SignUp(c *gin.Context) {
+	var req CredentialsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	account, err := s.uc.SignUp(c.Request.Context(), s.cookieUser(c), req.Email, req.Password)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	s.signIn(c, http.StatusCreated, account)
+}
+
+func (s *Server) Login(c *gin.Context) {
+	var req CredentialsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	account, err := s.uc.Login(c.Request.Context(), s.cookieUser(c), req.Email, req.Password)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	s.signIn(c, http.StatusOK, account)
+}
+
+// Logout drops the auth cookie; the next request gets a new anonymous
+// identity.
+func (s *Server) Logout(c *gin.Context) {
+	cookie := s.cookie
+	cookie.Name = "auth"
+	cookie.Path = "/"
+	cookie.MaxAge = -1
+	http.SetCookie(c.Writer, &cookie)
+
+	c.Status(http.StatusNoContent)
+}
+
+// cookieUser is the identity whose links a sign-up or login takes over: the
+// user of a valid auth cookie, if any.
+func (s *Server) cookieUser(c *gin.Context) string {
+	cookie, err := c.Cookie("auth")
+	if err != nil {
+		return ""
+	}
+
+	claims, err := s.keys.Parse(cookie)
+	if err != nil {
+		return ""
+	}
+
+	return claims.UserID
+}
+
+// signIn replaces the auth cookie with one of the account.
+func (s *Server) signIn(c *gin.Context, status int, account entities.Account) {
+	token, claims, err := s.keys.Issue(account.ID)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	s.setAuthCookie(c, token, claims)
+	c.JSON(status, account)
+}
@@ -0,0 +1,246 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// disabledPage is served to browsers following a link a moderator disabled.
+var disabledPage = template.Must(template.New("disabled").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Link disabled</title>
+</head>
+<body>
+<h1>This link has been disabled</h1>
+<p>The short link you followed was disabled by the moderators of this service and does not lead anywhere.</p>
+{{if .}}<p>Reason: {{.}}</p>{{end}}
+</body>
+</html>
+`))
+
+// AdminURL is a link as moderators see it, with the user who created it.
+type AdminURL struct {
+	entities.Item
+	UserID string `json:"user_id,omitempty"`
+}
+
+type ModerationReq struct {
+	Reason string `json:"reason"`
+}
+
+type DisableDomainReq struct {
+	Domain string `json:"domain"`
+	Reason string `json:"reason"`
+}
+
+type DisableDomainResp struct {
+	Disabled int `json:"disabled"`
+}
+
+// linkDisabled serves the warning page to browsers and a problem to API
+// clients.
+func (s *Server) linkDisabled(c *gin.Context, err error) {
+	if c.NegotiateFormat(problemContentType, "text/html") != "text/html" {
+		s.problem(c, err)
+		return
+	}
+
+	var disabled *usecase.LinkDisabledError
+	reason := ""
+	if errors.As(err, &disabled) {
+		reason = disabled.Reason
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusForbidden)
+	if err := disabledPage.Execute(c.Writer, reason); err != nil {
+		s.logger.Warn("failed to render disabled page", zap.Error(err))
+	}
+	c.Abort()
+}
+
+// SearchLinks finds links of all users by q (a part of the original URL),
+// domain, owner and the disabled state, newest first.
+func (s *Server) SearchLinks(c *gin.Context) {
+	q := entities.LinkQuery{
+		Search: c.Query("q"),
+		Domain: c.Query("domain"),
+		Owner:  c.Query("owner"),
+		Cursor: c.Query("cursor"),
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			s.problem(c, fmt.Errorf("%w: limit must be a positive integer", usecase.ErrInvalidQuery))
+			return
+		}
+		q.Limit = limit
+	}
+	if v := c.Query("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			s.problem(c, fmt.Errorf("%w: disabled must be true or false", usecase.ErrInvalidQuery))
+			return
+		}
+		q.Disabled = &disabled
+	}
+
+	page, err := s.uc.SearchLinks(c.Request.Context(), c.GetString("userID"), q)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	setNextLink(c, page.Next)
+
+	if len(page.Items) == 0 {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	urls := make([]AdminURL, 0, len(page.Items))
+	for _, item := range page.Items {
+		urls = append(urls, s.adminURL(item))
+	}
+
+	c.JSON(http.StatusOK, urls)
+}
+
+func (s *Server) DisableURL(c *gin.Context) {
+	var req ModerationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	item, err := s.uc.DisableURL(c.Request.Context(), c.GetString("userID"), c.Param("id"), req.Reason)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, s.adminURL(item))
+}
+
+// EnableURL takes an optional body with the reason.
+func (s *Server) EnableURL(c *gin.Context) {
+	var req ModerationReq
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	item, err := s.uc.EnableURL(c.Request.Context(), c.GetString("userID"), c.Param("id"), req.Reason)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, s.adminURL(item))
+}
+
+func (s *Server) DisableDomain(c *gin.Context) {
+	var req DisableDomainReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	n, err := s.uc.DisableDomain(c.Request.Context(), c.GetString("userID"), req.Domain, req.Reason)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, DisableDomainResp{Disabled: n})
+}
+
+// GetAudit pages through the audit log, newest first, filtered by actor,
+// action, target (a short URL id) and the time range [since, until).
+func (s *Server) GetAudit(c *gin.Context) {
+	q := entities.AuditQuery{
+		ActorID: c.Query("actor"),
+		Action:  c.Query("action"),
+		Target:  c.Query("target"),
+		Cursor:  c.Query("cursor"),
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			s.problem(c, fmt.Errorf("%w: limit must be a positive integer", usecase.ErrInvalidQuery))
+			return
+		}
+		q.Limit = limit
+	}
+	var err error
+	if q.Since, err = timeQuery(c, "since"); err != nil {
+		s.problem(c, err)
+		return
+	}
+	if q.Until, err = timeQuery(c, "until"); err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	page, err := s.uc.QueryAudit(c.Request.Context(), c.GetString("userID"), q)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	setNextLink(c, page.Next)
+
+	if len(page.Entries) == 0 {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	c.JSON(http.StatusOK, page.Entries)
+}
+
+func (s *Server) GetURLAudit(c *gin.Context) {
+	entries, err := s.uc.GetAudit(c.Request.Context(), c.GetString("userID"), c.Param("id"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// timeQuery reads an optional RFC 3339 time parameter.
+func timeQuery(c *gin.Context, name string) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be an RFC 3339 time", usecase.ErrInvalidQuery, name)
+	}
+
+	return &t, nil
+}
+
+func (s *Server) adminURL(item entities.Item) AdminURL {
+	item.ShortURL = s.cfg.HTTP.ReturningURL + item.ShortURL
+	return AdminURL{Item: item, UserID: item.UserID}
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAPIKeyReq struct {
+	Name     string `json:"name"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+func (s *Server) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	key, err := s.uc.CreateAPIKey(c.Request.Context(), c.GetString("userID"), req.Name, req.ReadOnly)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+func (s *Server) GetAPIKeys(c *gin.Context) {
+	keys, err := s.uc.GetAPIKeys(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+func (s *Server) RevokeAPIKey(c *gin.Context) {
+	err := s.uc.RevokeAPIKey(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
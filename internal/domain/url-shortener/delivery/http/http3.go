@@ -0,0 +1,33 @@
+package http
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3Server binds the UDP socket on the same port as the TCP listener, so
+// that the Alt-Svc header can advertise it without extra configuration.
+func (s *Server) newHTTP3Server(addr net.Addr, tlsConfig *tls.Config) (*http3.Server, net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp", addr.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &http3.Server{
+		Handler:     s.serv,
+		TLSConfig:   tlsConfig,
+		IdleTimeout: s.cfg.HTTP.IdleTimeout,
+	}, conn, nil
+}
+
+// altSvc advertises the HTTP/3 endpoint on every TCP response; clients switch
+// to QUIC on the following requests.
+func (s *Server) altSvc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = s.h3Server.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
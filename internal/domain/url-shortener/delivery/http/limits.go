@@ -0,0 +1,52 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitBody caps the request body as sent. Declared oversized bodies are
+// refused before anything is read.
+func (s *Server) limitBody(c *gin.Context) bool {
+	limit := s.limits.MaxBodyBytes
+	if limit <= 0 {
+		return true
+	}
+
+	if c.Request.ContentLength > limit {
+		s.problem(c, fmt.Errorf("%w: body exceeds %d bytes", errTooLarge, limit))
+		return false
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	return true
+}
+
+// bodyError classifies a failure to read or decode the request body.
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return fmt.Errorf("%w: body exceeds %d bytes", errTooLarge, tooLarge.Limit)
+	}
+
+	return fmt.Errorf("%w: %v", errInvalidBody, err)
+}
+
+func (s *Server) checkURLLength(url string) error {
+	if limit := s.limits.MaxURLLength; limit > 0 && len(url) > limit {
+		return fmt.Errorf("%w: url of %d bytes exceeds the limit of %d", errTooLarge, len(url), limit)
+	}
+
+	return nil
+}
+
+func (s *Server) checkBatchSize(n int) error {
+	if limit := s.limits.MaxBatchSize; limit > 0 && n > limit {
+		return fmt.Errorf("%w: batch of %d urls exceeds the limit of %d", errTooLarge, n, limit)
+	}
+
+	return nil
+}
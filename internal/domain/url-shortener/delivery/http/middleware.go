@@ -2,14 +2,19 @@ package http
 
 import (
 	"compress/gzip"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
-	"github.com/golang-jwt/jwt/v4"
 	"go.uber.org/zap"
 )
 
@@ -27,86 +32,223 @@ func (s *Server) withLogger(handler gin.HandlerFunc) gin.HandlerFunc {
 	}
 }
 
-func (s *Server) auth(c *gin.Context) {
-	userID := ""
-	_, err := c.Cookie("auth")
-	if err != nil {
-		token := ""
-		token, userID, err = s.createAuthToken()
+// requestIDHeader carries the id of a request. A sane id sent by the caller,
+// e.g. set by a proxy, is kept, otherwise one is generated; either way it is
+// echoed in the response and recorded in the audit log.
+const requestIDHeader = "X-Request-Id"
+
+// requestInfo puts the id and the client IP of the request into its context.
+func (s *Server) requestInfo(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !usecase.ValidRequestID(id) {
+		generated, err := uuid.NewV7()
 		if err != nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
+			s.problem(c, err)
 			return
 		}
-
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:  "auth",
-			Value: token,
-			Path:  "/",
-			//HttpOnly: true,
-			//Secure:   true,
-			//SameSite: http.SameSiteNoneMode,
-			MaxAge: 0,
-		})
+		id = generated.String()
 	}
 
-	if userID != "" {
-		c.Set("userID", userID)
+	c.Header(requestIDHeader, id)
+	c.Request = c.Request.WithContext(entities.WithRequestInfo(c.Request.Context(), entities.RequestInfo{
+		IP:        c.ClientIP(),
+		RequestID: id,
+	}))
+
+	c.Next()
+}
+
+const (
+	// newUserKey marks requests for which auth has just minted an identity.
+	newUserKey = "newUser"
+	// apiKeyKey holds the id of the API key a request is authenticated with.
+	apiKeyKey = "apiKey"
+)
+
+var (
+	errReadOnlyKey   = fmt.Errorf("%w: api key is read-only", usecase.ErrForbidden)
+	errAPIKeyDenied  = fmt.Errorf("%w: not allowed with an api key", usecase.ErrForbidden)
+	errBearerInvalid = fmt.Errorf("%w: expected a bearer token", errUnauthorized)
+)
+
+func (s *Server) auth(c *gin.Context) {
+	// Явные учётные данные никогда не подменяем новой личностью.
+	if c.GetHeader("Authorization") != "" {
+		if err := s.authorization(c); err != nil {
+			s.problem(c, err)
+			return
+		}
+
 		c.Next()
 		return
 	}
 
-	err = s.parseToken(c)
+	err := s.parseToken(c)
+	if errors.Is(err, http.ErrNoCookie) || errors.Is(err, auth.ErrTokenExpired) || errors.Is(err, auth.ErrTokenUnverifiable) {
+		// Без действующего токена выдаём новую анонимную личность; так же
+		// поступаем с токеном ключа, выведенного из ротации.
+		token, claims, err := s.keys.IssueAnonymous()
+		if err != nil {
+			s.problem(c, err)
+			return
+		}
+
+		s.setAuthCookie(c, token, claims)
+		c.Set("userID", claims.UserID)
+		c.Set(newUserKey, true)
+		c.Next()
+		return
+	}
 	if err != nil {
-		c.AbortWithStatus(http.StatusUnauthorized)
+		s.problem(c, errUnauthorized)
 		return
 	}
 
 	c.Next()
 }
 
-func (s *Server) createAuthToken() (string, string, error) {
-	userID, err := uuid.NewV7()
+// authRequired admits only callers that already hold valid credentials
+// instead of minting a fresh anonymous identity like auth does.
+func (s *Server) authRequired(c *gin.Context) {
+	var err error
+	if c.GetHeader("Authorization") != "" {
+		err = s.authorization(c)
+	} else if s.parseToken(c) != nil {
+		err = errUnauthorized
+	}
+	if err == nil && c.GetString("userID") == "" {
+		err = errUnauthorized
+	}
 	if err != nil {
-		return "", "", err
+		s.problem(c, err)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": userID.String(),
-	})
+	c.Next()
+}
+
+// authorization authenticates a request by its Authorization header, which
+// carries either an API key or an auth token as a bearer credential. Tokens
+// passed this way are not refreshed, their holder manages them.
+func (s *Server) authorization(c *gin.Context) error {
+	scheme, raw, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	raw = strings.TrimSpace(raw)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || raw == "" {
+		return errBearerInvalid
+	}
+
+	if strings.HasPrefix(raw, usecase.APIKeyPrefix) {
+		key, err := s.uc.AuthenticateAPIKey(c.Request.Context(), raw)
+		if err != nil {
+			return err
+		}
+		if key.ReadOnly && !readOnlyMethod(c.Request.Method) {
+			return errReadOnlyKey
+		}
 
-	signedString, err := token.SignedString([]byte(s.cfg.HTTP.SecretToken))
+		c.Set("userID", key.UserID)
+		c.Set(apiKeyKey, key.ID)
+		return nil
+	}
+
+	claims, err := s.keys.Parse(raw)
 	if err != nil {
-		return "", "", err
+		return fmt.Errorf("%w: %w", errUnauthorized, err)
 	}
+	c.Set("userID", claims.UserID)
 
-	return signedString, userID.String(), nil
+	return nil
 }
 
+func readOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// withoutAPIKey keeps API keys away from handlers that must only be reached
+// by the user themselves, like managing the keys.
+func (s *Server) withoutAPIKey(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(apiKeyKey) != "" {
+			s.problem(c, errAPIKeyDenied)
+			return
+		}
+
+		handler(c)
+	}
+}
+
+// parseToken puts the user of a valid auth cookie into the context. A token
+// close to its expiry is re-issued, so active users stay signed in.
 func (s *Server) parseToken(c *gin.Context) error {
 	cookie, err := c.Cookie("auth")
 	if err != nil {
 		return err
 	}
 
-	token, err := jwt.Parse(cookie, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return []byte(s.cfg.HTTP.SecretToken), nil
-	})
+	claims, err := s.keys.Parse(cookie)
 	if err != nil {
 		return err
 	}
+	c.Set("userID", claims.UserID)
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		for key, value := range claims {
-			c.Set(key, value)
-		}
+	token, refreshed, err := s.keys.Refresh(claims)
+	if err != nil {
+		s.logger.Warn("failed to refresh auth token", zap.Error(err))
+		return nil
+	}
+	if token != "" {
+		s.setAuthCookie(c, token, refreshed)
 	}
 
 	return nil
 }
 
+// setAuthCookie sends the token in a cookie that expires with it.
+func (s *Server) setAuthCookie(c *gin.Context, token string, claims auth.Claims) {
+	cookie := s.cookie
+	cookie.Name = "auth"
+	cookie.Value = token
+	cookie.Path = "/"
+	if claims.ExpiresAt != nil {
+		cookie.Expires = claims.ExpiresAt.Time
+		cookie.MaxAge = max(int(time.Until(claims.ExpiresAt.Time).Seconds()), 1)
+	}
+
+	http.SetCookie(c.Writer, &cookie)
+}
+
+// authCookie builds the attributes of the auth cookie from the config.
+func authCookie(cfg config.CookieConfig, tls config.TLSConfig) (http.Cookie, error) {
+	cookie := http.Cookie{Domain: cfg.Domain, HttpOnly: cfg.HTTPOnly}
+
+	switch cfg.Secure {
+	case "", "auto":
+		cookie.Secure = tls.CertFile != ""
+	case "true":
+		cookie.Secure = true
+	case "false":
+	default:
+		return http.Cookie{}, fmt.Errorf("unknown cookie secure mode %q", cfg.Secure)
+	}
+
+	switch strings.ToLower(cfg.SameSite) {
+	case "", "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		// Browsers drop SameSite=None cookies that are not Secure.
+		if !cookie.Secure {
+			return http.Cookie{}, errors.New("SameSite=None auth cookie requires the secure attribute")
+		}
+		cookie.SameSite = http.SameSiteNoneMode
+	default:
+		return http.Cookie{}, fmt.Errorf("unknown cookie SameSite mode %q", cfg.SameSite)
+	}
+
+	return cookie, nil
+}
+
 type gzipWriter struct {
 	gin.ResponseWriter
 	writer *gzip.Writer
@@ -170,6 +312,10 @@ func (s *Server) gzipMiddleware(handler gin.HandlerFunc) gin.HandlerFunc {
 			defer cw.Close()
 		}
 
+		if !s.limitBody(c) {
+			return
+		}
+
 		// проверяем, что клиент отправил серверу сжатые данные в формате gzip
 		contentEncoding := c.GetHeader("Content-Encoding")
 		sendsGzip := strings.Contains(contentEncoding, "gzip")
@@ -177,12 +323,16 @@ func (s *Server) gzipMiddleware(handler gin.HandlerFunc) gin.HandlerFunc {
 			// оборачиваем тело запроса в io.Reader с поддержкой декомпрессии
 			cr, err := newGzipReader(c.Request.Body)
 			if err != nil {
-				c.AbortWithStatus(http.StatusBadRequest)
+				s.problem(c, bodyError(err))
 				return
 			}
-			// меняем тело запроса на новое
-			c.Request.Body = cr
 			defer cr.Close()
+			// меняем тело запроса на новое; распакованный объём тоже ограничен,
+			// иначе маленькая gzip-бомба займёт всю память
+			c.Request.Body = cr
+			if limit := s.limits.MaxDecompressedBytes; limit > 0 {
+				c.Request.Body = http.MaxBytesReader(c.Writer, cr, limit)
+			}
 		}
 
 		// передаём управление хендлеру
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	oidcCookie = "oidc"
+	oidcPath   = "/api/auth/oidc"
+)
+
+// errProviderUnavailable covers identity providers that cannot be reached.
+var errProviderUnavailable = errors.New("identity provider unavailable")
+
+// OIDCLogin sends the browser to the identity provider. The state, nonce and
+// PKCE verifier of the login wait for the callback in a signed cookie.
+func (s *Server) OIDCLogin(c *gin.Context) {
+	if s.oidc == nil {
+		s.problem(c, auth.ErrOIDCDisabled)
+		return
+	}
+
+	st, err := auth.NewLoginState()
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	target, err := s.oidc.AuthCodeURL(c.Request.Context(), st.State, st.Nonce, st.Verifier)
+	if err != nil {
+		s.problem(c, fmt.Errorf("%w: %v", errProviderUnavailable, err))
+		return
+	}
+
+	sealed, err := s.keys.SignLoginState(st)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	s.setOIDCCookie(c, sealed, int(auth.LoginStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, target)
+}
+
+// OIDCCallback completes a login: it redeems the code, maps the subject of
+// the ID token to a user and issues the auth cookie of that user.
+func (s *Server) OIDCCallback(c *gin.Context) {
+	if s.oidc == nil {
+		s.problem(c, auth.ErrOIDCDisabled)
+		return
+	}
+
+	sealed, err := c.Cookie(oidcCookie)
+	if err != nil {
+		s.problem(c, fmt.Errorf("%w: no login in progress", auth.ErrOIDCFailed))
+		return
+	}
+	// Состояние одноразовое, удаляем его при любом исходе.
+	s.setOIDCCookie(c, "", -1)
+
+	st, err := s.keys.ParseLoginState(sealed)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+	if reason := c.Query("error"); reason != "" {
+		s.problem(c, fmt.Errorf("%w: provider answered %s", auth.ErrOIDCFailed, reason))
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(st.State)) != 1 {
+		s.problem(c, fmt.Errorf("%w: state mismatch", auth.ErrOIDCFailed))
+		return
+	}
+
+	claims, err := s.oidc.Exchange(c.Request.Context(), c.Query("code"), st.Verifier, st.Nonce)
+	if err != nil {
+		if !errors.Is(err, auth.ErrOIDCFailed) {
+			err = fmt.Errorf("%w: %v", errProviderUnavailable, err)
+		}
+		s.problem(c, err)
+		return
+	}
+
+	identity, err := s.uc.LoginExternal(c.Request.Context(), s.cookieUser(c), s.oidc.Issuer(), claims.Subject, claims.Email)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	token, issued, err := s.keys.Issue(identity.UserID)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	s.setAuthCookie(c, token, issued)
+	c.Redirect(http.StatusSeeOther, s.afterLogin())
+}
+
+// setOIDCCookie is always SameSite=Lax: the provider returns the browser with
+// a cross-site navigation, which a strict cookie would not survive.
+func (s *Server) setOIDCCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    value,
+		Path:     oidcPath,
+		Domain:   s.cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.cookie.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Server) afterLogin() string {
+	if s.cfg.Auth.OIDC.AfterLogin != "" {
+		return s.cfg.Auth.OIDC.AfterLogin
+	}
+
+	return s.cfg.HTTP.ReturningURL
+}
@@ -0,0 +1,213 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/MV7VM/url-shortener/api"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>URL shortener API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+func (s *Server) OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", api.OpenAPI)
+}
+
+func (s *Server) SwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+}
+
+// LoadOpenAPI parses and validates the embedded OpenAPI document.
+func LoadOpenAPI(ctx context.Context) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(api.OpenAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = doc.Validate(ctx); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// OpenAPIValidator checks every request and response passing through next
+// against the OpenAPI document and hands mismatches to report. Responses are
+// buffered, so it is meant for tests; event streams are passed through after
+// the request check. Authentication is left to the handlers.
+func OpenAPIValidator(next http.Handler, report func(error)) (http.Handler, error) {
+	doc, err := LoadOpenAPI(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, err := router.FindRoute(r)
+		if err != nil {
+			report(fmt.Errorf("%s %s: %w", r.Method, r.URL.Path, err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input, err := validateRequest(r, route, params)
+		if err != nil {
+			report(fmt.Errorf("%s %s: request: %w", r.Method, r.URL.Path, err))
+		}
+
+		if streams(route) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseRecorder{header: make(http.Header), code: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if err = validateResponse(input, rec); err != nil {
+			report(fmt.Errorf("%s %s: response %d: %w", r.Method, r.URL.Path, rec.code, err))
+		}
+
+		for key, values := range rec.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.code)
+		_, _ = w.Write(rec.body.Bytes())
+	}), nil
+}
+
+// validateRequest checks a decompressed copy of the request and leaves the
+// original body for the handler.
+func validateRequest(r *http.Request, route *routers.Route, params map[string]string) (*openapi3filter.RequestValidationInput, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	plain, err := decodeBody(body, r.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+
+	req := r.Clone(r.Context())
+	req.Header.Del("Content-Encoding")
+	req.Body = io.NopCloser(bytes.NewReader(plain))
+	req.ContentLength = int64(len(plain))
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: params,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+			IncludeResponseStatus: true,
+		},
+	}
+
+	return input, openapi3filter.ValidateRequest(r.Context(), input)
+}
+
+func validateResponse(input *openapi3filter.RequestValidationInput, rec *responseRecorder) error {
+	if input == nil {
+		return nil
+	}
+
+	body, err := decodeBody(rec.body.Bytes(), rec.header.Get("Content-Encoding"))
+	if err != nil {
+		return err
+	}
+
+	header := rec.header.Clone()
+	header.Del("Content-Encoding")
+
+	resp := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rec.code,
+		Header:                 header,
+		Options:                input.Options,
+	}
+
+	return openapi3filter.ValidateResponse(input.Request.Context(), resp.SetBodyBytes(body))
+}
+
+func streams(route *routers.Route) bool {
+	for _, resp := range route.Operation.Responses.Map() {
+		if resp.Value != nil && resp.Value.Content.Get("text/event-stream") != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeBody(body []byte, encoding string) ([]byte, error) {
+	if len(body) == 0 || !strings.Contains(encoding, "gzip") {
+		return body, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr)
+}
+
+type responseRecorder struct {
+	header      http.Header
+	code        int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.wroteHeader {
+		return
+	}
+	r.code, r.wroteHeader = code, true
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+
+	// Like net/http, drop bodies of responses that cannot have one.
+	if r.code == http.StatusNoContent || r.code == http.StatusNotModified {
+		return 0, http.ErrBodyNotAllowed
+	}
+
+	return r.body.Write(data)
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:shortener:problem:"
+)
+
+// Problem is an RFC 7807 error body. Code is a stable machine-readable
+// identifier, Type is derived from it.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+// Ошибки, которые возникают в самом транспорте, до вызова usecase.
+var (
+	errInvalidBody  = errors.New("invalid request body")
+	errEmptyBatch   = errors.New("batch payload is empty")
+	errUnauthorized = errors.New("missing or invalid auth token")
+	// errStorageUnavailable wraps backend failures of requests that are
+	// worth retrying, like redirects.
+	errStorageUnavailable = errors.New("storage unavailable")
+	errRateLimited        = errors.New("rate limit exceeded")
+	errTooLarge           = errors.New("request too large")
+)
+
+type problemKind struct {
+	err    error
+	status int
+	code   string
+	title  string
+}
+
+// problemKinds maps errors to answers; the first match wins, so specific
+// errors go before the kinds they wrap.
+var problemKinds = []problemKind{
+	{errInvalidBody, http.StatusBadRequest, "invalid_body", "Invalid request body"},
+	{errEmptyBatch, http.StatusBadRequest, "empty_batch", "Empty batch"},
+	{errTooLarge, http.StatusRequestEntityTooLarge, "too_large", "Payload too large"},
+	{errUnauthorized, http.StatusUnauthorized, "unauthorized", "Unauthorized"},
+	{usecase.ErrInvalidAPIKey, http.StatusUnauthorized, "unauthorized", "Unauthorized"},
+	{usecase.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials", "Invalid credentials"},
+	{usecase.ErrInvalidAccount, http.StatusBadRequest, "invalid_account", "Invalid account"},
+	{auth.ErrOIDCFailed, http.StatusUnauthorized, "sso_failed", "Single sign-on failed"},
+	{auth.ErrOIDCDisabled, http.StatusNotFound, "not_found", "Not found"},
+	{errProviderUnavailable, http.StatusServiceUnavailable, "unavailable", "Service unavailable"},
+	{errRateLimited, http.StatusTooManyRequests, "rate_limited", "Too many requests"},
+	{usecase.ErrInvalidWorkspace, http.StatusBadRequest, "invalid_workspace", "Invalid workspace"},
+	{usecase.ErrInvalidModeration, http.StatusBadRequest, "invalid_moderation", "Invalid moderation"},
+	{usecase.ErrInvalidWebhookEvent, http.StatusBadRequest, "invalid_webhook_event", "Unknown webhook event"},
+	{errStorageUnavailable, http.StatusServiceUnavailable, "unavailable", "Service unavailable"},
+	{usecase.ErrDeletionQueueFull, http.StatusServiceUnavailable, "unavailable", "Service unavailable"},
+	{usecase.ErrDeletionStopped, http.StatusServiceUnavailable, "unavailable", "Service unavailable"},
+	{usecase.ErrURLNotAllowed, http.StatusBadRequest, "url_not_allowed", "URL not allowed"},
+	{usecase.ErrInvalidURL, http.StatusBadRequest, "invalid_url", "Invalid URL"},
+	{usecase.ErrInvalidQuery, http.StatusBadRequest, "invalid_query", "Invalid query"},
+	{usecase.ErrNotFound, http.StatusNotFound, "not_found", "Not found"},
+	{usecase.ErrLinkExpired, http.StatusGone, "expired", "Link expired"},
+	{usecase.ErrDeleted, http.StatusGone, "deleted", "Deleted"},
+	{usecase.ErrDisabled, http.StatusForbidden, "link_disabled", "Link disabled"},
+	{usecase.ErrConflict, http.StatusConflict, "conflict", "Conflict"},
+	{usecase.ErrForbidden, http.StatusForbidden, "forbidden", "Forbidden"},
+}
+
+// newProblem translates err into a problem. Unknown errors become an opaque
+// 500 and server errors carry no detail, so that storage internals never
+// reach clients.
+func newProblem(err error) Problem {
+	for _, kind := range problemKinds {
+		if errors.Is(err, kind.err) {
+			p := Problem{
+				Type:   problemTypePrefix + kind.code,
+				Title:  kind.title,
+				Status: kind.status,
+				Code:   kind.code,
+			}
+			if kind.status < http.StatusInternalServerError {
+				p.Detail = err.Error()
+			}
+			return p
+		}
+	}
+
+	return Problem{
+		Type:   problemTypePrefix + "internal",
+		Title:  "Internal server error",
+		Status: http.StatusInternalServerError,
+		Code:   "internal",
+	}
+}
+
+// problem aborts the request with the RFC 7807 answer for err.
+func (s *Server) problem(c *gin.Context, err error) {
+	p := newProblem(err)
+	p.Instance = c.Request.URL.Path
+
+	if p.Status >= http.StatusInternalServerError {
+		s.logger.Error("request failed",
+			zap.String("method", c.Request.Method),
+			zap.String("uri", c.Request.RequestURI),
+			zap.Error(err),
+		)
+	}
+	if p.Status == http.StatusServiceUnavailable {
+		c.Header("Retry-After", "1")
+	}
+
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimit admits a request to handler only if the client's buckets of
+// class still have a token. Every request takes a token from the bucket of
+// its IP, so identities minted for the purpose do not raise the limit, and
+// requests with a presented identity from the bucket of their user too, so a
+// user does not get more by spreading over addresses.
+func (s *Server) rateLimit(class string, cfg config.LimitConfig, handler gin.HandlerFunc) gin.HandlerFunc {
+	limit := entities.RateLimit{Rate: cfg.Rate, Burst: cfg.Burst}
+	if !limit.Enabled() {
+		return handler
+	}
+
+	return func(c *gin.Context) {
+		var decision entities.RateDecision
+		for i, key := range rateLimitKeys(c, class) {
+			d := s.uc.TakeToken(c.Request.Context(), key, limit)
+			// The most restrictive bucket decides and is reported.
+			if i == 0 || d.Restricts(decision) {
+				decision = d
+			}
+		}
+
+		if decision.Limit > 0 {
+			c.Header("RateLimit-Limit", strconv.Itoa(decision.Limit))
+			c.Header("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			c.Header("RateLimit-Reset", seconds(decision.Reset))
+		}
+
+		if !decision.Allowed {
+			c.Header("Retry-After", seconds(decision.RetryAfter))
+			s.problem(c, errRateLimited)
+			return
+		}
+
+		handler(c)
+	}
+}
+
+func rateLimitKeys(c *gin.Context, class string) []string {
+	keys := []string{class + ":ip:" + c.ClientIP()}
+	if userID := c.GetString("userID"); userID != "" && !c.GetBool(newUserKey) {
+		keys = append(keys, class+":user:"+userID)
+	}
+
+	return keys
+}
+
+// seconds rounds d up, so clients never retry too early.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -3,17 +3,60 @@ package http
 // createController регистрирует публичные (mobile/Web) эндпоинты.
 // Префикс /app сохранён для обратной совместимости.
 func (s *Server) createController() {
+	s.serv.Use(s.requestInfo)
+
 	defaulGroup := s.serv.Group("")
+	defaulGroup.GET("/readyz", s.Ready)
+	defaulGroup.GET("/api/openapi.json", s.OpenAPI)
+	defaulGroup.GET("/api/docs", s.SwaggerUI)
 	common := defaulGroup.Group("").Use(s.auth)
 
 	// EduGroups routes
-	common.POST("/", s.withLogger(s.gzipMiddleware(s.CreateShortURL)))
-	common.GET("/:id", s.withLogger(s.gzipMiddleware(s.GetByID)))
+	limits := s.cfg.RateLimit
+	common.POST("/", s.withLogger(s.rateLimit("create", limits.Create, s.gzipMiddleware(s.CreateShortURL))))
+	common.GET("/:id", s.withLogger(s.rateLimit("redirect", limits.Redirect, s.gzipMiddleware(s.GetByID))))
 	common.GET("/ping", s.withLogger(s.gzipMiddleware(s.Ping)))
 
 	apiGroup := defaulGroup.Group("/api").Use(s.auth)
-	apiGroup.POST("/shorten", s.withLogger(s.gzipMiddleware(s.CreateShortURLByBody)))
-	apiGroup.POST("/shorten/batch", s.withLogger(s.gzipMiddleware(s.BatchURL)))
+	apiGroup.POST("/shorten", s.withLogger(s.rateLimit("create", limits.Create, s.gzipMiddleware(s.CreateShortURLByBody))))
+	apiGroup.POST("/shorten/batch", s.withLogger(s.rateLimit("batch", limits.Batch, s.gzipMiddleware(s.BatchURL))))
 	apiGroup.GET("/user/urls", s.withLogger(s.gzipMiddleware(s.GetUsersUrls)))
 	apiGroup.DELETE("/user/urls", s.withLogger(s.gzipMiddleware(s.DeleteURLs)))
+
+	// Вход и регистрация сами выдают cookie, анонимная личность им не нужна.
+	authGroup := defaulGroup.Group("/api/auth")
+	authGroup.POST("/signup", s.withLogger(s.rateLimit("login", limits.Login, s.gzipMiddleware(s.SignUp))))
+	authGroup.POST("/login", s.withLogger(s.rateLimit("login", limits.Login, s.gzipMiddleware(s.Login))))
+	authGroup.POST("/logout", s.withLogger(s.Logout))
+	authGroup.GET("/oidc/login", s.withLogger(s.OIDCLogin))
+	authGroup.GET("/oidc/callback", s.withLogger(s.rateLimit("login", limits.Login, s.OIDCCallback)))
+
+	userGroup := defaulGroup.Group("/api/user").Use(s.authRequired)
+	// SSE must not be buffered by gzip, so the stream is served uncompressed.
+	userGroup.GET("/clicks/stream", s.withLogger(s.StreamClicks))
+	userGroup.GET("/jobs/:id", s.withLogger(s.gzipMiddleware(s.GetDeletionJob)))
+	userGroup.POST("/webhooks", s.withLogger(s.gzipMiddleware(s.CreateWebhook)))
+	userGroup.GET("/webhooks", s.withLogger(s.gzipMiddleware(s.GetWebhooks)))
+	userGroup.DELETE("/webhooks/:id", s.withLogger(s.gzipMiddleware(s.DeleteWebhook)))
+	userGroup.GET("/webhooks/:id/deliveries", s.withLogger(s.gzipMiddleware(s.GetWebhookDeliveries)))
+	userGroup.PATCH("/urls/:id", s.withLogger(s.gzipMiddleware(s.UpdateURL)))
+	userGroup.POST("/workspaces", s.withLogger(s.gzipMiddleware(s.CreateWorkspace)))
+	userGroup.GET("/workspaces", s.withLogger(s.gzipMiddleware(s.GetWorkspaces)))
+	userGroup.GET("/workspaces/:id/members", s.withLogger(s.gzipMiddleware(s.GetWorkspaceMembers)))
+	userGroup.PUT("/workspaces/:id/members/:user", s.withLogger(s.gzipMiddleware(s.SetWorkspaceMember)))
+	userGroup.DELETE("/workspaces/:id/members/:user", s.withLogger(s.gzipMiddleware(s.RemoveWorkspaceMember)))
+	userGroup.POST("/workspaces/:id/urls", s.withLogger(s.rateLimit("create", limits.Create, s.gzipMiddleware(s.CreateWorkspaceURL))))
+	userGroup.GET("/workspaces/:id/urls", s.withLogger(s.gzipMiddleware(s.GetWorkspaceURLs)))
+	userGroup.POST("/keys", s.withLogger(s.withoutAPIKey(s.gzipMiddleware(s.CreateAPIKey))))
+	userGroup.GET("/keys", s.withLogger(s.withoutAPIKey(s.gzipMiddleware(s.GetAPIKeys))))
+	userGroup.DELETE("/keys/:id", s.withLogger(s.withoutAPIKey(s.gzipMiddleware(s.RevokeAPIKey))))
+
+	// Модерация доступна только администраторам и только без API ключей.
+	adminGroup := defaulGroup.Group("/api/admin").Use(s.authRequired)
+	adminGroup.GET("/urls", s.withLogger(s.withoutAPIKey(s.gzipMiddleware(s.SearchLinks))))
+	adminGroup.POST("/urls/:id/disable", s.withLogger(s.withoutAPIKey(s.gzipMiddleware(s.DisableURL))))
+	adminGroup.POST("/urls/:id/enable", s.withLogger(s.withoutAPIKey(s.gzipMiddleware(s.EnableURL))))
+	adminGroup.GET("/urls/:id/audit", s.withLogger(s.withoutAPIKey(s.gzipMiddleware(s.GetURLAudit))))
+	adminGroup.POST("/domains/disable", s.withLogger(s.withoutAPIKey(s.gzipMiddleware(s.DisableDomain))))
+	adminGroup.GET("/audit", s.withLogger(s.withoutAPIKey(s.gzipMiddleware(s.GetAudit))))
 }
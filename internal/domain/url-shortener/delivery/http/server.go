@@ -6,25 +6,53 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
 
 	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
+const defaultHeartbeat = 15 * time.Second
+
 type Server struct {
 	logger *zap.Logger
 	serv   *gin.Engine
 	cfg    *config.Model
 	uc     uc
+	keys   *auth.Keyring
+	// oidc is nil when single sign-on is not configured.
+	oidc       *auth.OIDC
+	httpServer *http.Server
+	// redirectServer answers plain HTTP with a redirect when TLS is enabled.
+	redirectServer *http.Server
+	h3Server       *http3.Server
+	h3Conn         net.PacketConn
+	shutdowner     fx.Shutdowner
+	ready          atomic.Bool
+	routes         sync.Once
+	stopping       chan struct{}
+	// notFoundPage is the branded page for unknown links, empty when unset.
+	notFoundPage []byte
+	limits       config.LimitsConfig
+	// cookie carries the configured attributes of the auth cookie.
+	cookie http.Cookie
 }
 
 type uc interface {
@@ -32,68 +60,254 @@ type uc interface {
 	CreateShortURL(context.Context, string, string) (string, bool, error)
 	Ping(ctx context.Context) error
 	BatchURLs(ctx context.Context, urls []entities.BatchItem, userID string) error
-	GetUsersUrls(ctx context.Context, userID string) ([]entities.Item, error)
-	Delete(ctx context.Context, shortURL []string, userID string) error
+	GetUsersUrls(ctx context.Context, userID string, q entities.URLQuery) (entities.URLPage, error)
+	EnqueueDeletion(ctx context.Context, shortURL []string, userID string) (entities.DeletionJob, error)
+	GetDeletionJob(ctx context.Context, id, userID string) (entities.DeletionJob, error)
+	SubscribeClicks(userID string) (<-chan entities.ClickEvent, func())
+	CreateWebhook(ctx context.Context, userID, url string, events []string) (entities.Webhook, error)
+	GetWebhooks(ctx context.Context, userID string) ([]entities.Webhook, error)
+	DeleteWebhook(ctx context.Context, id, userID string) error
+	GetWebhookDeliveries(ctx context.Context, id, userID string) ([]entities.WebhookDelivery, error)
+	TakeToken(ctx context.Context, key string, limit entities.RateLimit) entities.RateDecision
+	CreateAPIKey(ctx context.Context, userID, name string, readOnly bool) (entities.APIKey, error)
+	GetAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id, userID string) error
+	AuthenticateAPIKey(ctx context.Context, raw string) (entities.APIKey, error)
+	SignUp(ctx context.Context, currentUserID, email, password string) (entities.Account, error)
+	Login(ctx context.Context, currentUserID, email, password string) (entities.Account, error)
+	LoginExternal(ctx context.Context, currentUserID, issuer, subject, email string) (entities.Identity, error)
+	UpdateURL(ctx context.Context, shortURL, userID, originalURL, workspaceID string, expiresAt *time.Time) (entities.Item, error)
+	CreateWorkspace(ctx context.Context, userID, name string) (entities.Workspace, error)
+	GetWorkspaces(ctx context.Context, userID string) ([]entities.Workspace, error)
+	GetMembers(ctx context.Context, workspaceID, userID string) ([]entities.Member, error)
+	SetMember(ctx context.Context, workspaceID, userID, memberID, role string) (entities.Member, error)
+	RemoveMember(ctx context.Context, workspaceID, userID, memberID string) error
+	CreateWorkspaceURL(ctx context.Context, url, userID, workspaceID string) (string, bool, error)
+	SearchLinks(ctx context.Context, adminID string, q entities.LinkQuery) (entities.URLPage, error)
+	DisableURL(ctx context.Context, adminID, shortURL, reason string) (entities.Item, error)
+	EnableURL(ctx context.Context, adminID, shortURL, reason string) (entities.Item, error)
+	DisableDomain(ctx context.Context, adminID, domain, reason string) (int, error)
+	GetAudit(ctx context.Context, adminID, shortURL string) ([]entities.AuditEntry, error)
+	QueryAudit(ctx context.Context, adminID string, q entities.AuditQuery) (entities.AuditPage, error)
 }
 
 // NewServer wires up Gin, logging and use-case dependencies.
-func NewServer(logger *zap.Logger, cfg *config.Model, uc *usecase.Usecase) (*Server, error) {
+func NewServer(logger *zap.Logger, cfg *config.Model, uc *usecase.Usecase, keys *auth.Keyring, oidc *auth.OIDC, shutdowner fx.Shutdowner) (*Server, error) {
 	if cfg.HTTP.ReturningURL[len(cfg.HTTP.ReturningURL)-1] != '/' {
 		cfg.HTTP.ReturningURL += "/"
 	}
+
+	var notFoundPage []byte
+	if cfg.HTTP.NotFoundPage != "" {
+		page, err := os.ReadFile(cfg.HTTP.NotFoundPage)
+		if err != nil {
+			return nil, fmt.Errorf("read not found page: %w", err)
+		}
+		notFoundPage = page
+	}
+
+	cookie, err := authCookie(cfg.Auth.Cookie, cfg.HTTP.TLS)
+	if err != nil {
+		return nil, err
+	}
+
 	// Gin already installs its own recovery & logging middleware; leave as-is.
+	engine := gin.Default()
+	// Без явного списка прокси X-Forwarded-For не доверяем: по IP клиента
+	// работает rate limit.
+	if err := engine.SetTrustedProxies(cfg.HTTP.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+
 	return &Server{
-		logger: logger,
-		serv:   gin.Default(),
-		uc:     uc,
-		cfg:    cfg,
+		logger:       logger,
+		serv:         engine,
+		uc:           uc,
+		keys:         keys,
+		oidc:         oidc,
+		cfg:          cfg,
+		shutdowner:   shutdowner,
+		stopping:     make(chan struct{}),
+		notFoundPage: notFoundPage,
+		limits:       cfg.Limits,
+		cookie:       cookie,
 	}, nil
 }
 
-// OnStart registers routes and launches an HTTP listener in a goroutine.
+// OnStart registers routes and binds the listeners synchronously, so a busy
+// port or a broken certificate fails the application start. Requests are
+// served in goroutines; if serving fails later the whole application is shut
+// down.
 func (s *Server) OnStart(_ context.Context) error {
-	go func() {
-		s.createController()
+	s.routes.Do(s.createController)
+
+	tlsConfig, certs, err := s.newTLSConfig()
+	if err != nil {
+		return err
+	}
+	if s.cfg.HTTP.TLS.HTTP3 && tlsConfig == nil {
+		return errors.New("HTTP/3 requires a TLS certificate")
+	}
+
+	s.httpServer = &http.Server{
+		Addr:              s.cfg.HTTP.Host,
+		Handler:           s.serv,
+		TLSConfig:         tlsConfig,
+		ReadTimeout:       s.cfg.HTTP.ReadTimeout,
+		ReadHeaderTimeout: s.cfg.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      s.cfg.HTTP.WriteTimeout,
+		IdleTimeout:       s.cfg.HTTP.IdleTimeout,
+	}
+
+	listener, err := net.Listen("tcp", s.cfg.HTTP.Host)
+	if err != nil {
+		return err
+	}
 
-		s.logger.Info("HTTP server started", zap.String("addr", s.cfg.HTTP.Host))
-		if err := s.serv.Run(s.cfg.HTTP.Host); err != nil {
-			s.logger.Error("HTTP server exited", zap.Error(err))
+	if s.cfg.HTTP.TLS.HTTP3 {
+		s.h3Server, s.h3Conn, err = s.newHTTP3Server(listener.Addr(), tlsConfig)
+		if err != nil {
+			listener.Close()
+			return err
 		}
-	}()
+		s.httpServer.Handler = s.altSvc(s.serv)
+	}
+
+	if tlsConfig != nil && s.cfg.HTTP.TLS.RedirectHost != "" {
+		redirectListener, err := net.Listen("tcp", s.cfg.HTTP.TLS.RedirectHost)
+		if err != nil {
+			listener.Close()
+			if s.h3Conn != nil {
+				s.h3Conn.Close()
+			}
+			return err
+		}
+
+		s.redirectServer = &http.Server{
+			Addr:              s.cfg.HTTP.TLS.RedirectHost,
+			Handler:           http.HandlerFunc(s.redirectToHTTPS),
+			ReadHeaderTimeout: s.cfg.HTTP.ReadHeaderTimeout,
+			IdleTimeout:       s.cfg.HTTP.IdleTimeout,
+		}
+		s.serve("http", redirectListener.Addr(), func() error {
+			return s.redirectServer.Serve(redirectListener)
+		})
+	}
+
+	if certs != nil {
+		interval := s.cfg.HTTP.TLS.ReloadInterval
+		if interval <= 0 {
+			interval = defaultCertReload
+		}
+		go certs.watch(interval, s.stopping)
+	}
+
+	if s.h3Server != nil {
+		s.serve("http3", s.h3Conn.LocalAddr(), func() error {
+			return s.h3Server.Serve(s.h3Conn)
+		})
+	}
+
+	if tlsConfig != nil {
+		s.serve("https", listener.Addr(), func() error {
+			return s.httpServer.ServeTLS(listener, "", "")
+		})
+	} else {
+		s.serve("http", listener.Addr(), func() error {
+			return s.httpServer.Serve(listener)
+		})
+	}
+	s.ready.Store(true)
 
 	return nil
 }
 
-// OnStop is a no-op here (Gin has no explicit shutdown hook).
-func (s *Server) OnStop(_ context.Context) error {
+// serve runs a listener loop in the background; a listener that fails outside
+// of shutdown takes the whole application down.
+func (s *Server) serve(proto string, addr net.Addr, serve func() error) {
+	go func() {
+		s.logger.Info("HTTP server started", zap.String("proto", proto), zap.String("addr", addr.String()))
+
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("HTTP server exited", zap.String("proto", proto), zap.String("addr", addr.String()), zap.Error(err))
+			s.ready.Store(false)
+			if s.shutdowner != nil {
+				_ = s.shutdowner.Shutdown(fx.ExitCode(1))
+			}
+		}
+	}()
+}
+
+// OnStop flips readiness first so that load balancers stop sending traffic,
+// gives them ShutdownDelay to notice and then drains in-flight requests until
+// the fx stop context expires.
+func (s *Server) OnStop(ctx context.Context) error {
+	s.ready.Store(false)
+	close(s.stopping)
+
+	if s.httpServer == nil {
+		return nil
+	}
+
+	select {
+	case <-time.After(s.cfg.HTTP.ShutdownDelay):
+	case <-ctx.Done():
+	}
+
+	err := s.httpServer.Shutdown(ctx)
+	if s.redirectServer != nil {
+		err = errors.Join(err, s.redirectServer.Shutdown(ctx))
+	}
+	if s.h3Server != nil {
+		err = errors.Join(err, s.h3Server.Shutdown(ctx), s.h3Conn.Close())
+	}
+	if err != nil {
+		s.logger.Error("HTTP server shutdown", zap.Error(err))
+		return err
+	}
+
 	s.logger.Info("HTTP server stopped")
 	return nil
 }
 
+// Handler returns the routed engine without starting listeners, e.g. to mount
+// the API in an httptest server.
+func (s *Server) Handler() http.Handler {
+	s.routes.Do(s.createController)
+	return s.serv
+}
+
+// Ready is the readiness probe: it turns 503 as soon as shutdown begins.
+func (s *Server) Ready(c *gin.Context) {
+	if !s.ready.Load() {
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 func (s *Server) CreateShortURL(c *gin.Context) {
-	fmt.Println(c.GetString("userID"))
 	// Получаем raw body
 	body, err := c.GetRawData()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "failed to read request body: " + err.Error(),
-		})
+		s.problem(c, bodyError(err))
 		return
 	}
 
 	url := strings.TrimSpace(string(body))
-	if !validateURL(url) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid url",
-		})
+	if err = s.checkURLLength(url); err != nil {
+		s.problem(c, err)
+		return
+	}
+	if !usecase.ValidURL(url) {
+		s.problem(c, usecase.ErrInvalidURL)
 		return
 	}
 
 	shortURL, conflict, err := s.uc.CreateShortURL(c.Request.Context(), url, c.GetString("userID"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		s.problem(c, err)
 		return
 	}
 
@@ -117,9 +331,7 @@ func (s *Server) CreateShortURLByBody(c *gin.Context) {
 	// Получаем raw body
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Failed to read request body",
-		})
+		s.problem(c, bodyError(err))
 		return
 	}
 
@@ -128,25 +340,23 @@ func (s *Server) CreateShortURLByBody(c *gin.Context) {
 
 	err = json.Unmarshal(body, &reqBody)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid JSON format",
-		})
+		s.problem(c, fmt.Errorf("%w: %v", errInvalidBody, err))
 		return
 	}
 
 	url := strings.TrimSpace(reqBody.URL)
-	if !validateURL(url) {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid url",
-		})
+	if err = s.checkURLLength(url); err != nil {
+		s.problem(c, err)
+		return
+	}
+	if !usecase.ValidURL(url) {
+		s.problem(c, usecase.ErrInvalidURL)
 		return
 	}
 
 	shortURL, conflict, err := s.uc.CreateShortURL(c.Request.Context(), url, c.GetString("userID"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		s.problem(c, err)
 		return
 	}
 
@@ -166,14 +376,25 @@ func (s *Server) GetByID(c *gin.Context) {
 	id := c.Param("id")
 
 	url, isDeleted, err := s.uc.GetByID(c.Request.Context(), id)
+	if errors.Is(err, usecase.ErrNotFound) {
+		s.linkNotFound(c, err)
+		return
+	}
+	if errors.Is(err, usecase.ErrDisabled) {
+		s.linkDisabled(c, err)
+		return
+	}
+	if errors.Is(err, usecase.ErrDeleted) {
+		s.problem(c, err)
+		return
+	}
 	if err != nil {
-		s.logger.Error("failed to get url", zap.String("url", id), zap.Error(err))
-		c.AbortWithStatus(http.StatusBadRequest)
+		s.problem(c, fmt.Errorf("%w: %w", errStorageUnavailable, err))
 		return
 	}
 
 	if isDeleted {
-		c.AbortWithStatus(http.StatusGone)
+		s.problem(c, usecase.ErrDeleted)
 		return
 	}
 
@@ -181,12 +402,22 @@ func (s *Server) GetByID(c *gin.Context) {
 	c.Status(http.StatusTemporaryRedirect)
 }
 
+// linkNotFound serves the branded page to browsers and a problem to API
+// clients.
+func (s *Server) linkNotFound(c *gin.Context, err error) {
+	if len(s.notFoundPage) == 0 || c.NegotiateFormat(problemContentType, "text/html") != "text/html" {
+		s.problem(c, err)
+		return
+	}
+
+	c.Data(http.StatusNotFound, "text/html; charset=utf-8", s.notFoundPage)
+	c.Abort()
+}
+
 func (s *Server) Ping(c *gin.Context) {
 	err := s.uc.Ping(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		s.problem(c, err)
 		return
 	}
 
@@ -196,24 +427,28 @@ func (s *Server) Ping(c *gin.Context) {
 func (s *Server) BatchURL(c *gin.Context) { //todo 409
 	var batchedReq []entities.BatchItem
 	if err := c.ShouldBindJSON(&batchedReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "failed to read request body",
-		})
+		s.problem(c, bodyError(err))
 		return
 	}
 
 	if len(batchedReq) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "batch payload is empty",
-		})
+		s.problem(c, errEmptyBatch)
+		return
+	}
+	if err := s.checkBatchSize(len(batchedReq)); err != nil {
+		s.problem(c, err)
 		return
 	}
+	for _, item := range batchedReq {
+		if err := s.checkURLLength(item.OriginalURL); err != nil {
+			s.problem(c, err)
+			return
+		}
+	}
 
 	err := s.uc.BatchURLs(c.Request.Context(), batchedReq, c.GetString("userID"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": err.Error(),
-		})
+		s.problem(c, err)
 		return
 	}
 
@@ -224,18 +459,34 @@ func (s *Server) BatchURL(c *gin.Context) { //todo 409
 	c.JSON(http.StatusCreated, batchedReq)
 }
 
+// GetUsersUrls lists the caller's links page by page; the next page is linked
+// in the Link header.
 func (s *Server) GetUsersUrls(c *gin.Context) {
-	urls, err := s.uc.GetUsersUrls(c.Request.Context(), c.GetString("userID"))
+	q, err := urlQuery(c)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	s.writeURLPage(c, q)
+}
+
+// writeURLPage answers with a page of the links selected by q.
+func (s *Server) writeURLPage(c *gin.Context, q entities.URLQuery) {
+	page, err := s.uc.GetUsersUrls(c.Request.Context(), c.GetString("userID"), q)
 	if err != nil {
-		s.logger.Error("failed to get urls", zap.Error(err))
+		s.problem(c, err)
 		return
 	}
 
-	if len(urls) == 0 {
+	setNextLink(c, page.Next)
+
+	if len(page.Items) == 0 {
 		c.AbortWithStatus(http.StatusNoContent)
 		return
 	}
 
+	urls := page.Items
 	for i := range urls {
 		urls[i].ShortURL = s.cfg.HTTP.ReturningURL + urls[i].ShortURL
 	}
@@ -243,55 +494,178 @@ func (s *Server) GetUsersUrls(c *gin.Context) {
 	c.JSON(http.StatusOK, urls)
 }
 
+// setNextLink points the Link header at the page after cursor, if any.
+func setNextLink(c *gin.Context, cursor string) {
+	if cursor == "" {
+		return
+	}
+
+	next := *c.Request.URL
+	values := next.Query()
+	values.Set("cursor", cursor)
+	next.RawQuery = values.Encode()
+	c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
+
+// urlQuery reads the listing parameters: limit, cursor, sort (created_at or
+// clicks), order (desc by default), q to search original URLs and the
+// deleted/expired state filters. Without limit and cursor all links are
+// listed, as before the listing was paginated.
+func urlQuery(c *gin.Context) (entities.URLQuery, error) {
+	q := entities.URLQuery{
+		Sort:   c.Query("sort"),
+		Search: c.Query("q"),
+		Cursor: c.Query("cursor"),
+		Desc:   true,
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return q, fmt.Errorf("%w: limit must be a positive integer", usecase.ErrInvalidQuery)
+		}
+		q.Limit = limit
+	}
+	q.All = q.Limit == 0 && q.Cursor == ""
+
+	switch order := c.DefaultQuery("order", "desc"); order {
+	case "desc":
+	case "asc":
+		q.Desc = false
+	default:
+		return q, fmt.Errorf("%w: unknown order %q", usecase.ErrInvalidQuery, order)
+	}
+
+	for name, filter := range map[string]**bool{"deleted": &q.Deleted, "expired": &q.Expired} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+
+		state, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("%w: %s must be true or false", usecase.ErrInvalidQuery, name)
+		}
+		*filter = &state
+	}
+
+	return q, nil
+}
+
 func (s *Server) DeleteURLs(c *gin.Context) {
 	var items []string
 
 	// Привязываем JSON из тела запроса
 	if err := c.ShouldBindJSON(&items); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid JSON format",
-			"details": err.Error(),
-		})
+		s.problem(c, bodyError(err))
 		return
 	}
 
 	//В случае успешного приёма запроса хендлер должен возвращать HTTP-статус 202 Accepted.
-	//Фактический результат удаления может происходить позже — оповещать пользователя об успешности или неуспешности не нужно.
-	//context.Background() применен исходя из задания
-	go s.uc.Delete(c, items, c.GetString("userID"))
+	//Удаление выполняется воркерами в фоне, прогресс доступен по ссылке из Location.
+	job, err := s.uc.EnqueueDeletion(c.Request.Context(), items, c.GetString("userID"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
 
-	c.AbortWithStatus(http.StatusAccepted)
+	c.Header("Location", "/api/user/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
 }
 
-func validateURL(urlStr string) bool {
-	urlStr = strings.TrimSpace(urlStr)
-	if urlStr == "" {
-		return false
-	}
+type UpdateURLReq struct {
+	OriginalURL string     `json:"original_url"`
+	WorkspaceID string     `json:"workspace_id"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
 
-	// Пытаемся распарсить URL
-	u, err := url.Parse(urlStr)
-	if err != nil {
-		return false
+// UpdateURL changes the destination or the expiry of a link or moves it into
+// a workspace.
+func (s *Server) UpdateURL(c *gin.Context) {
+	var req UpdateURLReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
 	}
 
-	// Если нет схемы, добавляем http:// и пытаемся снова
-	if u.Scheme == "" {
-		u, err = url.Parse("http://" + urlStr)
-		if err != nil {
-			return false
+	url := strings.TrimSpace(req.OriginalURL)
+	if url == "" && req.WorkspaceID == "" && req.ExpiresAt == nil {
+		s.problem(c, fmt.Errorf("%w: nothing to change", errInvalidBody))
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		s.problem(c, fmt.Errorf("%w: expires_at is in the past", errInvalidBody))
+		return
+	}
+	if url != "" {
+		if err := s.checkURLLength(url); err != nil {
+			s.problem(c, err)
+			return
+		}
+		if !usecase.ValidURL(url) {
+			s.problem(c, usecase.ErrInvalidURL)
+			return
 		}
 	}
 
-	// Проверяем, что есть host
-	if u.Host == "" {
-		return false
+	item, err := s.uc.UpdateURL(c.Request.Context(), c.Param("id"), c.GetString("userID"), url, req.WorkspaceID, req.ExpiresAt)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	item.ShortURL = s.cfg.HTTP.ReturningURL + item.ShortURL
+	c.JSON(http.StatusOK, item)
+}
+
+func (s *Server) GetDeletionJob(c *gin.Context) {
+	job, err := s.uc.GetDeletionJob(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		s.problem(c, err)
+		return
 	}
 
-	// Проверяем, что схема поддерживается
-	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
-		return false
+	c.JSON(http.StatusOK, job)
+}
+
+// StreamClicks pushes the caller's click events as Server-Sent Events until the
+// client disconnects. Idle connections receive periodic "ping" events so that
+// proxies do not close them.
+func (s *Server) StreamClicks(c *gin.Context) {
+	events, cancel := s.uc.SubscribeClicks(c.GetString("userID"))
+	defer cancel()
+
+	interval := s.cfg.Clicks.Heartbeat
+	if interval <= 0 {
+		interval = defaultHeartbeat
 	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	// The stream is meant to outlive the server WriteTimeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
 
-	return true
+	c.Stream(func(_ io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-s.stopping:
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("click", event)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		}
+	})
 }
@@ -2,41 +2,209 @@ package http
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth/oidctest"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/repository/cache"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
 type mockUsecase struct {
-	GetByIDFunc        func(context.Context, string) (string, bool, error)
-	CreateShortURLFunc func(context.Context, string, string) (string, bool, error)
-	PingFunc           func(context.Context) error
-	GetUsersUrlsFunc   func(ctx context.Context, userID string) ([]entities.Item, error)
-	BatchURLsFunc      func(ctx context.Context, urls []entities.BatchItem, userID string) error
+	GetByIDFunc         func(context.Context, string) (string, bool, error)
+	CreateShortURLFunc  func(context.Context, string, string) (string, bool, error)
+	PingFunc            func(context.Context) error
+	GetUsersUrlsFunc    func(ctx context.Context, userID string, q entities.URLQuery) (entities.URLPage, error)
+	BatchURLsFunc       func(ctx context.Context, urls []entities.BatchItem, userID string) error
+	EnqueueDeletionFunc func(ctx context.Context, shortURL []string, userID string) (entities.DeletionJob, error)
+	GetDeletionJobFunc  func(ctx context.Context, id, userID string) (entities.DeletionJob, error)
+	CreateWebhookFunc   func(ctx context.Context, userID, url string, events []string) (entities.Webhook, error)
+	TakeTokenFunc       func(ctx context.Context, key string, limit entities.RateLimit) entities.RateDecision
+	APIKeys             map[string]entities.APIKey
+	LoginExternalFunc   func(ctx context.Context, currentUserID, issuer, subject, email string) (entities.Identity, error)
+	UpdateURLFunc       func(ctx context.Context, shortURL, userID, originalURL, workspaceID string, expiresAt *time.Time) (entities.Item, error)
+	SearchLinksFunc     func(ctx context.Context, adminID string, q entities.LinkQuery) (entities.URLPage, error)
+	QueryAuditFunc      func(ctx context.Context, adminID string, q entities.AuditQuery) (entities.AuditPage, error)
+	DisableURLFunc      func(ctx context.Context, adminID, shortURL, reason string) (entities.Item, error)
+	Clicks              chan entities.ClickEvent
 }
 
-func (m *mockUsecase) Delete(ctx context.Context, shortURL []string, userID string) error {
+func (m *mockUsecase) CreateAPIKey(ctx context.Context, userID, name string, readOnly bool) (entities.APIKey, error) {
+	return entities.APIKey{ID: "key-1", Name: name, ReadOnly: readOnly, Key: usecase.APIKeyPrefix + "new"}, nil
+}
+
+func (m *mockUsecase) GetAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error) {
+	return nil, nil
+}
+
+func (m *mockUsecase) RevokeAPIKey(ctx context.Context, id, userID string) error {
 	return nil
 }
 
-func (m *mockUsecase) GetUsersUrls(ctx context.Context, userID string) ([]entities.Item, error) {
-	if m.GetUsersUrlsFunc != nil {
-		return m.GetUsersUrlsFunc(ctx, userID)
+func (m *mockUsecase) SignUp(ctx context.Context, currentUserID, email, password string) (entities.Account, error) {
+	return entities.Account{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) Login(ctx context.Context, currentUserID, email, password string) (entities.Account, error) {
+	return entities.Account{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) LoginExternal(ctx context.Context, currentUserID, issuer, subject, email string) (entities.Identity, error) {
+	if m.LoginExternalFunc != nil {
+		return m.LoginExternalFunc(ctx, currentUserID, issuer, subject, email)
+	}
+	return entities.Identity{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) UpdateURL(ctx context.Context, shortURL, userID, originalURL, workspaceID string, expiresAt *time.Time) (entities.Item, error) {
+	if m.UpdateURLFunc != nil {
+		return m.UpdateURLFunc(ctx, shortURL, userID, originalURL, workspaceID, expiresAt)
+	}
+	return entities.Item{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) CreateWorkspace(ctx context.Context, userID, name string) (entities.Workspace, error) {
+	return entities.Workspace{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) GetWorkspaces(ctx context.Context, userID string) ([]entities.Workspace, error) {
+	return nil, nil
+}
+
+func (m *mockUsecase) GetMembers(ctx context.Context, workspaceID, userID string) ([]entities.Member, error) {
+	return nil, nil
+}
+
+func (m *mockUsecase) SetMember(ctx context.Context, workspaceID, userID, memberID, role string) (entities.Member, error) {
+	return entities.Member{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) RemoveMember(ctx context.Context, workspaceID, userID, memberID string) error {
+	return nil
+}
+
+func (m *mockUsecase) CreateWorkspaceURL(ctx context.Context, url, userID, workspaceID string) (string, bool, error) {
+	return "", false, errors.New("not implemented")
+}
+
+func (m *mockUsecase) SearchLinks(ctx context.Context, adminID string, q entities.LinkQuery) (entities.URLPage, error) {
+	if m.SearchLinksFunc != nil {
+		return m.SearchLinksFunc(ctx, adminID, q)
 	}
+	return entities.URLPage{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) DisableURL(ctx context.Context, adminID, shortURL, reason string) (entities.Item, error) {
+	if m.DisableURLFunc != nil {
+		return m.DisableURLFunc(ctx, adminID, shortURL, reason)
+	}
+	return entities.Item{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) EnableURL(ctx context.Context, adminID, shortURL, reason string) (entities.Item, error) {
+	return entities.Item{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) DisableDomain(ctx context.Context, adminID, domain, reason string) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *mockUsecase) GetAudit(ctx context.Context, adminID, shortURL string) ([]entities.AuditEntry, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockUsecase) QueryAudit(ctx context.Context, adminID string, q entities.AuditQuery) (entities.AuditPage, error) {
+	if m.QueryAuditFunc != nil {
+		return m.QueryAuditFunc(ctx, adminID, q)
+	}
+	return entities.AuditPage{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) AuthenticateAPIKey(ctx context.Context, raw string) (entities.APIKey, error) {
+	key, ok := m.APIKeys[raw]
+	if !ok {
+		return entities.APIKey{}, usecase.ErrInvalidAPIKey
+	}
+	return key, nil
+}
 
+func (m *mockUsecase) CreateWebhook(ctx context.Context, userID, url string, events []string) (entities.Webhook, error) {
+	if m.CreateWebhookFunc != nil {
+		return m.CreateWebhookFunc(ctx, userID, url, events)
+	}
+	return entities.Webhook{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) GetWebhooks(ctx context.Context, userID string) ([]entities.Webhook, error) {
+	return nil, nil
+}
+
+func (m *mockUsecase) DeleteWebhook(ctx context.Context, id, userID string) error {
+	return nil
+}
+
+func (m *mockUsecase) GetWebhookDeliveries(ctx context.Context, id, userID string) ([]entities.WebhookDelivery, error) {
 	return nil, nil
 }
 
+func (m *mockUsecase) SubscribeClicks(userID string) (<-chan entities.ClickEvent, func()) {
+	return m.Clicks, func() {}
+}
+
+func (m *mockUsecase) EnqueueDeletion(ctx context.Context, shortURL []string, userID string) (entities.DeletionJob, error) {
+	if m.EnqueueDeletionFunc != nil {
+		return m.EnqueueDeletionFunc(ctx, shortURL, userID)
+	}
+	return entities.DeletionJob{}, errors.New("not implemented")
+}
+
+func (m *mockUsecase) GetDeletionJob(ctx context.Context, id, userID string) (entities.DeletionJob, error) {
+	if m.GetDeletionJobFunc != nil {
+		return m.GetDeletionJobFunc(ctx, id, userID)
+	}
+	return entities.DeletionJob{}, usecase.ErrJobNotFound
+}
+
+func (m *mockUsecase) GetUsersUrls(ctx context.Context, userID string, q entities.URLQuery) (entities.URLPage, error) {
+	if m.GetUsersUrlsFunc != nil {
+		return m.GetUsersUrlsFunc(ctx, userID, q)
+	}
+
+	return entities.URLPage{}, nil
+}
+
 func (m *mockUsecase) BatchURLs(ctx context.Context, urls []entities.BatchItem, userID string) error {
 	if m.BatchURLsFunc != nil {
 		return m.BatchURLsFunc(ctx, urls, userID)
@@ -58,6 +226,13 @@ func (m *mockUsecase) CreateShortURL(ctx context.Context, url string, userID str
 	return "", false, errors.New("not implemented")
 }
 
+func (m *mockUsecase) TakeToken(ctx context.Context, key string, limit entities.RateLimit) entities.RateDecision {
+	if m.TakeTokenFunc != nil {
+		return m.TakeTokenFunc(ctx, key, limit)
+	}
+	return entities.RateDecision{Allowed: true}
+}
+
 func (m *mockUsecase) Ping(ctx context.Context) error {
 	if m.PingFunc != nil {
 		return m.PingFunc(ctx)
@@ -147,12 +322,14 @@ func TestServer_CreateShortURL_UsecaseError(t *testing.T) {
 
 	router.ServeHTTP(rec, req)
 
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
 
-	var resp map[string]interface{}
+	var resp Problem
 	err := json.Unmarshal(rec.Body.Bytes(), &resp)
 	require.NoError(t, err)
-	assert.Equal(t, "database error", resp["error"])
+	assert.Equal(t, "internal", resp.Code)
+	assert.NotContains(t, rec.Body.String(), "database error")
 }
 
 func TestServer_CreateShortURL_WithWhitespace(t *testing.T) {
@@ -216,7 +393,7 @@ func TestServer_GetByID_NotFound(t *testing.T) {
 	logger := zap.NewNop()
 	mockUC := &mockUsecase{
 		GetByIDFunc: func(ctx context.Context, id string) (string, bool, error) {
-			return "", false, errors.New("not found")
+			return "", false, usecase.ErrLinkNotFound
 		},
 	}
 
@@ -232,7 +409,117 @@ func TestServer_GetByID_NotFound(t *testing.T) {
 
 	router.ServeHTTP(rec, req)
 
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+}
+
+func TestServer_GetByID_Expired(t *testing.T) {
+	server := &Server{
+		logger: zap.NewNop(),
+		uc: &mockUsecase{
+			GetByIDFunc: func(ctx context.Context, id string) (string, bool, error) {
+				return "", false, usecase.ErrLinkExpired
+			},
+		},
+	}
+
+	router := setupTestRouter(server)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+
+	assert.Equal(t, http.StatusGone, rec.Code)
+	var p Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, "expired", p.Code)
+}
+
+func TestServer_GetByID_NotFoundPage(t *testing.T) {
+	page := filepath.Join(t.TempDir(), "404.html")
+	require.NoError(t, os.WriteFile(page, []byte("<h1>No such link</h1>"), 0o600))
+
+	server, err := NewServer(zap.NewNop(), &config.Model{
+		HTTP: config.HTTPConfig{ReturningURL: "http://localhost:8080/", NotFoundPage: page},
+	}, nil, nil, nil, nil)
+	require.NoError(t, err)
+	server.uc = &mockUsecase{
+		GetByIDFunc: func(ctx context.Context, id string) (string, bool, error) {
+			return "", false, usecase.ErrLinkNotFound
+		},
+	}
+
+	router := setupTestRouter(server)
+
+	req := httptest.NewRequest(http.MethodGet, "/nonexistent", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "<h1>No such link</h1>", rec.Body.String())
+
+	// API clients still get a problem document.
+	req = httptest.NewRequest(http.MethodGet, "/nonexistent", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+
+	_, err = NewServer(zap.NewNop(), &config.Model{
+		HTTP: config.HTTPConfig{ReturningURL: "/", NotFoundPage: filepath.Join(t.TempDir(), "missing.html")},
+	}, nil, nil, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestServer_GetByID_Disabled(t *testing.T) {
+	mockUC := &mockUsecase{
+		GetByIDFunc: func(ctx context.Context, id string) (string, bool, error) {
+			return "", false, &usecase.LinkDisabledError{Reason: "<b>phishing</b>"}
+		},
+	}
+	router := setupTestRouter(&Server{logger: zap.NewNop(), uc: mockUC, cfg: &config.Model{}})
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Location"))
+	assert.Contains(t, rec.Body.String(), "Reason: &lt;b&gt;phishing&lt;/b&gt;")
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/abc", nil))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	var p Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, "link_disabled", p.Code)
+}
+
+func TestServer_GetByID_StorageFailure(t *testing.T) {
+	mockUC := &mockUsecase{
+		GetByIDFunc: func(ctx context.Context, id string) (string, bool, error) {
+			return "", false, errors.New("dial tcp 10.0.0.1:5432: connect: connection refused")
+		},
+	}
+
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+	}
+
+	router := setupTestRouter(server)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.NotContains(t, rec.Body.String(), "5432")
 }
 
 func TestServer_CreateShortURLByBody_Success(t *testing.T) {
@@ -316,10 +603,12 @@ func TestServer_Ping_Error(t *testing.T) {
 
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
 
-	var resp map[string]interface{}
+	var resp Problem
 	err := json.Unmarshal(rec.Body.Bytes(), &resp)
 	require.NoError(t, err)
-	assert.Equal(t, "db error", resp["error"])
+	assert.Equal(t, http.StatusInternalServerError, resp.Status)
+	assert.Equal(t, "/ping", resp.Instance)
+	assert.Empty(t, resp.Detail)
 }
 
 func TestServer_CreateShortURLByBody_InvalidURL(t *testing.T) {
@@ -339,10 +628,13 @@ func TestServer_CreateShortURLByBody_InvalidURL(t *testing.T) {
 	router.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
-	var resp map[string]interface{}
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+	var resp Problem
 	err := json.Unmarshal(rec.Body.Bytes(), &resp)
 	require.NoError(t, err)
-	assert.Equal(t, "invalid url", resp["error"])
+	assert.Equal(t, "invalid_url", resp.Code)
+	assert.Equal(t, "urn:shortener:problem:invalid_url", resp.Type)
+	assert.Equal(t, "invalid url", resp.Detail)
 }
 
 func TestServer_CreateShortURLByBody_UsecaseError(t *testing.T) {
@@ -367,70 +659,1148 @@ func TestServer_CreateShortURLByBody_UsecaseError(t *testing.T) {
 
 	router.ServeHTTP(rec, req)
 
-	assert.Equal(t, http.StatusBadRequest, rec.Code)
-	var resp map[string]interface{}
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	var resp Problem
 	err := json.Unmarshal(rec.Body.Bytes(), &resp)
 	require.NoError(t, err)
-	assert.Equal(t, "database error", resp["error"])
+	assert.Equal(t, "internal", resp.Code)
+	assert.Empty(t, resp.Detail)
+}
+
+func TestServer_GetUsersUrls_Query(t *testing.T) {
+	var got entities.URLQuery
+	mockUC := &mockUsecase{
+		GetUsersUrlsFunc: func(ctx context.Context, userID string, q entities.URLQuery) (entities.URLPage, error) {
+			got = q
+			return entities.URLPage{
+				Items: []entities.Item{{ShortURL: "abc", OriginalURL: "https://example.com"}},
+				Next:  "cursor-2",
+			}, nil
+		},
+	}
+
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+		cfg:    &config.Model{HTTP: config.HTTPConfig{ReturningURL: "http://localhost:8080/"}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/user/urls", server.GetUsersUrls)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls?limit=1&sort=clicks&order=asc&q=exa&deleted=false", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, entities.SortClicks, got.Sort)
+	assert.Equal(t, 1, got.Limit)
+	assert.False(t, got.All)
+	assert.False(t, got.Desc)
+	assert.Equal(t, "exa", got.Search)
+	require.NotNil(t, got.Deleted)
+	assert.False(t, *got.Deleted)
+	assert.Nil(t, got.Expired)
+	assert.Equal(t, `</api/user/urls?cursor=cursor-2&deleted=false&limit=1&order=asc&q=exa&sort=clicks>; rel="next"`, rec.Header().Get("Link"))
+
+	var items []entities.Item
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &items))
+	assert.Equal(t, "http://localhost:8080/abc", items[0].ShortURL)
+
+	// Without limit and cursor the full list is returned, as before paging.
+	for query, all := range map[string]bool{"": true, "sort=clicks": true, "cursor=cursor-2": false} {
+		req = httptest.NewRequest(http.MethodGet, "/api/user/urls?"+query, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, all, got.All, query)
+	}
+
+	for _, query := range []string{"limit=0", "order=up", "expired=maybe"} {
+		req = httptest.NewRequest(http.MethodGet, "/api/user/urls?"+query, nil)
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Contains(t, rec.Body.String(), `"code":"invalid_query"`, query)
+	}
+}
+
+func TestServer_StreamClicks(t *testing.T) {
+	clicks := make(chan entities.ClickEvent, 1)
+	clicks <- entities.ClickEvent{ShortURL: "abc123", OriginalURL: "https://example.com"}
+	close(clicks)
+
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     &mockUsecase{Clicks: clicks},
+		cfg:    &config.Model{},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/user/clicks/stream", server.StreamClicks)
+
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/user/clicks/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "event:click")
+	assert.Contains(t, string(body), `"short_url":"abc123"`)
+}
+
+func TestServer_AuthRequired_NoCookie(t *testing.T) {
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     &mockUsecase{},
+		keys:   auth.NewStaticKeyring([]byte("secret")),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/user/clicks/stream", server.authRequired, server.StreamClicks)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/clicks/stream", nil)
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
-func TestValidateURL(t *testing.T) {
+func TestServer_Auth_Cookie(t *testing.T) {
+	keys, err := auth.NewKeyring(zap.NewNop(), &config.Model{Auth: config.AuthConfig{
+		Secret:        "secret",
+		TokenTTL:      24 * time.Hour,
+		RefreshBefore: time.Hour,
+	}})
+	require.NoError(t, err)
+	cookie, err := authCookie(config.CookieConfig{SameSite: "strict", HTTPOnly: true, Secure: "true"}, config.TLSConfig{})
+	require.NoError(t, err)
+
+	server := &Server{logger: zap.NewNop(), keys: keys, cookie: cookie}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/whoami", server.auth, func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userID"))
+	})
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: "auth", Value: token})
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	issuedCookie := func(rec *httptest.ResponseRecorder) *http.Cookie {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == "auth" {
+				return c
+			}
+		}
+		return nil
+	}
+
+	rec := get("")
+	require.Equal(t, http.StatusOK, rec.Code)
+	issued := issuedCookie(rec)
+	require.NotNil(t, issued)
+	assert.True(t, issued.HttpOnly)
+	assert.True(t, issued.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, issued.SameSite)
+	assert.InDelta(t, (24 * time.Hour).Seconds(), issued.MaxAge, 5)
+	userID := rec.Body.String()
+
+	// A fresh token is accepted as is.
+	rec = get(issued.Value)
+	assert.Equal(t, userID, rec.Body.String())
+	assert.Nil(t, issuedCookie(rec))
+
+	signed := func(iat, exp time.Time) string {
+		token, err := keys.Sign(auth.Claims{UserID: userID, RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    auth.DefaultIssuer,
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(iat),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		}})
+		require.NoError(t, err)
+		return token
+	}
+
+	// Close to its expiry the token slides forward for the same user.
+	rec = get(signed(time.Now().Add(-23*time.Hour), time.Now().Add(30*time.Minute)))
+	assert.Equal(t, userID, rec.Body.String())
+	refreshed := issuedCookie(rec)
+	require.NotNil(t, refreshed)
+	claims, err := keys.Parse(refreshed.Value)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+
+	// An expired session starts over as a new anonymous user.
+	rec = get(signed(time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, userID, rec.Body.String())
+	assert.NotNil(t, issuedCookie(rec))
+
+	// So does a session whose signing key was rotated out.
+	rotated, _, err := auth.NewStaticKeyring([]byte("rotated out")).Issue(userID)
+	require.NoError(t, err)
+	rec = get(rotated)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, userID, rec.Body.String())
+	assert.NotNil(t, issuedCookie(rec))
+
+	// Claimless tokens are refused.
+	legacy, err := keys.Sign(jwt.MapClaims{"userID": userID})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, get(legacy).Code)
+}
+
+func TestAuthCookie_Config(t *testing.T) {
+	cookie, err := authCookie(config.CookieConfig{Secure: "auto"}, config.TLSConfig{CertFile: "cert.pem"})
+	require.NoError(t, err)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+
+	_, err = authCookie(config.CookieConfig{Secure: "false", SameSite: "none"}, config.TLSConfig{})
+	assert.Error(t, err)
+
+	_, err = authCookie(config.CookieConfig{Secure: "maybe"}, config.TLSConfig{})
+	assert.Error(t, err)
+}
+
+func TestServer_CreateWebhook(t *testing.T) {
+	mockUC := &mockUsecase{
+		CreateWebhookFunc: func(ctx context.Context, userID, url string, events []string) (entities.Webhook, error) {
+			if url == "ftp://example.com" {
+				return entities.Webhook{}, usecase.ErrInvalidWebhookURL
+			}
+			return entities.Webhook{ID: "wh-1", URL: url, Events: events, Secret: "s3cr3t"}, nil
+		},
+	}
+
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/user/webhooks", server.CreateWebhook)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/webhooks",
+		bytes.NewBufferString(`{"url":"https://crm.example.com/hook","events":["link.created"]}`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var wh entities.Webhook
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &wh))
+	assert.Equal(t, "wh-1", wh.ID)
+	assert.Equal(t, "s3cr3t", wh.Secret)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/user/webhooks", bytes.NewBufferString(`{"url":"ftp://example.com"}`))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestServer_DeleteURLs_ReturnsJob(t *testing.T) {
+	mockUC := &mockUsecase{
+		EnqueueDeletionFunc: func(ctx context.Context, shortURL []string, userID string) (entities.DeletionJob, error) {
+			assert.Equal(t, []string{"abc", "def"}, shortURL)
+			return entities.DeletionJob{ID: "job-1", Status: entities.JobQueued, Total: len(shortURL)}, nil
+		},
+		GetDeletionJobFunc: func(ctx context.Context, id, userID string) (entities.DeletionJob, error) {
+			if id != "job-1" {
+				return entities.DeletionJob{}, usecase.ErrJobNotFound
+			}
+			return entities.DeletionJob{ID: id, Status: entities.JobDone, Total: 2, Processed: 2, Deleted: 2}, nil
+		},
+	}
+
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.DELETE("/api/user/urls", server.DeleteURLs)
+	router.GET("/api/user/jobs/:id", server.GetDeletionJob)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewBufferString(`["abc","def"]`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "/api/user/jobs/job-1", rec.Header().Get("Location"))
+
+	req = httptest.NewRequest(http.MethodGet, rec.Header().Get("Location"), nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var job entities.DeletionJob
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+	assert.Equal(t, entities.JobDone, job.Status)
+	assert.Equal(t, 2, job.Deleted)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/user/jobs/unknown", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestNewProblem(t *testing.T) {
 	tests := []struct {
-		name     string
-		url      string
-		expected bool
+		err    error
+		status int
+		code   string
 	}{
-		{
-			name:     "valid http url",
-			url:      "http://example.com",
-			expected: true,
+		{usecase.ErrInvalidWebhookURL, http.StatusBadRequest, "invalid_url"},
+		{usecase.ErrInvalidWebhookEvent, http.StatusBadRequest, "invalid_webhook_event"},
+		{fmt.Errorf("%w: evil.example is blocked", usecase.ErrURLNotAllowed), http.StatusBadRequest, "url_not_allowed"},
+		{usecase.ErrJobNotFound, http.StatusNotFound, "not_found"},
+		{usecase.ErrWebhookNotFound, http.StatusNotFound, "not_found"},
+		{usecase.ErrDeleted, http.StatusGone, "deleted"},
+		{usecase.ErrConflict, http.StatusConflict, "conflict"},
+		{usecase.ErrForbidden, http.StatusForbidden, "forbidden"},
+		{usecase.ErrDeletionQueueFull, http.StatusServiceUnavailable, "unavailable"},
+		{errEmptyBatch, http.StatusBadRequest, "empty_batch"},
+		{errUnauthorized, http.StatusUnauthorized, "unauthorized"},
+		{errors.New(`pq: relation "urls" does not exist`), http.StatusInternalServerError, "internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			p := newProblem(tt.err)
+			assert.Equal(t, tt.status, p.Status)
+			assert.Equal(t, tt.code, p.Code)
+			assert.Equal(t, "urn:shortener:problem:"+tt.code, p.Type)
+			if tt.status == http.StatusInternalServerError {
+				assert.Empty(t, p.Detail)
+			}
+		})
+	}
+}
+
+func TestServer_DeleteURLs_QueueFull(t *testing.T) {
+	mockUC := &mockUsecase{
+		EnqueueDeletionFunc: func(ctx context.Context, shortURL []string, userID string) (entities.DeletionJob, error) {
+			return entities.DeletionJob{}, usecase.ErrDeletionQueueFull
 		},
-		{
-			name:     "valid https url",
-			url:      "https://example.com",
-			expected: true,
+	}
+
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.DELETE("/api/user/urls", server.DeleteURLs)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewBufferString(`["abc"]`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+}
+
+func newLifecycleTestServer(host string) *Server {
+	gin.SetMode(gin.TestMode)
+	return &Server{
+		logger: zap.NewNop(),
+		serv:   gin.New(),
+		uc:     &mockUsecase{},
+		cfg: &config.Model{HTTP: config.HTTPConfig{
+			Host:         host,
+			ReturningURL: "http://localhost:8080/",
+		}},
+		stopping: make(chan struct{}),
+	}
+}
+
+func TestServer_Lifecycle_ReadinessAndShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	server := newLifecycleTestServer(addr)
+	require.NoError(t, server.OnStart(context.Background()))
+
+	resp, err := http.Get("http://" + addr + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, server.OnStop(context.Background()))
+	assert.False(t, server.ready.Load())
+
+	_, err = http.Get("http://" + addr + "/readyz")
+	assert.Error(t, err)
+}
+
+func TestServer_OnStart_PortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	server := newLifecycleTestServer(listener.Addr().String())
+
+	assert.Error(t, server.OnStart(context.Background()))
+	assert.False(t, server.ready.Load())
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 with the given
+// common name and returns the certificate and key paths.
+func writeTestCert(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func TestServer_OnStart_TLS(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "first")
+
+	addr, redirectAddr := freeAddr(t), freeAddr(t)
+	server := newLifecycleTestServer(addr)
+	server.cfg.HTTP.TLS = config.TLSConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		MinVersion:   "1.3",
+		RedirectHost: redirectAddr,
+	}
+	require.NoError(t, server.OnStart(context.Background()))
+	defer server.OnStop(context.Background())
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
 		},
-		{
-			name:     "valid url with www",
-			url:      "https://www.example.com",
-			expected: true,
+	}
+
+	resp, err := client.Get("https://" + addr + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, uint16(tls.VersionTLS13), resp.TLS.Version)
+	assert.Equal(t, "first", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	resp, err = client.Get("http://" + redirectAddr + "/abc?x=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://"+addr+"/abc?x=1", resp.Header.Get("Location"))
+}
+
+func TestServer_OnStart_TLSInvalidConfig(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "first")
+
+	tests := []config.TLSConfig{
+		{CertFile: certFile},
+		{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.0"},
+		{CertFile: certFile, KeyFile: keyFile, CipherPolicy: "legacy"},
+		{CertFile: certFile, KeyFile: certFile},
+	}
+
+	for _, tlsCfg := range tests {
+		server := newLifecycleTestServer(freeAddr(t))
+		server.cfg.HTTP.TLS = tlsCfg
+
+		assert.Error(t, server.OnStart(context.Background()))
+		assert.False(t, server.ready.Load())
+	}
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir, "first")
+
+	reloader, err := newCertReloader(zap.NewNop(), certFile, keyFile)
+	require.NoError(t, err)
+
+	commonName := func() string {
+		cert, err := reloader.GetCertificate(nil)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+
+	reloaded, err := reloader.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	writeTestCert(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	require.NoError(t, os.Chtimes(keyFile, future, future))
+
+	reloaded, err = reloader.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "second", commonName())
+
+	// A broken pair keeps the previous certificate in use.
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	_, err = reloader.reload()
+	assert.Error(t, err)
+	assert.Equal(t, "second", commonName())
+}
+
+func TestServer_OnStart_HTTP3(t *testing.T) {
+	certFile, keyFile := writeTestCert(t, t.TempDir(), "first")
+
+	addr := freeAddr(t)
+	server := newLifecycleTestServer(addr)
+	server.cfg.HTTP.TLS = config.TLSConfig{CertFile: certFile, KeyFile: keyFile, HTTP3: true}
+	require.NoError(t, server.OnStart(context.Background()))
+
+	tlsClient := &tls.Config{InsecureSkipVerify: true}
+
+	h3 := &http3.Transport{TLSClientConfig: tlsClient}
+	defer h3.Close()
+
+	resp, err := (&http.Client{Transport: h3, Timeout: 5 * time.Second}).Get("https://" + addr + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, resp.ProtoMajor)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsClient}}
+	resp, err = client.Get("https://" + addr + "/readyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(addr)
+	assert.Contains(t, resp.Header.Get("Alt-Svc"), `h3=":`+port+`"`)
+
+	require.NoError(t, server.OnStop(context.Background()))
+
+	_, err = (&http.Client{Transport: h3, Timeout: time.Second}).Get("https://" + addr + "/readyz")
+	assert.Error(t, err)
+}
+
+func TestServer_OnStart_HTTP3WithoutTLS(t *testing.T) {
+	server := newLifecycleTestServer(freeAddr(t))
+	server.cfg.HTTP.TLS.HTTP3 = true
+
+	assert.Error(t, server.OnStart(context.Background()))
+}
+
+func TestOpenAPI_DocumentsAllRoutes(t *testing.T) {
+	doc, err := LoadOpenAPI(context.Background())
+	require.NoError(t, err)
+
+	server := newLifecycleTestServer("127.0.0.1:0")
+	server.Handler()
+
+	routed := make(map[string]bool)
+	for _, route := range server.serv.Routes() {
+		path := route.Path
+		for _, part := range strings.Split(route.Path, "/") {
+			if strings.HasPrefix(part, ":") {
+				path = strings.Replace(path, part, "{"+part[1:]+"}", 1)
+			}
+		}
+		routed[route.Method+" "+path] = true
+
+		item := doc.Paths.Value(path)
+		if assert.NotNil(t, item, "undocumented path %s", path) {
+			assert.NotNil(t, item.GetOperation(route.Method), "undocumented operation %s %s", route.Method, path)
+		}
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			assert.True(t, routed[method+" "+path], "documented operation %s %s is not routed", method, path)
+		}
+	}
+}
+
+func TestServer_OpenAPI(t *testing.T) {
+	server := newLifecycleTestServer("127.0.0.1:0")
+	handler := server.Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/api/openapi.json")
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	limiter := cache.NewRateLimiter()
+	var keys []string
+	mockUC := &mockUsecase{
+		CreateShortURLFunc: func(ctx context.Context, url string, userID string) (string, bool, error) {
+			return "abc", false, nil
 		},
-		{
-			name:     "valid url with path",
-			url:      "https://example.com/path/to/page",
-			expected: true,
+		TakeTokenFunc: func(ctx context.Context, key string, limit entities.RateLimit) entities.RateDecision {
+			keys = append(keys, key)
+			d, err := limiter.TakeToken(ctx, key, limit)
+			require.NoError(t, err)
+			return d
 		},
-		{
-			name:     "valid url without protocol",
-			url:      "example.com",
-			expected: true,
+	}
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+		keys:   auth.NewStaticKeyring([]byte("secret")),
+		cfg:    &config.Model{HTTP: config.HTTPConfig{ReturningURL: "http://localhost:8080/"}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", server.auth, server.rateLimit("create", config.LimitConfig{Rate: 0.5, Burst: 2}, server.CreateShortURL))
+
+	post := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com"))
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for remaining := 1; remaining >= 0; remaining-- {
+		rec := post("192.0.2.1:1234")
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(remaining), rec.Header().Get("RateLimit-Remaining"))
+	}
+
+	rec := post("192.0.2.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "4", rec.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+
+	var p Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Equal(t, "rate_limited", p.Code)
+
+	// Другой клиент расходует свою корзину.
+	assert.Equal(t, http.StatusCreated, post("192.0.2.2:1234").Code)
+	// Cookieless callers get a fresh user each time, so they are keyed by IP.
+	assert.Equal(t, "create:ip:192.0.2.2", keys[len(keys)-1])
+}
+
+func TestServer_RateLimit_KeyedByIPAndUser(t *testing.T) {
+	limiter := cache.NewRateLimiter()
+	var keys []string
+	mockUC := &mockUsecase{
+		TakeTokenFunc: func(ctx context.Context, k string, limit entities.RateLimit) entities.RateDecision {
+			keys = append(keys, k)
+			d, err := limiter.TakeToken(ctx, k, limit)
+			require.NoError(t, err)
+			return d
+		},
+	}
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+		keys:   auth.NewStaticKeyring([]byte("secret")),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/:id", server.auth, server.rateLimit("redirect", config.LimitConfig{Rate: 0.01, Burst: 2}, func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	}))
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		token, _, err := server.keys.IssueAnonymous()
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		req.RemoteAddr = remoteAddr
+		req.AddCookie(&http.Cookie{Name: "auth", Value: token})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("192.0.2.1:1234")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "redirect:ip:192.0.2.1", keys[0])
+	assert.True(t, strings.HasPrefix(keys[1], "redirect:user:"))
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+
+	// A fresh identity per request does not escape the bucket of the IP.
+	assert.Equal(t, http.StatusNoContent, get("192.0.2.1:1234").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("192.0.2.1:1234").Code)
+	assert.Equal(t, http.StatusNoContent, get("192.0.2.2:1234").Code)
+}
+
+func TestServer_RequestLimits(t *testing.T) {
+	mockUC := &mockUsecase{
+		CreateShortURLFunc: func(ctx context.Context, url string, userID string) (string, bool, error) {
+			return "abc", false, nil
 		},
-		{
-			name:     "invalid url - empty string",
-			url:      "",
-			expected: false,
+		BatchURLsFunc: func(ctx context.Context, urls []entities.BatchItem, userID string) error {
+			return nil
 		},
-		{
-			name:     "invalid url - missing domain",
-			url:      "http://",
-			expected: false,
+	}
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+		cfg:    &config.Model{HTTP: config.HTTPConfig{ReturningURL: "http://localhost:8080/"}},
+		limits: config.LimitsConfig{
+			MaxBodyBytes:         1 << 10,
+			MaxDecompressedBytes: 4 << 10,
+			MaxBatchSize:         2,
+			MaxURLLength:         64,
 		},
-		{
-			name:     "valid url with subdomain",
-			url:      "https://subdomain.example.com",
-			expected: true,
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", server.gzipMiddleware(server.CreateShortURL))
+	router.POST("/api/shorten/batch", server.gzipMiddleware(server.BatchURL))
+
+	gzipped := func(body string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write([]byte(body))
+		require.NoError(t, zw.Close())
+		return &buf
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		body   io.Reader
+		gzip   bool
+		status int
+		detail string
+	}{
+		{"ok", "/", strings.NewReader("https://example.com"), false, http.StatusCreated, ""},
+		{"raw body", "/", strings.NewReader(strings.Repeat("a", 2<<10)), false, http.StatusRequestEntityTooLarge, "body exceeds 1024 bytes"},
+		// A few hundred bytes of gzip unpack into a quarter of a megabyte.
+		{"gzip bomb", "/", gzipped(strings.Repeat("a", 256<<10)), true, http.StatusRequestEntityTooLarge, "body exceeds 4096 bytes"},
+		{"url length", "/", strings.NewReader("https://example.com/" + strings.Repeat("a", 64)), false, http.StatusRequestEntityTooLarge, "url of 84 bytes exceeds the limit of 64"},
+		{"batch size", "/api/shorten/batch", strings.NewReader(`[{"correlation_id":"1","original_url":"https://a.example"},{"correlation_id":"2","original_url":"https://b.example"},{"correlation_id":"3","original_url":"https://c.example"}]`), false, http.StatusRequestEntityTooLarge, "batch of 3 urls exceeds the limit of 2"},
+		{"batch url length", "/api/shorten/batch", strings.NewReader(`[{"correlation_id":"1","original_url":"https://example.com/` + strings.Repeat("a", 64) + `"}]`), false, http.StatusRequestEntityTooLarge, "url of 84 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, tt.body)
+			if tt.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, rec.Body.String())
+			if tt.detail == "" {
+				return
+			}
+
+			var p Problem
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+			assert.Equal(t, "too_large", p.Code)
+			assert.Contains(t, p.Detail, tt.detail)
+		})
+	}
+}
+
+func TestServer_Auth_Authorization(t *testing.T) {
+	mockUC := &mockUsecase{APIKeys: map[string]entities.APIKey{
+		"shk_rw": {ID: "k1", UserID: "user-1"},
+		"shk_ro": {ID: "k2", UserID: "user-2", ReadOnly: true},
+	}}
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+		keys:   auth.NewStaticKeyring([]byte("secret")),
+	}
+	token, claims, err := server.keys.IssueAnonymous()
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	whoami := func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("userID"))
+	}
+	router.GET("/whoami", server.auth, whoami)
+	router.POST("/whoami", server.auth, whoami)
+	router.GET("/api/user/keys", server.authRequired, server.withoutAPIKey(whoami))
+
+	do := func(method, path, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name          string
+		method, path  string
+		authorization string
+		wantStatus    int
+		wantUser      string
+	}{
+		{"bearer jwt", http.MethodPost, "/whoami", "Bearer " + token, http.StatusOK, claims.UserID},
+		{"scheme is case-insensitive", http.MethodGet, "/whoami", "bearer " + token, http.StatusOK, claims.UserID},
+		{"api key", http.MethodPost, "/whoami", "Bearer shk_rw", http.StatusOK, "user-1"},
+		{"read-only key reads", http.MethodGet, "/whoami", "Bearer shk_ro", http.StatusOK, "user-2"},
+		{"read-only key writes", http.MethodPost, "/whoami", "Bearer shk_ro", http.StatusForbidden, ""},
+		{"unknown api key", http.MethodGet, "/whoami", "Bearer shk_unknown", http.StatusUnauthorized, ""},
+		{"invalid jwt", http.MethodGet, "/whoami", "Bearer not-a-token", http.StatusUnauthorized, ""},
+		{"other scheme", http.MethodGet, "/whoami", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, ""},
+		{"keys need the user", http.MethodGet, "/api/user/keys", "Bearer shk_rw", http.StatusForbidden, ""},
+		{"keys with jwt", http.MethodGet, "/api/user/keys", "Bearer " + token, http.StatusOK, claims.UserID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.path, tt.authorization)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantUser != "" {
+				assert.Equal(t, tt.wantUser, rec.Body.String())
+			}
+			// Explicit credentials never get an anonymous cookie instead.
+			assert.Empty(t, rec.Result().Cookies())
+		})
+	}
+}
+
+func TestServer_OIDC(t *testing.T) {
+	provider, idp, err := oidctest.NewServer("shortener", "client-secret")
+	require.NoError(t, err)
+	defer idp.Close()
+	provider.SignInAs("alice", "alice@example.com")
+
+	var logins []string
+	mockUC := &mockUsecase{
+		LoginExternalFunc: func(ctx context.Context, currentUserID, issuer, subject, email string) (entities.Identity, error) {
+			logins = append(logins, currentUserID+" "+issuer+" "+subject+" "+email)
+			return entities.Identity{Issuer: issuer, Subject: subject, UserID: "user-alice"}, nil
+		},
+	}
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+		keys:   auth.NewStaticKeyring([]byte("secret")),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/auth/oidc/login", server.OIDCLogin)
+	router.GET("/api/auth/oidc/callback", server.OIDCCallback)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Без настроенного провайдера маршруты отвечают 404.
+	resp, err := http.Get(ts.URL + "/api/auth/oidc/login")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	server.cfg = &config.Model{
+		HTTP: config.HTTPConfig{ReturningURL: ts.URL + "/"},
+		Auth: config.AuthConfig{OIDC: config.OIDCConfig{
+			Issuer:       provider.Issuer(),
+			ClientID:     "shortener",
+			ClientSecret: "client-secret",
+			AfterLogin:   ts.URL + "/done",
+		}},
+	}
+	server.oidc, err = auth.NewOIDC(server.cfg)
+	require.NoError(t, err)
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	browser := &http.Client{Jar: jar, CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+		if req.URL.Path == "/done" {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}}
+	anonymous, _, err := server.keys.IssueAnonymous()
+	require.NoError(t, err)
+	base, _ := url.Parse(ts.URL)
+	jar.SetCookies(base, []*http.Cookie{{Name: "auth", Value: anonymous, Path: "/"}})
+	anonymousClaims, err := server.keys.Parse(anonymous)
+	require.NoError(t, err)
+
+	resp, err = browser.Get(ts.URL + "/api/auth/oidc/login")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, ts.URL+"/done", resp.Header.Get("Location"))
+
+	var token string
+	for _, c := range jar.Cookies(base) {
+		if c.Name == "auth" {
+			token = c.Value
+		}
+	}
+	claims, err := server.keys.Parse(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-alice", claims.UserID)
+	assert.Equal(t, []string{anonymousClaims.UserID + " " + provider.Issuer() + " alice alice@example.com"}, logins)
+
+	// A callback without the login state of the browser is refused.
+	resp, err = http.Get(ts.URL + "/api/auth/oidc/callback?code=x&state=y")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	var p Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+	assert.Equal(t, "sso_failed", p.Code)
+}
+
+func TestServer_UpdateURLAndWorkspaceURLs(t *testing.T) {
+	var listed entities.URLQuery
+	mockUC := &mockUsecase{
+		UpdateURLFunc: func(ctx context.Context, shortURL, userID, originalURL, workspaceID string, expiresAt *time.Time) (entities.Item, error) {
+			if shortURL != "abc" {
+				return entities.Item{}, usecase.ErrViewer
+			}
+			return entities.Item{ShortURL: shortURL, OriginalURL: originalURL, WorkspaceID: workspaceID}, nil
 		},
-		{
-			name:     "valid url with query params",
-			url:      "https://example.com?param=value",
-			expected: true,
+		GetUsersUrlsFunc: func(ctx context.Context, userID string, q entities.URLQuery) (entities.URLPage, error) {
+			listed = q
+			return entities.URLPage{}, nil
 		},
 	}
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+		cfg:    &config.Model{HTTP: config.HTTPConfig{ReturningURL: "http://localhost:8080/"}},
+	}
 
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PATCH("/api/user/urls/:id", server.UpdateURL)
+	router.GET("/api/user/workspaces/:id/urls", server.GetWorkspaceURLs)
+
+	tests := []struct {
+		name, id, body string
+		status         int
+		code           string
+	}{
+		{"edits the link", "abc", `{"original_url":"https://example.com/new","workspace_id":"ws"}`, http.StatusOK, ""},
+		{"nothing to change", "abc", `{}`, http.StatusBadRequest, "invalid_body"},
+		{"invalid url", "abc", `{"original_url":"ftp://example.com"}`, http.StatusBadRequest, "invalid_url"},
+		{"expiry in the past", "abc", `{"expires_at":"2020-01-01T00:00:00Z"}`, http.StatusBadRequest, "invalid_body"},
+		{"viewer", "other", `{"original_url":"https://example.com/new"}`, http.StatusForbidden, "forbidden"},
+	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := validateURL(tt.url)
-			assert.Equal(t, tt.expected, result, "URL: %s", tt.url)
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "/api/user/urls/"+tt.id, strings.NewReader(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.code != "" {
+				var p Problem
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+				assert.Equal(t, tt.code, p.Code)
+				return
+			}
+
+			var item entities.Item
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &item))
+			assert.Equal(t, "http://localhost:8080/abc", item.ShortURL)
+			assert.Equal(t, "ws", item.WorkspaceID)
 		})
 	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/workspaces/ws/urls?sort=clicks", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "ws", listed.Workspace)
+	assert.Equal(t, entities.SortClicks, listed.Sort)
+}
+
+func TestServer_Admin(t *testing.T) {
+	var searched entities.LinkQuery
+	mockUC := &mockUsecase{
+		SearchLinksFunc: func(ctx context.Context, adminID string, q entities.LinkQuery) (entities.URLPage, error) {
+			if adminID != "admin" {
+				return entities.URLPage{}, usecase.ErrNotAdmin
+			}
+			searched = q
+			return entities.URLPage{
+				Items: []entities.Item{{ShortURL: "abc", OriginalURL: "https://phish.example/login", UserID: "u1"}},
+				Next:  "next-cursor",
+			}, nil
+		},
+		DisableURLFunc: func(ctx context.Context, adminID, shortURL, reason string) (entities.Item, error) {
+			now := time.Now()
+			return entities.Item{ShortURL: shortURL, UserID: "u1", DisabledReason: reason, DisabledAt: &now}, nil
+		},
+	}
+	server := &Server{
+		logger: zap.NewNop(),
+		uc:     mockUC,
+		cfg:    &config.Model{HTTP: config.HTTPConfig{ReturningURL: "http://localhost:8080/"}},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	admin := router.Group("/api/admin").Use(func(c *gin.Context) {
+		c.Set("userID", c.GetHeader("X-User"))
+		if key := c.GetHeader("X-Key"); key != "" {
+			c.Set(apiKeyKey, key)
+		}
+	})
+	admin.GET("/urls", server.withoutAPIKey(server.SearchLinks))
+	admin.POST("/urls/:id/disable", server.withoutAPIKey(server.DisableURL))
+
+	do := func(method, target, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-User", user)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/api/admin/urls?domain=phish.example&owner=u1&disabled=false&limit=1", "admin", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "phish.example", searched.Domain)
+	assert.Equal(t, "u1", searched.Owner)
+	require.NotNil(t, searched.Disabled)
+	assert.False(t, *searched.Disabled)
+	assert.Contains(t, rec.Header().Get("Link"), "cursor=next-cursor")
+
+	var urls []map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &urls))
+	require.Len(t, urls, 1)
+	assert.Equal(t, "http://localhost:8080/abc", urls[0]["short_url"])
+	assert.Equal(t, "u1", urls[0]["user_id"])
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/admin/urls?disabled=maybe", "admin", "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/admin/urls", "someone", "").Code)
+
+	rec = do(http.MethodPost, "/api/admin/urls/abc/disable", "admin", `{"reason":"phishing"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"disabled_reason":"phishing"`)
+
+	// Moderation is not available to API keys, even those of admins.
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/urls/abc/disable", strings.NewReader(`{"reason":"phishing"}`))
+	req.Header.Set("X-User", "admin")
+	req.Header.Set("X-Key", "key-1")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestServer_Audit(t *testing.T) {
+	var (
+		queried entities.AuditQuery
+		request entities.RequestInfo
+	)
+	mockUC := &mockUsecase{
+		QueryAuditFunc: func(ctx context.Context, adminID string, q entities.AuditQuery) (entities.AuditPage, error) {
+			queried, request = q, entities.RequestInfoFrom(ctx)
+			return entities.AuditPage{
+				Entries: []entities.AuditEntry{{ID: "1", Action: entities.AuditLinkDeleted, ActorID: "u1", Target: "abc"}},
+				Next:    "next-cursor",
+			}, nil
+		},
+	}
+	server := &Server{logger: zap.NewNop(), uc: mockUC, cfg: &config.Model{}}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(server.requestInfo)
+	router.GET("/api/admin/audit", server.GetAudit)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/audit?actor=u1&action=link.deleted&target=abc&since=2026-01-01T00:00:00Z&limit=10", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "u1", queried.ActorID)
+	assert.Equal(t, entities.AuditLinkDeleted, queried.Action)
+	assert.Equal(t, "abc", queried.Target)
+	require.NotNil(t, queried.Since)
+	assert.Nil(t, queried.Until)
+	assert.Equal(t, 10, queried.Limit)
+	assert.Contains(t, rec.Header().Get("Link"), "cursor=next-cursor")
+
+	// The request is identified in the response and in the audit log.
+	assert.Equal(t, "192.0.2.1", request.IP)
+	assert.NotEmpty(t, request.RequestID)
+	assert.Equal(t, request.RequestID, rec.Header().Get(requestIDHeader))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/audit", nil)
+	req.Header.Set(requestIDHeader, "proxy-id-1")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "proxy-id-1", request.RequestID)
+	assert.Equal(t, "proxy-id-1", rec.Header().Get(requestIDHeader))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/audit", nil)
+	req.Header.Set(requestIDHeader, "bad id")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.NotEqual(t, "bad id", rec.Header().Get(requestIDHeader))
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/admin/audit?until=yesterday", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
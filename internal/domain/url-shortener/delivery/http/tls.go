@@ -0,0 +1,176 @@
+package http
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultCertReload = 30 * time.Second
+
+// modernCipherSuites are the TLS 1.2 suites with forward secrecy and AEAD.
+// TLS 1.3 suites are not configurable and are always enabled.
+var modernCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// certReloader serves the certificate from disk and picks up a renewed
+// key pair without a restart. A pair that fails to load is logged and the
+// previous certificate keeps being served.
+type certReloader struct {
+	log      *zap.Logger
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func newCertReloader(l *zap.Logger, certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		log:      l,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// reload loads the key pair if either file changed since the last load and
+// reports whether the certificate was replaced.
+func (r *certReloader) reload() (bool, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && certInfo.ModTime().Equal(r.certMod) && keyInfo.ModTime().Equal(r.keyMod)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.cert, r.certMod, r.keyMod = &cert, certInfo.ModTime(), keyInfo.ModTime()
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// watch polls the files until stop is closed.
+func (r *certReloader) watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				r.log.Error("failed to reload TLS certificate", zap.Error(err))
+				continue
+			}
+			if reloaded {
+				r.log.Info("TLS certificate reloaded", zap.String("cert", r.certFile))
+			}
+		}
+	}
+}
+
+// newTLSConfig builds the server TLS config, or returns nil when no
+// certificate is configured and the server should speak plain HTTP.
+func (s *Server) newTLSConfig() (*tls.Config, *certReloader, error) {
+	cfg := s.cfg.HTTP.TLS
+	if cfg.CertFile == "" && cfg.KeyFile == "" {
+		return nil, nil, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, nil, fmt.Errorf("both TLS certificate and key must be set")
+	}
+
+	minVersion, err := parseTLSVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{MinVersion: minVersion}
+	switch cfg.CipherPolicy {
+	case "", "default":
+	case "modern":
+		tlsConfig.CipherSuites = modernCipherSuites
+	default:
+		return nil, nil, fmt.Errorf("unknown TLS cipher policy %q", cfg.CipherPolicy)
+	}
+
+	reloader, err := newCertReloader(s.logger.Named("tls"), cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig.GetCertificate = reloader.GetCertificate
+
+	return tlsConfig, reloader, nil
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS min version %q", version)
+	}
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same path on the HTTPS
+// listener. 308 keeps the method and body of POST requests.
+func (s *Server) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if _, port, err := net.SplitHostPort(s.cfg.HTTP.Host); err == nil && port != "443" {
+		host = net.JoinHostPort(host, port)
+	} else if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+		host = "[" + host + "]"
+	}
+
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateWebhookReq struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+func (s *Server) CreateWebhook(c *gin.Context) {
+	var req CreateWebhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	wh, err := s.uc.CreateWebhook(c.Request.Context(), c.GetString("userID"), req.URL, req.Events)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, wh)
+}
+
+func (s *Server) GetWebhooks(c *gin.Context) {
+	hooks, err := s.uc.GetWebhooks(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+func (s *Server) DeleteWebhook(c *gin.Context) {
+	err := s.uc.DeleteWebhook(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) GetWebhookDeliveries(c *gin.Context) {
+	deliveries, err := s.uc.GetWebhookDeliveries(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
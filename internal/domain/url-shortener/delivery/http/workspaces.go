@@ -0,0 +1,127 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type CreateWorkspaceReq struct {
+	Name string `json:"name"`
+}
+
+type SetMemberReq struct {
+	Role string `json:"role"`
+}
+
+func (s *Server) CreateWorkspace(c *gin.Context) {
+	var req CreateWorkspaceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	ws, err := s.uc.CreateWorkspace(c.Request.Context(), c.GetString("userID"), req.Name)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, ws)
+}
+
+func (s *Server) GetWorkspaces(c *gin.Context) {
+	workspaces, err := s.uc.GetWorkspaces(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspaces)
+}
+
+func (s *Server) GetWorkspaceMembers(c *gin.Context) {
+	members, err := s.uc.GetMembers(c.Request.Context(), c.Param("id"), c.GetString("userID"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+func (s *Server) SetWorkspaceMember(c *gin.Context) {
+	var req SetMemberReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	m, err := s.uc.SetMember(c.Request.Context(), c.Param("id"), c.GetString("userID"), c.Param("user"), req.Role)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, m)
+}
+
+func (s *Server) RemoveWorkspaceMember(c *gin.Context) {
+	err := s.uc.RemoveMember(c.Request.Context(), c.Param("id"), c.GetString("userID"), c.Param("user"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateWorkspaceURL shortens a URL as a link of the workspace; it answers
+// like POST /api/shorten.
+func (s *Server) CreateWorkspaceURL(c *gin.Context) {
+	var req CreateShortURLByBodyReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		s.problem(c, bodyError(err))
+		return
+	}
+
+	url := strings.TrimSpace(req.URL)
+	if err := s.checkURLLength(url); err != nil {
+		s.problem(c, err)
+		return
+	}
+	if !usecase.ValidURL(url) {
+		s.problem(c, usecase.ErrInvalidURL)
+		return
+	}
+
+	shortURL, conflict, err := s.uc.CreateWorkspaceURL(c.Request.Context(), url, c.GetString("userID"), c.Param("id"))
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if conflict {
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, CreateShortURLByBodyResp{
+		ShortURL: s.cfg.HTTP.ReturningURL + shortURL,
+	})
+}
+
+// GetWorkspaceURLs lists the links of the workspace with the parameters of
+// GET /api/user/urls.
+func (s *Server) GetWorkspaceURLs(c *gin.Context) {
+	q, err := urlQuery(c)
+	if err != nil {
+		s.problem(c, err)
+		return
+	}
+
+	q.Workspace = c.Param("id")
+	s.writeURLPage(c, q)
+}
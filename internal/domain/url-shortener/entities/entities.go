@@ -1,11 +1,106 @@
 package entities
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrNotFound is returned by repositories when the requested record does not
+// exist, as opposed to a storage failure.
+var ErrNotFound = errors.New("not found")
+
+// ErrDisabled is returned by Get for links a moderator disabled.
+var ErrDisabled = errors.New("disabled")
+
+// ErrExpired is returned by Get for links whose expiry passed.
+var ErrExpired = errors.New("expired")
+
+// ErrLastOwner is returned by SetMember and DeleteMember when the change
+// would leave a workspace without owners.
+var ErrLastOwner = errors.New("last owner")
+
+// ErrAlreadyExists is returned by repositories when a unique value, like an
+// account email, is taken.
+var ErrAlreadyExists = errors.New("already exists")
+
 type CtxKeyString string
 
 type Item struct {
-	UUID        string `json:"uuid,omitempty"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	UUID        string     `json:"uuid,omitempty"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   time.Time  `json:"created_at,omitzero"`
+	Clicks      int64      `json:"clicks"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	IsDeleted   bool       `json:"is_deleted,omitempty"`
+	// UserID created the link. Links of a workspace are managed by its
+	// members instead.
+	UserID      string `json:"-"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	// DisabledReason is set by the moderator who disabled the link.
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+}
+
+// Expired reports whether the link has an expiry that passed by now.
+func (i Item) Expired(now time.Time) bool {
+	return i.ExpiresAt != nil && !i.ExpiresAt.After(now)
+}
+
+const (
+	SortCreatedAt = "created_at"
+	SortClicks    = "clicks"
+)
+
+// URLQuery selects one page of a user's links.
+type URLQuery struct {
+	// Workspace lists the links of the workspace instead of the user's own.
+	Workspace string
+	// All lists every link at once, ignoring Limit, as the listing did
+	// before it was paginated.
+	All    bool
+	Limit  int
+	Sort   string
+	Desc   bool
+	Search string
+	// Deleted and Expired keep only links in the given state when set.
+	Deleted *bool
+	Expired *bool
+	// Cursor is the opaque token handed to clients; the use-case layer
+	// decodes it into After for the repositories.
+	Cursor string
+	After  *URLCursor
+}
+
+// URLCursor is the keyset position of the last link of a page: the sort
+// value with the short URL breaking ties.
+type URLCursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	CreatedAt time.Time `json:"c,omitzero"`
+	Clicks    int64     `json:"n,omitempty"`
+	ShortURL  string    `json:"k"`
+}
+
+// LinkQuery selects links of all users for moderators, newest first.
+type LinkQuery struct {
+	// Search matches the original URL, Domain its host and subdomains.
+	Search   string
+	Domain   string
+	Owner    string
+	Disabled *bool
+	Limit    int
+	Cursor   string
+	After    *URLCursor
+}
+
+type URLPage struct {
+	Items []Item
+	// Next is the cursor of the following page, empty on the last one.
+	Next string
 }
 
 type BatchItem struct {
@@ -13,3 +108,253 @@ type BatchItem struct {
 	OriginalURL   string `json:"original_url,omitempty"`
 	ShortURL      string `json:"short_url"`
 }
+
+type ClickEvent struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	UserID      string    `json:"-"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+const (
+	EventLinkCreated = "link.created"
+	EventLinkDeleted = "link.deleted"
+	EventLinkClicked = "link.clicked"
+)
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Account is a registered user. Its ID is the userID links are owned by.
+type Account struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash []byte    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// UserMove counts what moved from an anonymous identity to an account.
+type UserMove struct {
+	URLs     int64
+	Webhooks int64
+	APIKeys  int64
+}
+
+// Identity maps the subject of an external OpenID Connect provider to the
+// user it signs in as.
+type Identity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// CanEdit reports whether members with role may create, edit and delete the
+// links of the workspace; viewers only list them.
+func CanEdit(role string) bool {
+	return role == RoleOwner || role == RoleEditor
+}
+
+// Workspace owns links shared by its members. Role is the one of the user the
+// workspace was listed for.
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Member struct {
+	WorkspaceID string    `json:"-"`
+	UserID      string    `json:"user_id"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Actions recorded in the audit log.
+const (
+	AuditLinkCreated  = "link.created"
+	AuditLinkUpdated  = "link.updated"
+	AuditLinkDeleted  = "link.deleted"
+	AuditLinkDisabled = "link.disabled"
+	AuditLinkEnabled  = "link.enabled"
+)
+
+// AuditEntry records an action of ActorID on Target, a short URL, with the
+// fields of the link it changed as they were Before and After it. Entries
+// are only ever appended.
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	Action    string          `json:"action"`
+	ActorID   string          `json:"actor_id"`
+	Target    string          `json:"target"`
+	Reason    string          `json:"reason,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditQuery selects audit entries, newest first. Empty fields match any
+// entry; Since is inclusive and Until exclusive.
+type AuditQuery struct {
+	ActorID string
+	Action  string
+	Target  string
+	Since   *time.Time
+	Until   *time.Time
+	Limit   int
+	Cursor  string
+	// After is the decoded Cursor, set by the usecase for repositories.
+	After *AuditCursor
+}
+
+// AuditCursor is the keyset position of the last entry of a page.
+type AuditCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+type AuditPage struct {
+	Entries []AuditEntry
+	Next    string
+}
+
+// RequestInfo describes the request behind a change for the audit log.
+type RequestInfo struct {
+	IP        string
+	RequestID string
+}
+
+const requestInfoKey CtxKeyString = "requestInfo"
+
+// WithRequestInfo returns a copy of ctx carrying info.
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey, info)
+}
+
+// RequestInfoFrom returns the RequestInfo of ctx, zero outside of requests.
+func RequestInfoFrom(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey).(RequestInfo)
+	return info
+}
+
+// APIKey lets a server-to-server client act as UserID. Only a hash of the
+// key is stored; Key itself is returned once, when the key is created.
+type APIKey struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"-"`
+	ReadOnly  bool      `json:"read_only"`
+	CreatedAt time.Time `json:"created_at"`
+	Key       string    `json:"key,omitempty"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type WebhookDelivery struct {
+	ID            string          `json:"id"`
+	WebhookID     string          `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+	URL           string          `json:"-"`
+	Secret        string          `json:"-"`
+}
+
+// RateLimit is a token bucket: up to Burst requests at once, refilled at Rate
+// requests per second. A zero Rate or Burst disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Decision describes the bucket holding tokens after a request that was let
+// through or not.
+func (l RateLimit) Decision(tokens float64, allowed bool) RateDecision {
+	d := RateDecision{
+		Allowed:   allowed,
+		Limit:     l.Burst,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     time.Duration((float64(l.Burst) - tokens) / l.Rate * float64(time.Second)),
+	}
+	if !allowed {
+		d.RetryAfter = time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+	}
+
+	return d
+}
+
+// RateDecision is the outcome of taking a token. Limit is zero when the
+// request was let through without consulting a bucket.
+type RateDecision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the wait for the next token of a rejected request.
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+}
+
+// Restricts reports whether d is more restrictive than o: it rejects where o
+// allows, or leaves fewer tokens.
+func (d RateDecision) Restricts(o RateDecision) bool {
+	return o.Allowed && !d.Allowed || d.Allowed == o.Allowed && d.Remaining < o.Remaining
+}
+
+// DeleteItem is one link deletion requested by its owner.
+type DeleteItem struct {
+	ShortURL string
+	UserID   string
+}
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+type DeletionJob struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Deleted    int        `json:"deleted"`
+	Skipped    int        `json:"skipped"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+)
+
+// accountStore keeps accounts and external identities in memory, indexed by
+// id and email or by issuer and subject. Like webhooks they are not written
+// to the recovery file.
+type accountStore struct {
+	mu         sync.RWMutex
+	byID       map[string]entities.Account
+	byEmail    map[string]string
+	identities map[[2]string]entities.Identity
+}
+
+func newAccountStore() *accountStore {
+	return &accountStore{
+		byID:       make(map[string]entities.Account),
+		byEmail:    make(map[string]string),
+		identities: make(map[[2]string]entities.Identity),
+	}
+}
+
+func (r *Repository) CreateAccount(_ context.Context, account entities.Account) error {
+	r.accounts.mu.Lock()
+	defer r.accounts.mu.Unlock()
+
+	if _, ok := r.accounts.byEmail[account.Email]; ok {
+		return entities.ErrAlreadyExists
+	}
+
+	r.accounts.byID[account.ID] = account
+	r.accounts.byEmail[account.Email] = account.ID
+	return nil
+}
+
+func (r *Repository) GetAccountByEmail(_ context.Context, email string) (entities.Account, error) {
+	r.accounts.mu.RLock()
+	defer r.accounts.mu.RUnlock()
+
+	id, ok := r.accounts.byEmail[email]
+	if !ok {
+		return entities.Account{}, entities.ErrNotFound
+	}
+
+	return r.accounts.byID[id], nil
+}
+
+func (r *Repository) GetAccountByID(_ context.Context, id string) (entities.Account, error) {
+	r.accounts.mu.RLock()
+	defer r.accounts.mu.RUnlock()
+
+	account, ok := r.accounts.byID[id]
+	if !ok {
+		return entities.Account{}, entities.ErrNotFound
+	}
+
+	return account, nil
+}
+
+func (r *Repository) CreateIdentity(_ context.Context, identity entities.Identity) error {
+	r.accounts.mu.Lock()
+	defer r.accounts.mu.Unlock()
+
+	key := [2]string{identity.Issuer, identity.Subject}
+	if _, ok := r.accounts.identities[key]; ok {
+		return entities.ErrAlreadyExists
+	}
+
+	r.accounts.identities[key] = identity
+	return nil
+}
+
+func (r *Repository) GetIdentity(_ context.Context, issuer, subject string) (entities.Identity, error) {
+	r.accounts.mu.RLock()
+	defer r.accounts.mu.RUnlock()
+
+	identity, ok := r.accounts.identities[[2]string{issuer, subject}]
+	if !ok {
+		return entities.Identity{}, entities.ErrNotFound
+	}
+
+	return identity, nil
+}
+
+func (r *Repository) GetIdentityByUserID(_ context.Context, userID string) (entities.Identity, error) {
+	r.accounts.mu.RLock()
+	defer r.accounts.mu.RUnlock()
+
+	for _, identity := range r.accounts.identities {
+		if identity.UserID == userID {
+			return identity, nil
+		}
+	}
+
+	return entities.Identity{}, entities.ErrNotFound
+}
+
+// MoveUser hands the links, webhooks and API keys of from over to to.
+func (r *Repository) MoveUser(_ context.Context, from, to string) (entities.UserMove, error) {
+	return entities.UserMove{
+		URLs:     r.moveURLs(from, to),
+		Webhooks: r.moveWebhooks(from, to),
+		APIKeys:  r.moveAPIKeys(from, to),
+	}, nil
+}
+
+func (r *Repository) moveURLs(from, to string) int64 {
+	var moved int64
+
+	r.db.Range(func(key, v any) bool {
+		for {
+			value, ok := v.(Value)
+			if !ok || value.UserID != from {
+				return true
+			}
+
+			value.UserID = to
+			if r.db.CompareAndSwap(key, v, value) {
+				moved++
+				return true
+			}
+
+			if v, ok = r.db.Load(key); !ok {
+				return true
+			}
+		}
+	})
+
+	return moved
+}
+
+func (r *Repository) moveWebhooks(from, to string) int64 {
+	r.webhooks.mu.Lock()
+	defer r.webhooks.mu.Unlock()
+
+	var moved int64
+	for id, wh := range r.webhooks.hooks {
+		if wh.UserID == from {
+			wh.UserID = to
+			r.webhooks.hooks[id] = wh
+			moved++
+		}
+	}
+
+	return moved
+}
+
+func (r *Repository) moveAPIKeys(from, to string) int64 {
+	r.apiKeys.mu.Lock()
+	defer r.apiKeys.mu.Unlock()
+
+	var moved int64
+	for id, key := range r.apiKeys.keys {
+		if key.UserID == from {
+			key.UserID = to
+			r.apiKeys.keys[id] = key
+			moved++
+		}
+	}
+
+	return moved
+}
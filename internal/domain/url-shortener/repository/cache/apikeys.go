@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+)
+
+// apiKeyStore keeps API keys in memory. Like webhooks they are not written to
+// the recovery file.
+type apiKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]entities.APIKey
+}
+
+func newAPIKeyStore() *apiKeyStore {
+	return &apiKeyStore{keys: make(map[string]entities.APIKey)}
+}
+
+func (r *Repository) CreateAPIKey(_ context.Context, key entities.APIKey) error {
+	r.apiKeys.mu.Lock()
+	defer r.apiKeys.mu.Unlock()
+
+	key.Key = ""
+	r.apiKeys.keys[key.ID] = key
+	return nil
+}
+
+func (r *Repository) GetAPIKeys(_ context.Context, userID string) ([]entities.APIKey, error) {
+	r.apiKeys.mu.RLock()
+	defer r.apiKeys.mu.RUnlock()
+
+	keys := make([]entities.APIKey, 0, 4)
+	for _, key := range r.apiKeys.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (r *Repository) GetAPIKeyByHash(_ context.Context, hash string) (entities.APIKey, error) {
+	r.apiKeys.mu.RLock()
+	defer r.apiKeys.mu.RUnlock()
+
+	for _, key := range r.apiKeys.keys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+
+	return entities.APIKey{}, entities.ErrNotFound
+}
+
+func (r *Repository) DeleteAPIKey(_ context.Context, id, userID string) (bool, error) {
+	r.apiKeys.mu.Lock()
+	defer r.apiKeys.mu.Unlock()
+
+	key, ok := r.apiKeys.keys[id]
+	if !ok || key.UserID != userID {
+		return false, nil
+	}
+
+	delete(r.apiKeys.keys, id)
+	return true, nil
+}
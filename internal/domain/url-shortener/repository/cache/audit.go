@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+)
+
+// auditStore keeps the audit entries in memory, in the order they were
+// appended, and mirrors them to an append-only file of JSON lines when a path
+// is configured.
+type auditStore struct {
+	mu   sync.RWMutex
+	path string
+	file *os.File
+	// torn is set when the file does not end with a complete line, which the
+	// next write must not continue.
+	torn    bool
+	entries []entities.AuditEntry
+}
+
+func newAuditStore(path string) *auditStore {
+	return &auditStore{path: path}
+}
+
+// load reads the entries written by previous runs. A line torn by a crash
+// is skipped rather than failing the start.
+func (s *auditStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var e entities.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.ID == "" {
+			continue
+		}
+		s.entries = append(s.entries, e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	last := make([]byte, 1)
+	if stat, err := file.Stat(); err == nil && stat.Size() > 0 {
+		if _, err := file.ReadAt(last, stat.Size()-1); err == nil {
+			s.torn = last[0] != '\n'
+		}
+	}
+
+	return nil
+}
+
+func (s *auditStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// AppendAudit writes the entries to the file before keeping them, so that a
+// failed write records nothing.
+func (r *Repository) AppendAudit(_ context.Context, entries []entities.AuditEntry) error {
+	s := r.audit
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path != "" {
+		var buf bytes.Buffer
+		if s.torn {
+			buf.WriteByte('\n')
+		}
+		encoder := json.NewEncoder(&buf)
+		for _, e := range entries {
+			if err := encoder.Encode(e); err != nil {
+				return err
+			}
+		}
+
+		if s.file == nil {
+			file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return err
+			}
+			s.file = file
+		}
+		if _, err := s.file.Write(buf.Bytes()); err != nil {
+			s.torn = true
+			return err
+		}
+		s.torn = false
+	}
+
+	s.entries = append(s.entries, entries...)
+	return nil
+}
+
+// QueryAudit returns the entries matching q, newest first.
+func (r *Repository) QueryAudit(_ context.Context, q entities.AuditQuery) ([]entities.AuditEntry, error) {
+	s := r.audit
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]entities.AuditEntry, 0, 8)
+	for _, e := range s.entries {
+		switch {
+		case q.ActorID != "" && e.ActorID != q.ActorID:
+		case q.Action != "" && e.Action != q.Action:
+		case q.Target != "" && e.Target != q.Target:
+		case q.Since != nil && e.CreatedAt.Before(*q.Since):
+		case q.Until != nil && !e.CreatedAt.Before(*q.Until):
+		case q.After != nil && compareAudit(e, entities.AuditEntry{CreatedAt: q.After.CreatedAt, ID: q.After.ID}) >= 0:
+		default:
+			entries = append(entries, e)
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b entities.AuditEntry) int {
+		return compareAudit(b, a)
+	})
+
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+
+	return entries, nil
+}
+
+// compareAudit orders entries by time, then by id.
+func compareAudit(a, b entities.AuditEntry) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.ID, b.ID)
+}
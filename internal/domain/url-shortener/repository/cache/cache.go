@@ -1,54 +1,159 @@
 package cache
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/MV7VM/url-shortener/internal/config"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
 )
 
 type Repository struct {
-	db  *sync.Map
-	cfg *config.Model
+	db         *sync.Map
+	cfg        *config.Model
+	webhooks   *webhookStore
+	apiKeys    *apiKeyStore
+	accounts   *accountStore
+	workspaces *workspaceStore
+	audit      *auditStore
 }
 
 func NewRepository(cfg *config.Model) *Repository {
 	return &Repository{
-		db:  new(sync.Map),
-		cfg: cfg,
+		db:         new(sync.Map),
+		cfg:        cfg,
+		webhooks:   newWebhookStore(),
+		apiKeys:    newAPIKeyStore(),
+		accounts:   newAccountStore(),
+		workspaces: newWorkspaceStore(),
+		audit:      newAuditStore(cfg.Repo.AuditFilePath),
 	}
 }
 
 type Value struct {
-	Value  string
-	UserID string
+	Value       string
+	UserID      string
+	WorkspaceID string
+	IsDeleted   bool
+	CreatedAt   time.Time
+	Clicks      int64
+	ExpiresAt   *time.Time
+	// DisabledAt is set while a moderator keeps the link disabled.
+	DisabledAt     *time.Time
+	DisabledReason string
 }
 
 func (r *Repository) OnStart(_ context.Context) error {
-	return r.recovery()
+	if err := r.recovery(); err != nil {
+		return err
+	}
+
+	return r.audit.load()
 }
 
 func (r *Repository) OnStop(_ context.Context) error {
-	return r.save()
+	return errors.Join(r.save(), r.audit.close())
 }
 
-func (r *Repository) Set(_ context.Context, key, value, userID string) (string, error) {
-	r.db.Store(key, Value{Value: value, UserID: userID})
+func (r *Repository) Set(_ context.Context, key, value, userID, workspaceID string) (string, error) {
+	r.db.Store(key, Value{Value: value, UserID: userID, WorkspaceID: workspaceID, CreatedAt: time.Now().UTC()})
 	return key, nil
 }
 
+// AddClicks adds the counted clicks; links that are gone are skipped.
+func (r *Repository) AddClicks(_ context.Context, counts map[string]int64) error {
+	for s, n := range counts {
+		for {
+			v, ok := r.db.Load(s)
+			value, okValue := v.(Value)
+			if !ok || !okValue {
+				break
+			}
+
+			value.Clicks += n
+			if r.db.CompareAndSwap(s, v, value) {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
 func (r *Repository) Get(_ context.Context, s string) (string, bool, error) {
 	url, ok := r.db.Load(s)
 	if _, okString := url.(Value); !okString || !ok || url == nil {
-		return "", false, errors.New("not found")
+		return "", false, entities.ErrNotFound
+	}
+
+	value := url.(Value)
+	if !value.IsDeleted && value.DisabledAt != nil {
+		return "", false, entities.ErrDisabled
+	}
+	if !value.IsDeleted && value.item(s).Expired(time.Now()) {
+		return "", false, entities.ErrExpired
+	}
+
+	return value.Value, value.IsDeleted, nil
+}
+
+func (r *Repository) GetOwner(_ context.Context, s string) (string, error) {
+	url, ok := r.db.Load(s)
+	if _, okValue := url.(Value); !okValue || !ok {
+		return "", entities.ErrNotFound
 	}
 
-	return url.(Value).Value, false, nil
+	return url.(Value).UserID, nil
+}
+
+func (r *Repository) GetLink(_ context.Context, s string) (entities.Item, error) {
+	v, ok := r.db.Load(s)
+	value, okValue := v.(Value)
+	if !ok || !okValue {
+		return entities.Item{}, entities.ErrNotFound
+	}
+
+	return value.item(s), nil
+}
+
+// UpdateLink changes the original URL, the workspace and the expiry of a
+// link.
+func (r *Repository) UpdateLink(_ context.Context, item entities.Item) error {
+	for {
+		v, ok := r.db.Load(item.ShortURL)
+		value, okValue := v.(Value)
+		if !ok || !okValue {
+			return entities.ErrNotFound
+		}
+
+		value.Value, value.WorkspaceID, value.ExpiresAt = item.OriginalURL, item.WorkspaceID, item.ExpiresAt
+		if r.db.CompareAndSwap(item.ShortURL, v, value) {
+			return nil
+		}
+	}
+}
+
+func (v Value) item(shortURL string) entities.Item {
+	return entities.Item{
+		ShortURL:       shortURL,
+		OriginalURL:    v.Value,
+		CreatedAt:      v.CreatedAt,
+		Clicks:         v.Clicks,
+		ExpiresAt:      v.ExpiresAt,
+		IsDeleted:      v.IsDeleted,
+		UserID:         v.UserID,
+		WorkspaceID:    v.WorkspaceID,
+		DisabledReason: v.DisabledReason,
+		DisabledAt:     v.DisabledAt,
+	}
 }
 
 func (r *Repository) GetCount(_ context.Context) (int, error) {
@@ -62,26 +167,115 @@ func (r *Repository) GetCount(_ context.Context) (int, error) {
 	return count, nil
 }
 
-func (r *Repository) GetUsersUrls(ctx context.Context, userID string) ([]entities.Item, error) {
+// GetUsersUrls emulates the keyset pagination of the postgres repository by
+// filtering and sorting all links of the user or of the workspace.
+func (r *Repository) GetUsersUrls(_ context.Context, userID string, q entities.URLQuery) ([]entities.Item, error) {
+	now := time.Now()
+	search := strings.ToLower(q.Search)
+
+	var position *entities.Item
+	if q.After != nil {
+		position = &entities.Item{CreatedAt: q.After.CreatedAt, Clicks: q.After.Clicks, ShortURL: q.After.ShortURL}
+	}
+
 	urls := make([]entities.Item, 0, 8)
 	r.db.Range(func(k, v interface{}) bool {
-		if _, okValue := v.(Value); !okValue {
+		value, okValue := v.(Value)
+		if !okValue || value.WorkspaceID != q.Workspace || (q.Workspace == "" && value.UserID != userID) {
 			return true
 		}
 
-		if v.(Value).UserID != userID {
+		item := value.item(k.(string))
+
+		switch {
+		case search != "" && !strings.Contains(strings.ToLower(item.OriginalURL), search):
+		case q.Deleted != nil && item.IsDeleted != *q.Deleted:
+		case q.Expired != nil && item.Expired(now) != *q.Expired:
+		case position != nil && q.Desc && compareItems(q.Sort, item, *position) >= 0:
+		case position != nil && !q.Desc && compareItems(q.Sort, item, *position) <= 0:
+		default:
+			urls = append(urls, item)
+		}
+
+		return true
+	})
+
+	slices.SortFunc(urls, func(a, b entities.Item) int {
+		if q.Desc {
+			return compareItems(q.Sort, b, a)
+		}
+		return compareItems(q.Sort, a, b)
+	})
+
+	if q.Limit > 0 && len(urls) > q.Limit {
+		urls = urls[:q.Limit]
+	}
+
+	return urls, nil
+}
+
+// compareItems orders links by the sort column and then by short URL, the
+// same way the postgres indexes do.
+func compareItems(sort string, a, b entities.Item) int {
+	var c int
+	if sort == entities.SortClicks {
+		c = cmp.Compare(a.Clicks, b.Clicks)
+	} else {
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.ShortURL, b.ShortURL)
+}
+
+// CanonicalizeURLs rewrites the stored URLs with canonical. The memory store
+// does not deduplicate URLs, so there is nothing to merge; URLs canonical
+// refuses are left as they are.
+func (r *Repository) CanonicalizeURLs(_ context.Context, canonical func(string) (string, error)) (int, error) {
+	var rewritten int
+	r.db.Range(func(key, v any) bool {
+		value, ok := v.(Value)
+		if !ok {
 			return true
 		}
 
-		urls = append(urls, entities.Item{
-			ShortURL:    k.(string),
-			OriginalURL: v.(Value).Value,
-		})
+		url, err := canonical(value.Value)
+		if err != nil || url == value.Value {
+			return true
+		}
 
+		value.Value = url
+		if r.db.CompareAndSwap(key, v, value) {
+			rewritten++
+		}
 		return true
 	})
 
-	return urls, nil
+	return rewritten, nil
+}
+
+// Delete marks the requested links as deleted and returns the ones that
+// changed. Like in postgres, a link is deleted by its creator or, in a
+// workspace, by an owner or editor.
+func (r *Repository) Delete(_ context.Context, items []entities.DeleteItem) ([]entities.DeleteItem, error) {
+	deleted := make([]entities.DeleteItem, 0, len(items))
+
+	for _, item := range items {
+		v, ok := r.db.Load(item.ShortURL)
+		value, okValue := v.(Value)
+		if !ok || !okValue || value.IsDeleted || !r.canEdit(value, item.UserID) {
+			continue
+		}
+
+		value.IsDeleted = true
+		if r.db.CompareAndSwap(item.ShortURL, v, value) {
+			deleted = append(deleted, item)
+		}
+	}
+
+	return deleted, nil
 }
 
 func (r *Repository) recovery() error {
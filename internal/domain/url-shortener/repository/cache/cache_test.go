@@ -1,12 +1,17 @@
 package cache
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,7 +27,7 @@ func TestRepository_Set_Success(t *testing.T) {
 	repo := NewRepository(&config.Model{Repo: config.RepoConfig{CacheConfig: config.CacheConfig{SavingFilePath: "./data.json"}}})
 	ctx := context.Background()
 
-	_, err := repo.Set(ctx, "key1", "https://example.com, ", "")
+	_, err := repo.Set(ctx, "key1", "https://example.com, ", "", "")
 
 	assert.NoError(t, err)
 }
@@ -34,7 +39,7 @@ func TestRepository_Get_Success(t *testing.T) {
 	expectedValue := "https://example.com"
 
 	// Сначала сохраняем значение
-	_, err := repo.Set(ctx, key, expectedValue, "")
+	_, err := repo.Set(ctx, key, expectedValue, "", "")
 	require.NoError(t, err)
 
 	// Затем получаем его
@@ -51,7 +56,7 @@ func TestRepository_Get_NotFound(t *testing.T) {
 
 	result, _, err := repo.Get(ctx, key)
 
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, entities.ErrNotFound)
 	assert.Equal(t, "not found", err.Error())
 	assert.Empty(t, result)
 }
@@ -71,7 +76,7 @@ func TestRepository_Set_EmptyValue(t *testing.T) {
 	repo := NewRepository(&config.Model{Repo: config.RepoConfig{CacheConfig: config.CacheConfig{SavingFilePath: "./data.json"}}})
 	ctx := context.Background()
 
-	_, err := repo.Set(ctx, "key1", "", "")
+	_, err := repo.Set(ctx, "key1", "", "", "")
 	require.NoError(t, err)
 
 	result, _, err := repo.Get(ctx, "key1")
@@ -86,11 +91,11 @@ func TestRepository_Set_Overwrite(t *testing.T) {
 	key := "key1"
 
 	// Сохраняем первое значение
-	_, err1 := repo.Set(ctx, key, "https://example1.com", "")
+	_, err1 := repo.Set(ctx, key, "https://example1.com", "", "")
 	require.NoError(t, err1)
 
 	// Перезаписываем значением
-	_, err2 := repo.Set(ctx, key, "https://example2.com", "")
+	_, err2 := repo.Set(ctx, key, "https://example2.com", "", "")
 	require.NoError(t, err2)
 
 	// Проверяем, что получили новое значение
@@ -105,9 +110,9 @@ func TestRepository_MultipleKeys(t *testing.T) {
 	ctx := context.Background()
 
 	// Сохраняем несколько ключей
-	repo.Set(ctx, "key1", "https://example1.com", "")
-	repo.Set(ctx, "key2", "https://example2.com", "")
-	repo.Set(ctx, "key3", "https://example3.com", "")
+	repo.Set(ctx, "key1", "https://example1.com", "", "")
+	repo.Set(ctx, "key2", "https://example2.com", "", "")
+	repo.Set(ctx, "key3", "https://example3.com", "", "")
 
 	// Получаем все ключи
 	value1, _, err1 := repo.Get(ctx, "key1")
@@ -136,7 +141,7 @@ func TestRepository_ConcurrentAccess(t *testing.T) {
 			defer wg.Done()
 			key := fmt.Sprintf("key%d", id)
 			value := fmt.Sprintf("https://example.com/%d", id)
-			_, err := repo.Set(ctx, key, value, "")
+			_, err := repo.Set(ctx, key, value, "", "")
 			assert.NoError(t, err)
 		}(i)
 	}
@@ -178,7 +183,7 @@ func TestRepository_ConcurrentSet(t *testing.T) {
 		go func(id int) {
 			defer wg.Done()
 			value := fmt.Sprintf("value%d", id)
-			_, err := repo.Set(ctx, key, value, "")
+			_, err := repo.Set(ctx, key, value, "", "")
 			assert.NoError(t, err)
 		}(i)
 	}
@@ -225,7 +230,7 @@ func TestRepository_Get_SpecialCharacters(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := repo.Set(ctx, tc.key, tc.value, "")
+			_, err := repo.Set(ctx, tc.key, tc.value, "", "")
 			require.NoError(t, err)
 
 			result, _, err := repo.Get(ctx, tc.key)
@@ -247,7 +252,7 @@ func TestRepository_Get_LongValue(t *testing.T) {
 	}
 	value := string(longValue)
 
-	_, err := repo.Set(ctx, key, value, "")
+	_, err := repo.Set(ctx, key, value, "", "")
 	require.NoError(t, err)
 
 	result, _, err := repo.Get(ctx, key)
@@ -266,7 +271,7 @@ func TestRepository_Set_Get_MultipleOperations(t *testing.T) {
 		key := fmt.Sprintf("key%d", i)
 		value := fmt.Sprintf("value%d", i)
 
-		_, err := repo.Set(ctx, key, value, "")
+		_, err := repo.Set(ctx, key, value, "", "")
 		require.NoError(t, err)
 
 		result, _, err := repo.Get(ctx, key)
@@ -282,7 +287,7 @@ func TestRepository_Get_AfterSetDelete(t *testing.T) {
 	value := "test_value"
 
 	// Сохраняем значение
-	_, err := repo.Set(ctx, key, value, "")
+	_, err := repo.Set(ctx, key, value, "", "")
 	require.NoError(t, err)
 
 	// Проверяем, что значение есть
@@ -293,10 +298,308 @@ func TestRepository_Get_AfterSetDelete(t *testing.T) {
 	// sync.Map не имеет метода Delete в нашем интерфейсе, но можно проверить
 	// что если мы перезапишем с другим значением, старое исчезнет
 	newValue := "new_value"
-	_, err = repo.Set(ctx, key, newValue, "")
+	_, err = repo.Set(ctx, key, newValue, "", "")
 	require.NoError(t, err)
 
 	result, _, err = repo.Get(ctx, key)
 	require.NoError(t, err)
 	assert.Equal(t, newValue, result)
 }
+
+func TestRepository_Delete_OnlyOwnedLinks(t *testing.T) {
+	repo := NewRepository(&config.Model{Repo: config.RepoConfig{CacheConfig: config.CacheConfig{SavingFilePath: "./data.json"}}})
+	ctx := context.Background()
+
+	_, _ = repo.Set(ctx, "key1", "https://example1.com", "user-1", "")
+	_, _ = repo.Set(ctx, "key2", "https://example2.com", "user-2", "")
+
+	deleted, err := repo.Delete(ctx, []entities.DeleteItem{
+		{ShortURL: "key1", UserID: "user-1"},
+		{ShortURL: "key2", UserID: "user-1"},
+		{ShortURL: "missing", UserID: "user-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []entities.DeleteItem{{ShortURL: "key1", UserID: "user-1"}}, deleted)
+
+	_, isDeleted, err := repo.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, isDeleted)
+
+	_, isDeleted, err = repo.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.False(t, isDeleted)
+
+	deleted, err = repo.Delete(ctx, []entities.DeleteItem{{ShortURL: "key1", UserID: "user-1"}})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+}
+
+func TestRepository_GetUsersUrls_Query(t *testing.T) {
+	repo := NewRepository(&config.Model{Repo: config.RepoConfig{CacheConfig: config.CacheConfig{SavingFilePath: "./data.json"}}})
+	ctx := context.Background()
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	past := base.Add(-time.Hour)
+	repo.db.Store("a", Value{Value: "https://go.dev/doc", UserID: "user-1", CreatedAt: base, Clicks: 5})
+	repo.db.Store("b", Value{Value: "https://example.com/Go", UserID: "user-1", CreatedAt: base.Add(time.Minute), Clicks: 1})
+	repo.db.Store("c", Value{Value: "https://example.com/old", UserID: "user-1", CreatedAt: base.Add(2 * time.Minute), Clicks: 5, IsDeleted: true})
+	repo.db.Store("d", Value{Value: "https://example.com/tmp", UserID: "user-1", CreatedAt: base.Add(3 * time.Minute), ExpiresAt: &past})
+	repo.db.Store("e", Value{Value: "https://example.com/other", UserID: "user-2", CreatedAt: base})
+
+	keys := func(items []entities.Item) []string {
+		out := make([]string, 0, len(items))
+		for _, item := range items {
+			out = append(out, item.ShortURL)
+		}
+		return out
+	}
+
+	items, err := repo.GetUsersUrls(ctx, "user-1", entities.URLQuery{Sort: entities.SortCreatedAt, Desc: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "c", "b", "a"}, keys(items))
+
+	// Equal click counts are ordered by short url.
+	items, err = repo.GetUsersUrls(ctx, "user-1", entities.URLQuery{Sort: entities.SortClicks, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "b"}, keys(items))
+
+	items, err = repo.GetUsersUrls(ctx, "user-1", entities.URLQuery{
+		Sort:  entities.SortClicks,
+		After: &entities.URLCursor{Sort: entities.SortClicks, Clicks: 5, ShortURL: "a"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, keys(items))
+
+	items, err = repo.GetUsersUrls(ctx, "user-1", entities.URLQuery{Search: "go"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys(items))
+
+	deleted, expired := true, true
+	items, err = repo.GetUsersUrls(ctx, "user-1", entities.URLQuery{Deleted: &deleted})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, keys(items))
+
+	items, err = repo.GetUsersUrls(ctx, "user-1", entities.URLQuery{Expired: &expired})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d"}, keys(items))
+}
+
+func TestRepository_WorkspaceLinks(t *testing.T) {
+	repo := NewRepository(&config.Model{})
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, repo.CreateWorkspace(ctx, entities.Workspace{ID: "ws", Name: "Team", CreatedAt: now},
+		entities.Member{WorkspaceID: "ws", UserID: "owner", Role: entities.RoleOwner, CreatedAt: now}))
+	require.NoError(t, repo.SetMember(ctx, entities.Member{WorkspaceID: "ws", UserID: "viewer", Role: entities.RoleViewer}))
+	require.NoError(t, repo.SetMember(ctx, entities.Member{WorkspaceID: "ws", UserID: "editor", Role: entities.RoleEditor}))
+	assert.ErrorIs(t, repo.SetMember(ctx, entities.Member{WorkspaceID: "missing", UserID: "u"}), entities.ErrNotFound)
+
+	_, _ = repo.Set(ctx, "team", "https://team.example", "owner", "ws")
+	_, _ = repo.Set(ctx, "own", "https://own.example", "owner", "")
+
+	// Workspace links are listed apart from the personal ones.
+	items, err := repo.GetUsersUrls(ctx, "owner", entities.URLQuery{})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "own", items[0].ShortURL)
+	items, err = repo.GetUsersUrls(ctx, "", entities.URLQuery{Workspace: "ws"})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "team", items[0].ShortURL)
+	assert.Equal(t, "ws", items[0].WorkspaceID)
+
+	workspaces, err := repo.GetWorkspaces(ctx, "viewer")
+	require.NoError(t, err)
+	require.Len(t, workspaces, 1)
+	assert.Equal(t, entities.RoleViewer, workspaces[0].Role)
+
+	// Viewers and outsiders may not delete, editors may.
+	deleted, err := repo.Delete(ctx, []entities.DeleteItem{
+		{ShortURL: "team", UserID: "viewer"},
+		{ShortURL: "team", UserID: "stranger"},
+		{ShortURL: "own", UserID: "editor"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	deleted, err = repo.Delete(ctx, []entities.DeleteItem{{ShortURL: "team", UserID: "editor"}})
+	require.NoError(t, err)
+	assert.Equal(t, []entities.DeleteItem{{ShortURL: "team", UserID: "editor"}}, deleted)
+}
+
+func TestRepository_KeepsLastOwner(t *testing.T) {
+	repo := NewRepository(&config.Model{})
+	ctx := context.Background()
+
+	require.NoError(t, repo.CreateWorkspace(ctx, entities.Workspace{ID: "ws", Name: "Team"},
+		entities.Member{WorkspaceID: "ws", UserID: "a", Role: entities.RoleOwner}))
+	require.NoError(t, repo.SetMember(ctx, entities.Member{WorkspaceID: "ws", UserID: "b", Role: entities.RoleOwner}))
+
+	// Two owners stepping down at once leave one of them owner.
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, id := range []string{"a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = repo.SetMember(ctx, entities.Member{WorkspaceID: "ws", UserID: id, Role: entities.RoleEditor})
+		}()
+	}
+	wg.Wait()
+	assert.NotEqual(t, errs[0] == nil, errs[1] == nil)
+	assert.ErrorIs(t, cmp.Or(errs[0], errs[1]), entities.ErrLastOwner)
+
+	members, err := repo.GetMembers(ctx, "ws")
+	require.NoError(t, err)
+	owners := 0
+	for _, m := range members {
+		if m.Role == entities.RoleOwner {
+			owners++
+			_, err = repo.DeleteMember(ctx, "ws", m.UserID)
+			assert.ErrorIs(t, err, entities.ErrLastOwner)
+		}
+	}
+	assert.Equal(t, 1, owners)
+
+	deleted, err := repo.DeleteMember(ctx, "ws", "missing")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+func TestRepository_Moderation(t *testing.T) {
+	repo := NewRepository(&config.Model{})
+	ctx := context.Background()
+
+	for key, url := range map[string]string{
+		"a": "https://user:pw@Phish.Example:8443/login",
+		"b": "https://notphish.example/",
+		"c": "https://example.com/?next=https://phish.example",
+	} {
+		_, err := repo.Set(ctx, key, url, "u1", "")
+		require.NoError(t, err)
+	}
+
+	// Only the host counts, not look-alike domains or the rest of the URL.
+	urls, err := repo.SearchLinks(ctx, entities.LinkQuery{Domain: "phish.example"})
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "a", urls[0].ShortURL)
+
+	now := time.Now()
+	changed, err := repo.SetDisabled(ctx, []string{"a", "b", "missing"}, "phishing", &now)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, changed)
+
+	_, _, err = repo.Get(ctx, "a")
+	assert.ErrorIs(t, err, entities.ErrDisabled)
+
+	changed, err = repo.SetDisabled(ctx, []string{"a"}, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, changed)
+
+	item, err := repo.GetLink(ctx, "a")
+	require.NoError(t, err)
+	assert.Nil(t, item.DisabledAt)
+	assert.Empty(t, item.DisabledReason)
+}
+
+func TestRepository_AddClicks(t *testing.T) {
+	repo := NewRepository(&config.Model{Repo: config.RepoConfig{CacheConfig: config.CacheConfig{SavingFilePath: "./data.json"}}})
+	ctx := context.Background()
+
+	_, _ = repo.Set(ctx, "key1", "https://example1.com", "user-1", "")
+	require.NoError(t, repo.AddClicks(ctx, map[string]int64{"key1": 1}))
+	require.NoError(t, repo.AddClicks(ctx, map[string]int64{"key1": 1, "missing": 3}))
+
+	items, err := repo.GetUsersUrls(ctx, "user-1", entities.URLQuery{})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, int64(2), items[0].Clicks)
+}
+
+func TestRateLimiter_TakeToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewRateLimiter()
+	l.now = func() time.Time { return now }
+	limit := entities.RateLimit{Rate: 2, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		d, err := l.TakeToken(ctx, "k", limit)
+		require.NoError(t, err)
+		assert.True(t, d.Allowed)
+		assert.Equal(t, 2-i, d.Remaining)
+	}
+
+	d, err := l.TakeToken(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, d.Reset)
+
+	// Other keys have their own buckets.
+	d, _ = l.TakeToken(ctx, "other", limit)
+	assert.True(t, d.Allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	d, _ = l.TakeToken(ctx, "k", limit)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+
+	// Full buckets are swept and start over at burst.
+	now = now.Add(2 * time.Minute)
+	d, _ = l.TakeToken(ctx, "k", limit)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 2, d.Remaining)
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestRepository_AuditFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg := &config.Model{Repo: config.RepoConfig{CacheConfig: config.CacheConfig{AuditFilePath: path}}}
+	repo := NewRepository(cfg)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	require.NoError(t, repo.AppendAudit(ctx, []entities.AuditEntry{
+		{ID: "1", Action: entities.AuditLinkCreated, ActorID: "u1", Target: "a", CreatedAt: now.Add(-time.Minute)},
+		{ID: "2", Action: entities.AuditLinkDeleted, ActorID: "u2", Target: "a", CreatedAt: now},
+	}))
+	require.NoError(t, repo.audit.close())
+
+	// A line torn by a crash is skipped.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"id":"3","act`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	restored := NewRepository(cfg)
+	require.NoError(t, restored.audit.load())
+
+	entries, err := restored.QueryAudit(ctx, entities.AuditQuery{Target: "a"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "2", entries[0].ID)
+
+	since := now.Add(-time.Second)
+	entries, err = restored.QueryAudit(ctx, entities.AuditQuery{Since: &since})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "u2", entries[0].ActorID)
+
+	entries, err = restored.QueryAudit(ctx, entities.AuditQuery{After: &entities.AuditCursor{CreatedAt: now, ID: "2"}})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "1", entries[0].ID)
+
+	// New entries start on a line of their own.
+	require.NoError(t, restored.AppendAudit(ctx, []entities.AuditEntry{{ID: "4", Target: "b", CreatedAt: now}}))
+	require.NoError(t, restored.audit.close())
+	reloaded := NewRepository(cfg)
+	require.NoError(t, reloaded.audit.load())
+	entries, err = reloaded.QueryAudit(ctx, entities.AuditQuery{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
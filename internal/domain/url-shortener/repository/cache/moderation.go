@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+)
+
+// SearchLinks filters all links for moderators, newest first, the way the
+// postgres repository pages them.
+func (r *Repository) SearchLinks(_ context.Context, q entities.LinkQuery) ([]entities.Item, error) {
+	search := strings.ToLower(q.Search)
+
+	var position *entities.Item
+	if q.After != nil {
+		position = &entities.Item{CreatedAt: q.After.CreatedAt, ShortURL: q.After.ShortURL}
+	}
+
+	urls := make([]entities.Item, 0, 8)
+	r.db.Range(func(k, v interface{}) bool {
+		value, okValue := v.(Value)
+		if !okValue {
+			return true
+		}
+
+		item := value.item(k.(string))
+
+		switch {
+		case search != "" && !strings.Contains(strings.ToLower(item.OriginalURL), search):
+		case q.Domain != "" && !inDomain(item.OriginalURL, q.Domain):
+		case q.Owner != "" && item.UserID != q.Owner:
+		case q.Disabled != nil && (item.DisabledAt != nil) != *q.Disabled:
+		case position != nil && compareItems(entities.SortCreatedAt, item, *position) >= 0:
+		default:
+			urls = append(urls, item)
+		}
+
+		return true
+	})
+
+	slices.SortFunc(urls, func(a, b entities.Item) int {
+		return compareItems(entities.SortCreatedAt, b, a)
+	})
+
+	if q.Limit > 0 && len(urls) > q.Limit {
+		urls = urls[:q.Limit]
+	}
+
+	return urls, nil
+}
+
+// inDomain reports whether the host of rawURL is domain or one of its
+// subdomains.
+func inDomain(rawURL, domain string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// SetDisabled disables the links with reason at the given time, or enables
+// them again when at is nil, and returns the short URLs that changed.
+func (r *Repository) SetDisabled(_ context.Context, shortURLs []string, reason string, at *time.Time) ([]string, error) {
+	if at == nil {
+		reason = ""
+	}
+
+	changed := make([]string, 0, len(shortURLs))
+
+	for _, shortURL := range shortURLs {
+		for {
+			v, ok := r.db.Load(shortURL)
+			value, okValue := v.(Value)
+			if !ok || !okValue || (value.DisabledAt == nil) == (at == nil) {
+				break
+			}
+
+			value.DisabledAt, value.DisabledReason = at, reason
+			if r.db.CompareAndSwap(shortURL, v, value) {
+				changed = append(changed, shortURL)
+				break
+			}
+		}
+	}
+
+	return changed, nil
+}
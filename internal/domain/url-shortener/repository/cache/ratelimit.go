@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+)
+
+const bucketSweepInterval = time.Minute
+
+// RateLimiter keeps token buckets of a single replica in memory.
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   entities.RateLimit
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// TakeToken refills the bucket of key for the time passed and takes a token
+// if there is one.
+func (l *RateLimiter) TakeToken(_ context.Context, key string, limit entities.RateLimit) (entities.RateDecision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= bucketSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.limit = limit
+	b.tokens = b.refill(now)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return limit.Decision(b.tokens, false), nil
+	}
+
+	b.tokens--
+	return limit.Decision(b.tokens, true), nil
+}
+
+func (b *bucket) refill(now time.Time) float64 {
+	return min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate)
+}
+
+// sweep forgets full buckets: they are indistinguishable from new ones.
+func (l *RateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.refill(now) >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
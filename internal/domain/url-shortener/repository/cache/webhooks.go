@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+)
+
+// webhookStore keeps webhooks and their delivery queue in memory. Unlike the
+// links it is not written to the recovery file.
+type webhookStore struct {
+	mu         sync.Mutex
+	hooks      map[string]entities.Webhook
+	deliveries map[string]*entities.WebhookDelivery
+}
+
+func newWebhookStore() *webhookStore {
+	return &webhookStore{
+		hooks:      make(map[string]entities.Webhook),
+		deliveries: make(map[string]*entities.WebhookDelivery),
+	}
+}
+
+func (r *Repository) CreateWebhook(_ context.Context, wh entities.Webhook) error {
+	r.webhooks.mu.Lock()
+	defer r.webhooks.mu.Unlock()
+
+	r.webhooks.hooks[wh.ID] = wh
+	return nil
+}
+
+func (r *Repository) GetWebhooks(_ context.Context, userID string) ([]entities.Webhook, error) {
+	return r.filterWebhooks(func(wh entities.Webhook) bool {
+		return wh.UserID == userID
+	}), nil
+}
+
+func (r *Repository) GetWebhook(_ context.Context, id, userID string) (entities.Webhook, bool, error) {
+	hooks := r.filterWebhooks(func(wh entities.Webhook) bool {
+		return wh.ID == id && wh.UserID == userID
+	})
+	if len(hooks) == 0 {
+		return entities.Webhook{}, false, nil
+	}
+
+	return hooks[0], true, nil
+}
+
+func (r *Repository) GetWebhooksByEvent(_ context.Context, userID, event string) ([]entities.Webhook, error) {
+	return r.filterWebhooks(func(wh entities.Webhook) bool {
+		return wh.UserID == userID && slices.Contains(wh.Events, event)
+	}), nil
+}
+
+func (r *Repository) filterWebhooks(match func(entities.Webhook) bool) []entities.Webhook {
+	r.webhooks.mu.Lock()
+	defer r.webhooks.mu.Unlock()
+
+	hooks := make([]entities.Webhook, 0, 4)
+	for _, wh := range r.webhooks.hooks {
+		if match(wh) {
+			wh.Secret = ""
+			hooks = append(hooks, wh)
+		}
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+	})
+
+	return hooks
+}
+
+func (r *Repository) DeleteWebhook(_ context.Context, id, userID string) (bool, error) {
+	r.webhooks.mu.Lock()
+	defer r.webhooks.mu.Unlock()
+
+	wh, ok := r.webhooks.hooks[id]
+	if !ok || wh.UserID != userID {
+		return false, nil
+	}
+
+	delete(r.webhooks.hooks, id)
+	for deliveryID, d := range r.webhooks.deliveries {
+		if d.WebhookID == id {
+			delete(r.webhooks.deliveries, deliveryID)
+		}
+	}
+
+	return true, nil
+}
+
+func (r *Repository) EnqueueDeliveries(_ context.Context, deliveries []entities.WebhookDelivery) error {
+	r.webhooks.mu.Lock()
+	defer r.webhooks.mu.Unlock()
+
+	for _, d := range deliveries {
+		d.NextAttemptAt = d.CreatedAt
+		r.webhooks.deliveries[d.ID] = &d
+	}
+
+	return nil
+}
+
+func (r *Repository) ClaimDeliveries(_ context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error) {
+	r.webhooks.mu.Lock()
+	defer r.webhooks.mu.Unlock()
+
+	due := make([]*entities.WebhookDelivery, 0, limit)
+	for _, d := range r.webhooks.deliveries {
+		if d.Status == entities.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]entities.WebhookDelivery, 0, len(due))
+	for _, d := range due {
+		d.NextAttemptAt = now.Add(lease)
+
+		claim := *d
+		wh := r.webhooks.hooks[d.WebhookID]
+		claim.URL, claim.Secret = wh.URL, wh.Secret
+		claimed = append(claimed, claim)
+	}
+
+	return claimed, nil
+}
+
+func (r *Repository) UpdateDelivery(_ context.Context, d entities.WebhookDelivery) error {
+	r.webhooks.mu.Lock()
+	defer r.webhooks.mu.Unlock()
+
+	stored, ok := r.webhooks.deliveries[d.ID]
+	if !ok {
+		return nil
+	}
+
+	stored.Status = d.Status
+	stored.Attempts = d.Attempts
+	stored.ResponseCode = d.ResponseCode
+	stored.LastError = d.LastError
+	stored.NextAttemptAt = d.NextAttemptAt
+
+	return nil
+}
+
+func (r *Repository) GetDeliveries(_ context.Context, webhookID, userID string, limit int) ([]entities.WebhookDelivery, error) {
+	r.webhooks.mu.Lock()
+	defer r.webhooks.mu.Unlock()
+
+	if wh, ok := r.webhooks.hooks[webhookID]; !ok || wh.UserID != userID {
+		return []entities.WebhookDelivery{}, nil
+	}
+
+	deliveries := make([]entities.WebhookDelivery, 0, 8)
+	for _, d := range r.webhooks.deliveries {
+		if d.WebhookID == webhookID {
+			deliveries = append(deliveries, *d)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+)
+
+// workspaceStore keeps workspaces and their members in memory. Like accounts
+// they are not written to the recovery file.
+type workspaceStore struct {
+	mu   sync.RWMutex
+	byID map[string]entities.Workspace
+	// members are indexed by workspace id and user id.
+	members map[string]map[string]entities.Member
+}
+
+func newWorkspaceStore() *workspaceStore {
+	return &workspaceStore{
+		byID:    make(map[string]entities.Workspace),
+		members: make(map[string]map[string]entities.Member),
+	}
+}
+
+func (r *Repository) CreateWorkspace(_ context.Context, ws entities.Workspace, owner entities.Member) error {
+	r.workspaces.mu.Lock()
+	defer r.workspaces.mu.Unlock()
+
+	if _, ok := r.workspaces.byID[ws.ID]; ok {
+		return entities.ErrAlreadyExists
+	}
+
+	ws.Role = ""
+	r.workspaces.byID[ws.ID] = ws
+	r.workspaces.members[ws.ID] = map[string]entities.Member{owner.UserID: owner}
+	return nil
+}
+
+// GetWorkspaces returns the workspaces userID is a member of, oldest first,
+// with the user's role.
+func (r *Repository) GetWorkspaces(_ context.Context, userID string) ([]entities.Workspace, error) {
+	r.workspaces.mu.RLock()
+	defer r.workspaces.mu.RUnlock()
+
+	workspaces := make([]entities.Workspace, 0, 4)
+	for id, members := range r.workspaces.members {
+		if m, ok := members[userID]; ok {
+			ws := r.workspaces.byID[id]
+			ws.Role = m.Role
+			workspaces = append(workspaces, ws)
+		}
+	}
+
+	slices.SortFunc(workspaces, func(a, b entities.Workspace) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return workspaces, nil
+}
+
+func (r *Repository) GetMember(_ context.Context, workspaceID, userID string) (entities.Member, error) {
+	r.workspaces.mu.RLock()
+	defer r.workspaces.mu.RUnlock()
+
+	m, ok := r.workspaces.members[workspaceID][userID]
+	if !ok {
+		return entities.Member{}, entities.ErrNotFound
+	}
+
+	return m, nil
+}
+
+func (r *Repository) GetMembers(_ context.Context, workspaceID string) ([]entities.Member, error) {
+	r.workspaces.mu.RLock()
+	defer r.workspaces.mu.RUnlock()
+
+	members := make([]entities.Member, 0, len(r.workspaces.members[workspaceID]))
+	for _, m := range r.workspaces.members[workspaceID] {
+		members = append(members, m)
+	}
+
+	slices.SortFunc(members, func(a, b entities.Member) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return members, nil
+}
+
+// SetMember adds a member or changes the role of an existing one. Demoting
+// the last owner is ErrLastOwner.
+func (r *Repository) SetMember(_ context.Context, m entities.Member) error {
+	r.workspaces.mu.Lock()
+	defer r.workspaces.mu.Unlock()
+
+	members, ok := r.workspaces.members[m.WorkspaceID]
+	if !ok {
+		return entities.ErrNotFound
+	}
+
+	if existing, ok := members[m.UserID]; ok {
+		if m.Role != entities.RoleOwner && lastOwner(members, existing) {
+			return entities.ErrLastOwner
+		}
+		m.CreatedAt = existing.CreatedAt
+	}
+	members[m.UserID] = m
+	return nil
+}
+
+// DeleteMember removes a member and reports whether there was one. Removing
+// the last owner is ErrLastOwner.
+func (r *Repository) DeleteMember(_ context.Context, workspaceID, userID string) (bool, error) {
+	r.workspaces.mu.Lock()
+	defer r.workspaces.mu.Unlock()
+
+	members := r.workspaces.members[workspaceID]
+	existing, ok := members[userID]
+	if !ok {
+		return false, nil
+	}
+	if lastOwner(members, existing) {
+		return false, entities.ErrLastOwner
+	}
+
+	delete(members, userID)
+	return true, nil
+}
+
+// lastOwner reports whether m is the only owner among members.
+func lastOwner(members map[string]entities.Member, m entities.Member) bool {
+	if m.Role != entities.RoleOwner {
+		return false
+	}
+	for _, other := range members {
+		if other.Role == entities.RoleOwner && other.UserID != m.UserID {
+			return false
+		}
+	}
+
+	return true
+}
+
+// canEdit reports whether userID may change the link: its creator, or an owner
+// or editor of its workspace.
+func (r *Repository) canEdit(link Value, userID string) bool {
+	if link.WorkspaceID == "" {
+		return link.UserID == userID
+	}
+
+	r.workspaces.mu.RLock()
+	defer r.workspaces.mu.RUnlock()
+
+	m, ok := r.workspaces.members[link.WorkspaceID][userID]
+	return ok && entities.CanEdit(m.Role)
+}
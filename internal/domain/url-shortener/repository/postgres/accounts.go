@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the SQLSTATE of a unique constraint violation.
+const uniqueViolation = "23505"
+
+const qCreateAccount = `
+insert into
+    shortener.accounts (id, email, password_hash, created_at)
+values
+    ($1, $2, $3, $4)`
+
+func (r *Repository) CreateAccount(ctx context.Context, account entities.Account) error {
+	_, err := r.db.Exec(ctx, qCreateAccount, account.ID, account.Email, account.PasswordHash, account.CreatedAt)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return entities.ErrAlreadyExists
+	}
+
+	return err
+}
+
+const qGetAccountByEmail = `
+select
+    id, email, password_hash, created_at
+from
+    shortener.accounts
+where
+    email = $1`
+
+func (r *Repository) GetAccountByEmail(ctx context.Context, email string) (entities.Account, error) {
+	return r.getAccount(ctx, qGetAccountByEmail, email)
+}
+
+const qGetAccountByID = `
+select
+    id, email, password_hash, created_at
+from
+    shortener.accounts
+where
+    id = $1`
+
+func (r *Repository) GetAccountByID(ctx context.Context, id string) (entities.Account, error) {
+	return r.getAccount(ctx, qGetAccountByID, id)
+}
+
+func (r *Repository) getAccount(ctx context.Context, query string, arg string) (entities.Account, error) {
+	account := entities.Account{}
+	err := r.db.QueryRow(ctx, query, arg).Scan(&account.ID, &account.Email, &account.PasswordHash, &account.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Account{}, entities.ErrNotFound
+	}
+	if err != nil {
+		return entities.Account{}, err
+	}
+
+	return account, nil
+}
+
+const qCreateIdentity = `
+insert into
+    shortener.identities (issuer, subject, user_id, email, created_at)
+values
+    ($1, $2, $3, $4, $5)`
+
+func (r *Repository) CreateIdentity(ctx context.Context, identity entities.Identity) error {
+	_, err := r.db.Exec(ctx, qCreateIdentity, identity.Issuer, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return entities.ErrAlreadyExists
+	}
+
+	return err
+}
+
+const qGetIdentity = `
+select
+    issuer, subject, user_id, email, created_at
+from
+    shortener.identities
+where
+    issuer = $1 and subject = $2`
+
+func (r *Repository) GetIdentity(ctx context.Context, issuer, subject string) (entities.Identity, error) {
+	return r.getIdentity(ctx, qGetIdentity, issuer, subject)
+}
+
+const qGetIdentityByUserID = `
+select
+    issuer, subject, user_id, email, created_at
+from
+    shortener.identities
+where
+    user_id = $1
+limit 1`
+
+func (r *Repository) GetIdentityByUserID(ctx context.Context, userID string) (entities.Identity, error) {
+	return r.getIdentity(ctx, qGetIdentityByUserID, userID)
+}
+
+func (r *Repository) getIdentity(ctx context.Context, query string, args ...any) (entities.Identity, error) {
+	identity := entities.Identity{}
+	err := r.db.QueryRow(ctx, query, args...).
+		Scan(&identity.Issuer, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Identity{}, entities.ErrNotFound
+	}
+	if err != nil {
+		return entities.Identity{}, err
+	}
+
+	return identity, nil
+}
+
+const qMoveUserURLs = `
+update
+    shortener.urls
+set
+    user_id = $2
+where
+    user_id = $1`
+
+const qMoveUserWebhooks = `
+update
+    shortener.webhooks
+set
+    user_id = $2
+where
+    user_id = $1`
+
+const qMoveUserAPIKeys = `
+update
+    shortener.api_keys
+set
+    user_id = $2
+where
+    user_id = $1`
+
+// MoveUser hands the links, webhooks and API keys of from over to to in one
+// transaction. Pending webhook deliveries follow their webhook.
+func (r *Repository) MoveUser(ctx context.Context, from, to string) (entities.UserMove, error) {
+	var moved entities.UserMove
+	err := r.withTx(ctx, func(ctxTx context.Context) error {
+		tx := ctxTx.Value(txKey).(pgx.Tx)
+
+		for query, count := range map[string]*int64{
+			qMoveUserURLs:     &moved.URLs,
+			qMoveUserWebhooks: &moved.Webhooks,
+			qMoveUserAPIKeys:  &moved.APIKeys,
+		} {
+			tag, err := tx.Exec(ctx, query, from, to)
+			if err != nil {
+				return err
+			}
+			*count = tag.RowsAffected()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return entities.UserMove{}, err
+	}
+
+	return moved, nil
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/jackc/pgx/v5"
+)
+
+const qCreateAPIKey = `
+insert into
+    shortener.api_keys (id, user_id, name, prefix, hash, read_only, created_at)
+values
+    ($1, $2, $3, $4, $5, $6, $7)`
+
+func (r *Repository) CreateAPIKey(ctx context.Context, key entities.APIKey) error {
+	_, err := r.db.Exec(ctx, qCreateAPIKey, key.ID, key.UserID, key.Name, key.Prefix, key.Hash, key.ReadOnly, key.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const qGetAPIKeys = `
+select
+    id, user_id, name, prefix, read_only, created_at
+from
+    shortener.api_keys
+where
+    user_id = $1
+order by created_at`
+
+func (r *Repository) GetAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error) {
+	rows, err := r.db.Query(ctx, qGetAPIKeys, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]entities.APIKey, 0, 4)
+
+	for rows.Next() {
+		key := entities.APIKey{}
+		err = rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.ReadOnly, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+const qGetAPIKeyByHash = `
+select
+    id, user_id, name, prefix, hash, read_only, created_at
+from
+    shortener.api_keys
+where
+    hash = $1`
+
+func (r *Repository) GetAPIKeyByHash(ctx context.Context, hash string) (entities.APIKey, error) {
+	key := entities.APIKey{}
+	err := r.db.QueryRow(ctx, qGetAPIKeyByHash, hash).
+		Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, &key.ReadOnly, &key.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.APIKey{}, entities.ErrNotFound
+	}
+	if err != nil {
+		return entities.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+const qDeleteAPIKey = `
+delete from
+    shortener.api_keys
+where
+    id = $1 and user_id = $2`
+
+func (r *Repository) DeleteAPIKey(ctx context.Context, id, userID string) (bool, error) {
+	tag, err := r.db.Exec(ctx, qDeleteAPIKey, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/jackc/pgx/v5"
+)
+
+const qAppendAudit = `
+insert into
+    shortener.audit_log (id, action, actor_id, target, reason, ip, request_id, before, after, created_at)
+select
+    *
+from
+    unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[], $6::text[], $7::text[], $8::jsonb[], $9::jsonb[], $10::timestamptz[])`
+
+func (r *Repository) AppendAudit(ctx context.Context, entries []entities.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var (
+		ids      = make([]string, 0, len(entries))
+		actions  = make([]string, 0, len(entries))
+		actors   = make([]string, 0, len(entries))
+		targets  = make([]string, 0, len(entries))
+		reasons  = make([]string, 0, len(entries))
+		ips      = make([]string, 0, len(entries))
+		requests = make([]string, 0, len(entries))
+		befores  = make([]*string, 0, len(entries))
+		afters   = make([]*string, 0, len(entries))
+		times    = make([]time.Time, 0, len(entries))
+	)
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+		actions = append(actions, e.Action)
+		actors = append(actors, e.ActorID)
+		targets = append(targets, e.Target)
+		reasons = append(reasons, e.Reason)
+		ips = append(ips, e.IP)
+		requests = append(requests, e.RequestID)
+		befores = append(befores, jsonText(e.Before))
+		afters = append(afters, jsonText(e.After))
+		times = append(times, e.CreatedAt)
+	}
+
+	_, err := r.db.Exec(ctx, qAppendAudit, ids, actions, actors, targets, reasons, ips, requests, befores, afters, times)
+	return err
+}
+
+// jsonText passes a JSON document as text, so that an empty one is null.
+func jsonText(data []byte) *string {
+	if len(data) == 0 {
+		return nil
+	}
+
+	s := string(data)
+	return &s
+}
+
+// qQueryAudit pages through the log newest first; the target and actor
+// filters use their own indexes.
+const qQueryAudit = `
+select
+    id, action, actor_id, target, reason, ip, request_id, before, after, created_at
+from
+    shortener.audit_log
+where
+    ($1 = '' or actor_id = $1)
+    and ($2 = '' or action = $2)
+    and ($3 = '' or target = $3)
+    and ($4::timestamptz is null or created_at >= $4)
+    and ($5::timestamptz is null or created_at < $5)
+    and ($6::timestamptz is null or (created_at, id) < ($6, $7::text))
+order by
+    created_at desc, id desc
+limit $8`
+
+func (r *Repository) QueryAudit(ctx context.Context, q entities.AuditQuery) ([]entities.AuditEntry, error) {
+	var (
+		afterCreated *time.Time
+		afterID      string
+	)
+	if q.After != nil {
+		afterCreated, afterID = &q.After.CreatedAt, q.After.ID
+	}
+
+	rows, err := r.db.Query(ctx, qQueryAudit, q.ActorID, q.Action, q.Target, q.Since, q.Until, afterCreated, afterID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (entities.AuditEntry, error) {
+		var (
+			e             entities.AuditEntry
+			before, after []byte
+		)
+		err := row.Scan(&e.ID, &e.Action, &e.ActorID, &e.Target, &e.Reason, &e.IP, &e.RequestID, &before, &after, &e.CreatedAt)
+		e.Before, e.After = before, after
+		return e, err
+	})
+}
@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// canonicalURLsMigration marks the one-off rewrite of the stored URLs into
+// the canonical form.
+const canonicalURLsMigration = "canonical_urls"
+
+const qDataMigrationApplied = `
+select exists (
+    select 1 from shortener.data_migrations where name = $1
+)`
+
+const qMarkDataMigration = `
+insert into
+    shortener.data_migrations (name)
+values
+    ($1)`
+
+// Live links come first, so the oldest live link of equal URLs keeps its URL.
+const qStoredURLs = `
+select 
+    short_url, url 
+from 
+    shortener.urls 
+where 
+    merged_into is null 
+order by 
+    is_deleted, created_at, short_url`
+
+const qRewriteURLs = `
+update 
+    shortener.urls u
+set 
+    url = c.url, merged_into = nullif(c.merged_into, '')
+from 
+    unnest($1::text[], $2::text[], $3::text[]) as c(short_url, url, merged_into)
+where 
+    u.short_url = c.short_url`
+
+// CanonicalizeURLs rewrites the stored URLs with canonical, once per
+// database. Links whose URLs become equal are merged: the oldest live one
+// keeps the URL, new links with it get its short link, and the others point
+// at it with merged_into and keep redirecting. URLs canonical refuses are
+// left as they are.
+func (r *Repository) CanonicalizeURLs(ctx context.Context, canonical func(string) (string, error)) (int, error) {
+	var rewritten int
+
+	err := r.withTx(ctx, func(ctxTx context.Context) error {
+		tx := ctxTx.Value(txKey).(pgx.Tx)
+
+		// Replicas starting together wait for the first one, and links are
+		// not written while the URLs are rewritten.
+		_, err := tx.Exec(ctx, `LOCK TABLE shortener.data_migrations, shortener.urls IN SHARE ROW EXCLUSIVE MODE`)
+		if err != nil {
+			return err
+		}
+
+		var applied bool
+		if err = tx.QueryRow(ctx, qDataMigrationApplied, canonicalURLsMigration).Scan(&applied); err != nil || applied {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, qStoredURLs)
+		if err != nil {
+			return err
+		}
+
+		var (
+			keepers = make(map[string]string)
+			// Merged links leave the unique index before the keepers take
+			// their URL.
+			merged, kept [3][]string
+		)
+		for rows.Next() {
+			var shortURL, raw string
+			if err = rows.Scan(&shortURL, &raw); err != nil {
+				rows.Close()
+				return err
+			}
+
+			url, invalid := canonical(raw)
+			if invalid != nil {
+				continue
+			}
+
+			if keeper, ok := keepers[url]; ok {
+				merged = appendRewrite(merged, shortURL, url, keeper)
+				continue
+			}
+
+			keepers[url] = shortURL
+			if url != raw {
+				kept = appendRewrite(kept, shortURL, url, "")
+			}
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, batch := range [][3][]string{merged, kept} {
+			if _, err = tx.Exec(ctx, qRewriteURLs, batch[0], batch[1], batch[2]); err != nil {
+				return err
+			}
+		}
+		rewritten = len(merged[0]) + len(kept[0])
+
+		_, err = tx.Exec(ctx, qMarkDataMigration, canonicalURLsMigration)
+		return err
+	})
+
+	return rewritten, err
+}
+
+func appendRewrite(batch [3][]string, shortURL, url, mergedInto string) [3][]string {
+	batch[0] = append(batch[0], shortURL)
+	batch[1] = append(batch[1], url)
+	batch[2] = append(batch[2], mergedInto)
+
+	return batch
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/jackc/pgx/v5"
+)
+
+// qSearchLinks pages through the links of all users, newest first, along the
+// (created_at, short_url) index. The host is taken from the authority of the
+// original URL and matches the domain itself and its subdomains.
+const qSearchLinks = `
+select
+    short_url, url, is_deleted, created_at, clicks, expires_at, coalesce(user_id, ''), coalesce(workspace_id, ''),
+    disabled_reason, disabled_at
+from
+    shortener.urls
+    cross join lateral (
+        select lower(substring(url from '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^/?#@]*@)?([^/?#:]+)')) as host
+    ) h
+where
+    ($1 = '' or strpos(lower(url), lower($1)) > 0)
+    and ($2 = '' or h.host = $2 or h.host like '%.' || $2)
+    and ($3 = '' or user_id = $3)
+    and ($4::bool is null or (disabled_at is not null) = $4)
+    and ($5::timestamptz is null or (created_at, short_url) < ($5, $6::text))
+order by
+    created_at desc, short_url desc
+limit $7`
+
+func (r *Repository) SearchLinks(ctx context.Context, q entities.LinkQuery) ([]entities.Item, error) {
+	var (
+		afterCreated *time.Time
+		afterShort   string
+	)
+	if q.After != nil {
+		afterCreated, afterShort = &q.After.CreatedAt, q.After.ShortURL
+	}
+
+	rows, err := r.db.Query(ctx, qSearchLinks, q.Search, q.Domain, q.Owner, q.Disabled, afterCreated, afterShort, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanItem)
+}
+
+const qSetDisabled = `
+update
+    shortener.urls
+set
+    disabled_at = $2, disabled_reason = $3
+where
+    short_url = any($1) and (disabled_at is null) = ($2::timestamptz is not null)
+returning short_url`
+
+// SetDisabled disables the links with reason at the given time, or enables
+// them again when at is nil, and returns the short URLs that changed.
+func (r *Repository) SetDisabled(ctx context.Context, shortURLs []string, reason string, at *time.Time) ([]string, error) {
+	if at == nil {
+		reason = ""
+	}
+
+	rows, err := r.db.Query(ctx, qSetDisabled, shortURLs, at, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
@@ -6,6 +6,10 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
 
 	"github.com/MV7VM/url-shortener/internal/config"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
@@ -24,6 +28,9 @@ type Repository struct {
 	ctx context.Context
 	cfg *config.PsqlConfig
 	db  *pgxpool.Pool
+	// lastSweep is when full rate limit buckets were last deleted, in unix
+	// nanoseconds.
+	lastSweep atomic.Int64
 }
 
 // NewRepository returns a Repo instance ready to be plugged into an Fx graph.
@@ -67,17 +74,17 @@ func (r *Repository) Ping(ctx context.Context) error {
 
 const qSet = `
 INSERT INTO 
-    shortener.urls (short_url, url, user_id) 
+    shortener.urls (short_url, url, user_id, workspace_id) 
 VALUES 
-    ($1, $2, $3) 
-ON CONFLICT (url) DO UPDATE 
+    ($1, $2, $3, nullif($4, '')) 
+ON CONFLICT (url) WHERE merged_into IS NULL DO UPDATE 
     SET short_url = shortener.urls.short_url 
 RETURNING short_url
 `
 
-func (r *Repository) Set(ctx context.Context, key, value, userID string) (string, error) {
+func (r *Repository) Set(ctx context.Context, key, value, userID, workspaceID string) (string, error) {
 	var storedKey string
-	if err := r.db.QueryRow(ctx, qSet, key, value, userID).Scan(&storedKey); err != nil {
+	if err := r.db.QueryRow(ctx, qSet, key, value, userID, workspaceID).Scan(&storedKey); err != nil {
 		return "", err
 	}
 
@@ -86,21 +93,103 @@ func (r *Repository) Set(ctx context.Context, key, value, userID string) (string
 
 const qGet = `
 select 
-    url, is_deleted 
+    url, is_deleted, disabled_at is not null, coalesce(expires_at <= now(), false) 
 from 
     shortener.urls 
 where 
     short_url = $1`
 
 func (r *Repository) Get(ctx context.Context, s string) (url string, isDelete bool, err error) {
-	err = r.db.QueryRow(ctx, qGet, s).Scan(&url, &isDelete)
+	var disabled, expired bool
+	err = r.db.QueryRow(ctx, qGet, s).Scan(&url, &isDelete, &disabled, &expired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, entities.ErrNotFound
+	}
 	if err != nil {
 		return "", false, err
 	}
+	if disabled && !isDelete {
+		return "", false, entities.ErrDisabled
+	}
+	if expired && !isDelete {
+		return "", false, entities.ErrExpired
+	}
 
 	return url, isDelete, nil
 }
 
+const qGetOwner = `
+select 
+    coalesce(user_id, '') 
+from 
+    shortener.urls 
+where 
+    short_url = $1`
+
+func (r *Repository) GetOwner(ctx context.Context, s string) (userID string, err error) {
+	err = r.db.QueryRow(ctx, qGetOwner, s).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", entities.ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+const qGetLink = `
+select 
+    short_url, url, coalesce(user_id, ''), coalesce(workspace_id, ''), is_deleted, created_at, clicks, expires_at,
+    disabled_reason, disabled_at
+from 
+    shortener.urls 
+where 
+    short_url = $1`
+
+func (r *Repository) GetLink(ctx context.Context, s string) (entities.Item, error) {
+	var item entities.Item
+	err := r.db.QueryRow(ctx, qGetLink, s).Scan(&item.ShortURL, &item.OriginalURL, &item.UserID, &item.WorkspaceID,
+		&item.IsDeleted, &item.CreatedAt, &item.Clicks, &item.ExpiresAt, &item.DisabledReason, &item.DisabledAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Item{}, entities.ErrNotFound
+	}
+	if err != nil {
+		return entities.Item{}, err
+	}
+
+	return item, nil
+}
+
+const qUpdateLink = `
+update 
+    shortener.urls 
+set 
+    url = $2, workspace_id = nullif($3, ''), expires_at = $4, merged_into = null 
+where 
+    short_url = $1`
+
+// UpdateLink changes the original URL, the workspace and the expiry of a
+// link. An original URL that another link already has is ErrAlreadyExists.
+// A merged link stands on its own again once updated.
+func (r *Repository) UpdateLink(ctx context.Context, item entities.Item) error {
+	tag, err := r.db.Exec(ctx, qUpdateLink, item.ShortURL, item.OriginalURL, item.WorkspaceID, item.ExpiresAt)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return entities.ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return entities.ErrNotFound
+	}
+
+	return nil
+}
+
 const qGetCount = `
 select 
     count(*) 
@@ -116,54 +205,147 @@ func (r *Repository) GetCount(ctx context.Context) (count int, err error) {
 	return count, nil
 }
 
+const qAddClicks = `
+update 
+    shortener.urls u
+set 
+    clicks = u.clicks + c.n
+from 
+    unnest($1::text[], $2::bigint[]) as c(short_url, n)
+where 
+    u.short_url = c.short_url`
+
+// AddClicks adds the counted clicks of many links with one statement.
+func (r *Repository) AddClicks(ctx context.Context, counts map[string]int64) error {
+	keys := make([]string, 0, len(counts))
+	clicks := make([]int64, 0, len(counts))
+	for key, n := range counts {
+		keys = append(keys, key)
+		clicks = append(clicks, n)
+	}
+
+	_, err := r.db.Exec(ctx, qAddClicks, keys, clicks)
+	return err
+}
+
+// qGetUsersUrls is completed by usersUrlsQuery with the owner of the links,
+// the keyset condition and the order of the requested sort column; they are
+// served by the (user_id, <column>, short_url) and (workspace_id, <column>,
+// short_url) indexes.
 const qGetUsersUrls = `
 select 
-    short_url, url
+    short_url, url, is_deleted, created_at, clicks, expires_at, coalesce(user_id, ''), coalesce(workspace_id, ''),
+    disabled_reason, disabled_at
 from 
     shortener.urls 
 where 
-    user_id = $1`
-
-func (r *Repository) GetUsersUrls(ctx context.Context, userID string) ([]entities.Item, error) {
-	rows, err := r.db.Query(ctx, qGetUsersUrls, userID)
-	if err != nil {
-		return nil, err
+    ($2 = '' or strpos(lower(url), lower($2)) > 0)
+    and ($3::bool is null or is_deleted = $3)
+    and ($4::bool is null or (expires_at is not null and expires_at <= now()) = $4)`
+
+func usersUrlsQuery(q entities.URLQuery) (string, []any) {
+	column, direction, op := "created_at", "asc", ">"
+	if q.Sort == entities.SortClicks {
+		column = "clicks"
+	}
+	if q.Desc {
+		direction, op = "desc", "<"
 	}
 
-	urls := make([]entities.Item, 0, 8)
+	var sb strings.Builder
+	sb.WriteString(qGetUsersUrls)
+	if q.Workspace != "" {
+		sb.WriteString("\n    and workspace_id = $1")
+	} else {
+		sb.WriteString("\n    and user_id = $1 and workspace_id is null")
+	}
 
-	for rows.Next() {
-		url := entities.Item{}
-		err = rows.Scan(&url.ShortURL, &url.OriginalURL)
-		if err != nil {
-			return nil, err
+	args := []any{q.Search, q.Deleted, q.Expired}
+	if q.After != nil {
+		var value any = q.After.CreatedAt
+		if q.Sort == entities.SortClicks {
+			value = q.After.Clicks
 		}
+		args = append(args, value, q.After.ShortURL)
+		fmt.Fprintf(&sb, "\n    and (%s, short_url) %s ($5, $6)", column, op)
+	}
 
-		urls = append(urls, url)
+	fmt.Fprintf(&sb, "\norder by \n    %s %s, short_url %s", column, direction, direction)
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		fmt.Fprintf(&sb, "\nlimit $%d", len(args)+1)
 	}
 
-	return urls, nil
+	return sb.String(), args
+}
+
+func (r *Repository) GetUsersUrls(ctx context.Context, userID string, q entities.URLQuery) ([]entities.Item, error) {
+	query, args := usersUrlsQuery(q)
+
+	owner := userID
+	if q.Workspace != "" {
+		owner = q.Workspace
+	}
+
+	rows, err := r.db.Query(ctx, query, append([]any{owner}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanItem)
+}
+
+// scanItem reads a link selected with the columns of qGetUsersUrls.
+func scanItem(row pgx.CollectableRow) (entities.Item, error) {
+	var url entities.Item
+	err := row.Scan(&url.ShortURL, &url.OriginalURL, &url.IsDeleted, &url.CreatedAt, &url.Clicks, &url.ExpiresAt,
+		&url.UserID, &url.WorkspaceID, &url.DisabledReason, &url.DisabledAt)
+	return url, err
 }
 
+// qDelete marks links of many users in one statement: every (short_url,
+// user_id) pair only matches a link the user may change, that is a personal
+// link created by the user or a link of a workspace where the user is an
+// owner or editor (see entities.CanEdit).
 const qDelete = `
 update 
-    shortener.urls 
+    shortener.urls u
 set 
-    is_deleted = case 
-        when user_id =$2
-            then true 
-            else is_deleted 
-        end
-where short_url = any($1);
+    is_deleted = true
+from 
+    unnest($1::text[], $2::text[]) as req(short_url, user_id)
+where 
+    u.short_url = req.short_url and not u.is_deleted
+    and (
+        (u.workspace_id is null and u.user_id = req.user_id)
+        or exists (
+            select 1 
+            from shortener.workspace_members m 
+            where m.workspace_id = u.workspace_id and m.user_id = req.user_id and m.role in ('owner', 'editor')
+        )
+    )
+returning u.short_url, req.user_id;
 `
 
-func (r *Repository) Delete(ctx context.Context, shortURL []string, userID string) error {
-	_, err := r.db.Exec(ctx, qDelete, shortURL, userID)
+// Delete marks the requested links as deleted and returns the ones that changed.
+func (r *Repository) Delete(ctx context.Context, items []entities.DeleteItem) ([]entities.DeleteItem, error) {
+	shortURLs := make([]string, 0, len(items))
+	userIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		shortURLs = append(shortURLs, item.ShortURL)
+		userIDs = append(userIDs, item.UserID)
+	}
+
+	rows, err := r.db.Query(ctx, qDelete, shortURLs, userIDs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (entities.DeleteItem, error) {
+		var item entities.DeleteItem
+		err := row.Scan(&item.ShortURL, &item.UserID)
+		return item, err
+	})
 }
 
 // migrate создает схему и таблицу для хранения URL, если они не существуют.
@@ -195,6 +377,199 @@ func (r *Repository) migrate(ctx context.Context, tx pgx.Tx) error {
 		return err
 	}
 
+	// Колонки и индексы для постраничного списка ссылок пользователя
+	_, err = execFunc(ctx, `
+		ALTER TABLE shortener.urls
+			ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			ADD COLUMN IF NOT EXISTS clicks BIGINT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+		CREATE INDEX IF NOT EXISTS urls_user_created_idx ON shortener.urls (user_id, created_at, short_url);
+		CREATE INDEX IF NOT EXISTS urls_user_clicks_idx ON shortener.urls (user_id, clicks, short_url)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Таблицы исходящих вебхуков и их очереди доставки
+	_, err = execFunc(ctx, `
+		CREATE TABLE IF NOT EXISTS shortener.webhooks (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			url TEXT NOT NULL,
+			events TEXT[] NOT NULL,
+			secret TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS webhooks_user_id_idx ON shortener.webhooks (user_id);
+		CREATE TABLE IF NOT EXISTS shortener.webhook_deliveries (
+			id TEXT PRIMARY KEY,
+			webhook_id TEXT NOT NULL REFERENCES shortener.webhooks (id) ON DELETE CASCADE,
+			event TEXT NOT NULL,
+			payload JSONB NOT NULL,
+			status TEXT NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			response_code INT NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx
+			ON shortener.webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx
+			ON shortener.webhook_deliveries (webhook_id, created_at)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Общие для реплик корзины rate limit; потеря при сбое не страшна
+	_, err = execFunc(ctx, `
+		CREATE UNLOGGED TABLE IF NOT EXISTS shortener.rate_limits (
+			key TEXT PRIMARY KEY,
+			tokens DOUBLE PRECISION NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Полные корзины удаляются по full_at, иначе таблица растёт бесконечно
+	_, err = execFunc(ctx, `
+		ALTER TABLE shortener.rate_limits ADD COLUMN IF NOT EXISTS full_at TIMESTAMPTZ NOT NULL DEFAULT now();
+		CREATE INDEX IF NOT EXISTS rate_limits_full_at_idx ON shortener.rate_limits (full_at);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// API ключи хранятся только как sha256 от ключа
+	_, err = execFunc(ctx, `
+		CREATE TABLE IF NOT EXISTS shortener.api_keys (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL DEFAULT '',
+			prefix TEXT NOT NULL,
+			hash TEXT NOT NULL UNIQUE,
+			read_only BOOLEAN NOT NULL DEFAULT false,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON shortener.api_keys (user_id)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Зарегистрированные пользователи и их внешние (OIDC) личности; id
+	// совпадает с user_id их ссылок
+	_, err = execFunc(ctx, `
+		CREATE TABLE IF NOT EXISTS shortener.accounts (
+			id TEXT PRIMARY KEY,
+			email TEXT NOT NULL UNIQUE,
+			password_hash BYTEA NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE TABLE IF NOT EXISTS shortener.identities (
+			issuer TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			email TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (issuer, subject)
+		);
+		CREATE INDEX IF NOT EXISTS identities_user_id_idx ON shortener.identities (user_id)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Общие рабочие пространства: ссылка принадлежит либо пользователю, либо
+	// пространству, которым управляют его участники
+	_, err = execFunc(ctx, `
+		CREATE TABLE IF NOT EXISTS shortener.workspaces (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE TABLE IF NOT EXISTS shortener.workspace_members (
+			workspace_id TEXT NOT NULL REFERENCES shortener.workspaces (id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL,
+			role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (workspace_id, user_id)
+		);
+		CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON shortener.workspace_members (user_id);
+		ALTER TABLE shortener.urls
+			ADD COLUMN IF NOT EXISTS workspace_id TEXT REFERENCES shortener.workspaces (id);
+		CREATE INDEX IF NOT EXISTS urls_workspace_created_idx
+			ON shortener.urls (workspace_id, created_at, short_url) WHERE workspace_id IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS urls_workspace_clicks_idx
+			ON shortener.urls (workspace_id, clicks, short_url) WHERE workspace_id IS NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Модерация: отключённые ссылки и журнал действий администраторов
+	_, err = execFunc(ctx, `
+		ALTER TABLE shortener.urls
+			ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ,
+			ADD COLUMN IF NOT EXISTS disabled_reason TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS urls_created_idx ON shortener.urls (created_at, short_url);
+		CREATE TABLE IF NOT EXISTS shortener.audit_log (
+			id TEXT PRIMARY KEY,
+			action TEXT NOT NULL,
+			actor_id TEXT NOT NULL,
+			target TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS audit_log_target_idx ON shortener.audit_log (target, created_at)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Журнал аудита всех изменяющих операций: строки только добавляются,
+	// изменить или удалить их не даёт триггер
+	_, err = execFunc(ctx, `
+		ALTER TABLE shortener.audit_log
+			ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS request_id TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS before JSONB,
+			ADD COLUMN IF NOT EXISTS after JSONB;
+		CREATE INDEX IF NOT EXISTS audit_log_created_idx ON shortener.audit_log (created_at, id);
+		CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON shortener.audit_log (actor_id, created_at);
+		CREATE OR REPLACE FUNCTION shortener.audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'shortener.audit_log is append-only';
+		END
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS audit_log_append_only ON shortener.audit_log;
+		CREATE TRIGGER audit_log_append_only
+			BEFORE UPDATE OR DELETE OR TRUNCATE ON shortener.audit_log
+			FOR EACH STATEMENT EXECUTE FUNCTION shortener.audit_log_append_only()
+	`)
+	if err != nil {
+		return err
+	}
+
+	// Канонизация URL: совпавшие после неё ссылки указывают через merged_into
+	// на оставшуюся, поэтому URL уникален только среди не слитых ссылок.
+	// Однократные переносы данных отмечаются в data_migrations
+	_, err = execFunc(ctx, `
+		ALTER TABLE shortener.urls ADD COLUMN IF NOT EXISTS merged_into TEXT;
+		ALTER TABLE shortener.urls DROP CONSTRAINT IF EXISTS urls_url_key;
+		CREATE UNIQUE INDEX IF NOT EXISTS urls_url_unique_idx ON shortener.urls (url) WHERE merged_into IS NULL;
+		CREATE TABLE IF NOT EXISTS shortener.data_migrations (
+			name TEXT PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
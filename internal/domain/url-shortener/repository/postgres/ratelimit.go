@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/jackc/pgx/v5"
+)
+
+const bucketSweepInterval = time.Minute
+
+// qTakeToken refills and takes a token in one statement, so replicas sharing
+// the table never race. The update is skipped when the refilled bucket is
+// empty, in which case no row is returned. full_at is when the bucket is
+// full again and may be forgotten.
+const qTakeToken = `
+insert into
+    shortener.rate_limits as b (key, tokens, updated_at, full_at)
+values
+    ($1, $2::float8 - 1, now(), now() + make_interval(secs => 1 / $3::float8))
+on conflict (key) do update
+    set tokens = least($2::float8, b.tokens + extract(epoch from now() - b.updated_at)::float8 * $3::float8) - 1,
+        updated_at = now(),
+        full_at = now() + make_interval(secs => ($2::float8 + 1 - least($2::float8, b.tokens + extract(epoch from now() - b.updated_at)::float8 * $3::float8)) / $3::float8)
+    where least($2::float8, b.tokens + extract(epoch from now() - b.updated_at)::float8 * $3::float8) >= 1
+returning tokens`
+
+// qSweepBuckets forgets full buckets: they are indistinguishable from new
+// ones.
+const qSweepBuckets = `
+delete from
+    shortener.rate_limits
+where
+    full_at < now()`
+
+const qPeekTokens = `
+select
+    least($2::float8, tokens + extract(epoch from now() - updated_at)::float8 * $3::float8)
+from
+    shortener.rate_limits
+where
+    key = $1`
+
+func (r *Repository) TakeToken(ctx context.Context, key string, limit entities.RateLimit) (entities.RateDecision, error) {
+	r.sweepBuckets(ctx)
+
+	burst := float64(limit.Burst)
+
+	var tokens float64
+	err := r.db.QueryRow(ctx, qTakeToken, key, burst, limit.Rate).Scan(&tokens)
+	if err == nil {
+		return limit.Decision(tokens, true), nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return entities.RateDecision{}, err
+	}
+
+	if err = r.db.QueryRow(ctx, qPeekTokens, key, burst, limit.Rate).Scan(&tokens); err != nil {
+		return entities.RateDecision{}, err
+	}
+
+	return limit.Decision(tokens, false), nil
+}
+
+// sweepBuckets deletes the full buckets once per bucketSweepInterval across
+// the calls of this replica. A failed sweep is left to the next interval, it
+// must not fail the request.
+func (r *Repository) sweepBuckets(ctx context.Context) {
+	now := time.Now().UnixNano()
+	last := r.lastSweep.Load()
+	if now-last < int64(bucketSweepInterval) || !r.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+
+	_, _ = r.db.Exec(ctx, qSweepBuckets)
+}
@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/jackc/pgx/v5"
+)
+
+const qCreateWebhook = `
+insert into
+    shortener.webhooks (id, user_id, url, events, secret, created_at)
+values
+    ($1, $2, $3, $4, $5, $6)`
+
+func (r *Repository) CreateWebhook(ctx context.Context, wh entities.Webhook) error {
+	_, err := r.db.Exec(ctx, qCreateWebhook, wh.ID, wh.UserID, wh.URL, wh.Events, wh.Secret, wh.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const qGetWebhooks = `
+select
+    id, user_id, url, events, created_at
+from
+    shortener.webhooks
+where
+    user_id = $1
+order by created_at`
+
+func (r *Repository) GetWebhooks(ctx context.Context, userID string) ([]entities.Webhook, error) {
+	return r.queryWebhooks(ctx, qGetWebhooks, userID)
+}
+
+const qGetWebhook = `
+select
+    id, user_id, url, events, created_at
+from
+    shortener.webhooks
+where
+    id = $1 and user_id = $2`
+
+func (r *Repository) GetWebhook(ctx context.Context, id, userID string) (entities.Webhook, bool, error) {
+	hooks, err := r.queryWebhooks(ctx, qGetWebhook, id, userID)
+	if err != nil || len(hooks) == 0 {
+		return entities.Webhook{}, false, err
+	}
+
+	return hooks[0], true, nil
+}
+
+const qGetWebhooksByEvent = `
+select
+    id, user_id, url, events, created_at
+from
+    shortener.webhooks
+where
+    user_id = $1 and $2 = any(events)`
+
+func (r *Repository) GetWebhooksByEvent(ctx context.Context, userID, event string) ([]entities.Webhook, error) {
+	return r.queryWebhooks(ctx, qGetWebhooksByEvent, userID, event)
+}
+
+func (r *Repository) queryWebhooks(ctx context.Context, query string, args ...any) ([]entities.Webhook, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := make([]entities.Webhook, 0, 4)
+
+	for rows.Next() {
+		wh := entities.Webhook{}
+		err = rows.Scan(&wh.ID, &wh.UserID, &wh.URL, &wh.Events, &wh.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		hooks = append(hooks, wh)
+	}
+
+	return hooks, rows.Err()
+}
+
+const qDeleteWebhook = `
+delete from
+    shortener.webhooks
+where
+    id = $1 and user_id = $2`
+
+func (r *Repository) DeleteWebhook(ctx context.Context, id, userID string) (bool, error) {
+	tag, err := r.db.Exec(ctx, qDeleteWebhook, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+const qEnqueueDelivery = `
+insert into
+    shortener.webhook_deliveries (id, webhook_id, event, payload, status, attempts, next_attempt_at, created_at)
+values
+    ($1, $2, $3, $4, $5, 0, $6, $6)`
+
+func (r *Repository) EnqueueDeliveries(ctx context.Context, deliveries []entities.WebhookDelivery) error {
+	batch := &pgx.Batch{}
+	for _, d := range deliveries {
+		batch.Queue(qEnqueueDelivery, d.ID, d.WebhookID, d.Event, []byte(d.Payload), d.Status, d.CreatedAt)
+	}
+
+	return r.db.SendBatch(ctx, batch).Close()
+}
+
+// qClaimDeliveries pushes next_attempt_at of the due rows forward by the lease
+// so that concurrent replicas skip them while they are in flight.
+const qClaimDeliveries = `
+update
+    shortener.webhook_deliveries d
+set
+    next_attempt_at = $2
+from (
+    select id
+    from shortener.webhook_deliveries
+    where status = 'pending' and next_attempt_at <= $1
+    order by next_attempt_at
+    limit $3
+    for update skip locked
+) due, shortener.webhooks w
+where
+    d.id = due.id and w.id = d.webhook_id
+returning
+    d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.created_at, w.url, w.secret`
+
+func (r *Repository) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error) {
+	rows, err := r.db.Query(ctx, qClaimDeliveries, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]entities.WebhookDelivery, 0, limit)
+
+	for rows.Next() {
+		d := entities.WebhookDelivery{}
+		var payload []byte
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+const qUpdateDelivery = `
+update
+    shortener.webhook_deliveries
+set
+    status = $2, attempts = $3, response_code = $4, last_error = $5, next_attempt_at = $6
+where
+    id = $1`
+
+func (r *Repository) UpdateDelivery(ctx context.Context, d entities.WebhookDelivery) error {
+	_, err := r.db.Exec(ctx, qUpdateDelivery, d.ID, d.Status, d.Attempts, d.ResponseCode, d.LastError, d.NextAttemptAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const qGetDeliveries = `
+select
+    d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts,
+    d.response_code, d.last_error, d.next_attempt_at, d.created_at
+from
+    shortener.webhook_deliveries d
+    join shortener.webhooks w on w.id = d.webhook_id
+where
+    d.webhook_id = $1 and w.user_id = $2
+order by d.created_at desc
+limit $3`
+
+func (r *Repository) GetDeliveries(ctx context.Context, webhookID, userID string, limit int) ([]entities.WebhookDelivery, error) {
+	rows, err := r.db.Query(ctx, qGetDeliveries, webhookID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]entities.WebhookDelivery, 0, 8)
+
+	for rows.Next() {
+		d := entities.WebhookDelivery{}
+		var payload []byte
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts,
+			&d.ResponseCode, &d.LastError, &d.NextAttemptAt, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
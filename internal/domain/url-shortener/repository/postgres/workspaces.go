@@ -0,0 +1,208 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const qCreateWorkspace = `
+insert into
+    shortener.workspaces (id, name, created_at)
+values
+    ($1, $2, $3)`
+
+const qSetMember = `
+insert into
+    shortener.workspace_members (workspace_id, user_id, role, created_at)
+values
+    ($1, $2, $3, $4)
+on conflict (workspace_id, user_id) do update
+    set role = excluded.role`
+
+// CreateWorkspace stores the workspace together with its first owner.
+func (r *Repository) CreateWorkspace(ctx context.Context, ws entities.Workspace, owner entities.Member) error {
+	return r.withTx(ctx, func(ctxTx context.Context) error {
+		tx := ctxTx.Value(txKey).(pgx.Tx)
+
+		_, err := tx.Exec(ctx, qCreateWorkspace, ws.ID, ws.Name, ws.CreatedAt)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return entities.ErrAlreadyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, qSetMember, owner.WorkspaceID, owner.UserID, owner.Role, owner.CreatedAt)
+		return err
+	})
+}
+
+const qGetWorkspaces = `
+select
+    w.id, w.name, m.role, w.created_at
+from
+    shortener.workspaces w
+    join shortener.workspace_members m on m.workspace_id = w.id
+where
+    m.user_id = $1
+order by w.created_at`
+
+func (r *Repository) GetWorkspaces(ctx context.Context, userID string) ([]entities.Workspace, error) {
+	rows, err := r.db.Query(ctx, qGetWorkspaces, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (entities.Workspace, error) {
+		var ws entities.Workspace
+		err := row.Scan(&ws.ID, &ws.Name, &ws.Role, &ws.CreatedAt)
+		return ws, err
+	})
+}
+
+const qGetMember = `
+select
+    workspace_id, user_id, role, created_at
+from
+    shortener.workspace_members
+where
+    workspace_id = $1 and user_id = $2`
+
+func (r *Repository) GetMember(ctx context.Context, workspaceID, userID string) (entities.Member, error) {
+	var m entities.Member
+	err := r.db.QueryRow(ctx, qGetMember, workspaceID, userID).Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Member{}, entities.ErrNotFound
+	}
+	if err != nil {
+		return entities.Member{}, err
+	}
+
+	return m, nil
+}
+
+const qGetMembers = `
+select
+    workspace_id, user_id, role, created_at
+from
+    shortener.workspace_members
+where
+    workspace_id = $1
+order by created_at`
+
+func (r *Repository) GetMembers(ctx context.Context, workspaceID string) ([]entities.Member, error) {
+	rows, err := r.db.Query(ctx, qGetMembers, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (entities.Member, error) {
+		var m entities.Member
+		err := row.Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.CreatedAt)
+		return m, err
+	})
+}
+
+const qLockWorkspace = `
+select
+    1
+from
+    shortener.workspaces
+where
+    id = $1
+for update`
+
+// qChangeMember is qSetMember that keeps the role of the last owner; the
+// update then affects no row.
+const qChangeMember = `
+insert into
+    shortener.workspace_members as m (workspace_id, user_id, role, created_at)
+values
+    ($1, $2, $3, $4)
+on conflict (workspace_id, user_id) do update
+    set role = excluded.role
+    where excluded.role = 'owner' or m.role <> 'owner' or exists (
+        select 1 from shortener.workspace_members o
+        where o.workspace_id = m.workspace_id and o.role = 'owner' and o.user_id <> m.user_id)`
+
+// SetMember adds a member or changes the role of an existing one. Demoting
+// the last owner is ErrLastOwner.
+func (r *Repository) SetMember(ctx context.Context, m entities.Member) error {
+	return r.withWorkspaceLock(ctx, m.WorkspaceID, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, qChangeMember, m.WorkspaceID, m.UserID, m.Role, m.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return entities.ErrLastOwner
+		}
+
+		return nil
+	})
+}
+
+const qDeleteMember = `
+delete from
+    shortener.workspace_members m
+where
+    m.workspace_id = $1 and m.user_id = $2
+    and (m.role <> 'owner' or exists (
+        select 1 from shortener.workspace_members o
+        where o.workspace_id = $1 and o.role = 'owner' and o.user_id <> $2))`
+
+// DeleteMember removes a member and reports whether there was one. Removing
+// the last owner is ErrLastOwner.
+func (r *Repository) DeleteMember(ctx context.Context, workspaceID, userID string) (bool, error) {
+	var deleted bool
+	err := r.withWorkspaceLock(ctx, workspaceID, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, qDeleteMember, workspaceID, userID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() > 0 {
+			deleted = true
+			return nil
+		}
+
+		var role string
+		err = tx.QueryRow(ctx, qGetMember, workspaceID, userID).Scan(nil, nil, &role, nil)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return entities.ErrLastOwner
+	})
+	if errors.Is(err, entities.ErrNotFound) {
+		return false, nil
+	}
+
+	return deleted, err
+}
+
+// withWorkspaceLock runs f in a transaction holding the row lock of the
+// workspace, so that concurrent member changes cannot each see the other
+// owner and together remove both. Unknown workspaces are ErrNotFound.
+func (r *Repository) withWorkspaceLock(ctx context.Context, workspaceID string, f func(pgx.Tx) error) error {
+	return r.withTx(ctx, func(ctxTx context.Context) error {
+		tx := ctxTx.Value(txKey).(pgx.Tx)
+
+		err := tx.QueryRow(ctx, qLockWorkspace, workspaceID).Scan(nil)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entities.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		return f(tx)
+	})
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/MV7VM/url-shortener/internal/config"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
@@ -10,17 +12,59 @@ import (
 )
 
 type repository interface {
-	Set(ctx context.Context, key string, value, userID string) (string, error)
+	Set(ctx context.Context, key string, value, userID, workspaceID string) (string, error)
 	Get(ctx context.Context, s string) (string, bool, error)
+	GetOwner(ctx context.Context, s string) (string, error)
+	GetLink(ctx context.Context, s string) (entities.Item, error)
+	UpdateLink(ctx context.Context, item entities.Item) error
+	CanonicalizeURLs(ctx context.Context, canonical func(string) (string, error)) (int, error)
 	GetCount(ctx context.Context) (int, error)
-	GetUsersUrls(ctx context.Context, userID string) ([]entities.Item, error)
+	AddClicks(ctx context.Context, counts map[string]int64) error
+	GetUsersUrls(ctx context.Context, userID string, q entities.URLQuery) ([]entities.Item, error)
+	Delete(ctx context.Context, items []entities.DeleteItem) ([]entities.DeleteItem, error)
+	CreateWebhook(ctx context.Context, wh entities.Webhook) error
+	GetWebhooks(ctx context.Context, userID string) ([]entities.Webhook, error)
+	GetWebhook(ctx context.Context, id, userID string) (entities.Webhook, bool, error)
+	GetWebhooksByEvent(ctx context.Context, userID, event string) ([]entities.Webhook, error)
+	DeleteWebhook(ctx context.Context, id, userID string) (bool, error)
+	EnqueueDeliveries(ctx context.Context, deliveries []entities.WebhookDelivery) error
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, d entities.WebhookDelivery) error
+	GetDeliveries(ctx context.Context, webhookID, userID string, limit int) ([]entities.WebhookDelivery, error)
+	CreateAPIKey(ctx context.Context, key entities.APIKey) error
+	GetAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (entities.APIKey, error)
+	DeleteAPIKey(ctx context.Context, id, userID string) (bool, error)
+	CreateAccount(ctx context.Context, account entities.Account) error
+	GetAccountByEmail(ctx context.Context, email string) (entities.Account, error)
+	GetAccountByID(ctx context.Context, id string) (entities.Account, error)
+	MoveUser(ctx context.Context, from, to string) (entities.UserMove, error)
+	CreateIdentity(ctx context.Context, identity entities.Identity) error
+	GetIdentity(ctx context.Context, issuer, subject string) (entities.Identity, error)
+	GetIdentityByUserID(ctx context.Context, userID string) (entities.Identity, error)
+	CreateWorkspace(ctx context.Context, ws entities.Workspace, owner entities.Member) error
+	GetWorkspaces(ctx context.Context, userID string) ([]entities.Workspace, error)
+	GetMember(ctx context.Context, workspaceID, userID string) (entities.Member, error)
+	GetMembers(ctx context.Context, workspaceID string) ([]entities.Member, error)
+	SetMember(ctx context.Context, m entities.Member) error
+	DeleteMember(ctx context.Context, workspaceID, userID string) (bool, error)
+	SearchLinks(ctx context.Context, q entities.LinkQuery) ([]entities.Item, error)
+	SetDisabled(ctx context.Context, shortURLs []string, reason string, at *time.Time) ([]string, error)
+	AppendAudit(ctx context.Context, entries []entities.AuditEntry) error
+	QueryAudit(ctx context.Context, q entities.AuditQuery) ([]entities.AuditEntry, error)
 	OnStart(_ context.Context) error
 	OnStop(_ context.Context) error
 }
 
+// rateLimiter keeps token buckets, per replica or shared between them.
+type rateLimiter interface {
+	TakeToken(ctx context.Context, key string, limit entities.RateLimit) (entities.RateDecision, error)
+}
+
 type Repo struct {
 	repository
-	psql *postgres.Repository
+	psql    *postgres.Repository
+	limiter rateLimiter
 }
 
 func NewRepo(ctx context.Context, cfg *config.Model) (*Repo, error) {
@@ -36,9 +80,23 @@ func NewRepo(ctx context.Context, cfg *config.Model) (*Repo, error) {
 		repo = psql
 	}
 
+	var limiter rateLimiter
+	switch cfg.RateLimit.Store {
+	case "", "memory":
+		limiter = cache.NewRateLimiter()
+	case "postgres":
+		if cfg.Repo.PsqlConfig.PsqlConnString == "" {
+			return nil, fmt.Errorf("postgres rate limit store requires a database dsn")
+		}
+		limiter = psql
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimit.Store)
+	}
+
 	return &Repo{
 		repository: repo,
 		psql:       psql,
+		limiter:    limiter,
 	}, nil
 }
 
@@ -71,14 +129,30 @@ func (r *Repo) OnStop(ctx context.Context) error {
 	return nil
 }
 
-func (r *Repo) Set(ctx context.Context, key string, value, userID string) (string, error) {
-	return r.repository.Set(ctx, key, value, userID)
+func (r *Repo) Set(ctx context.Context, key string, value, userID, workspaceID string) (string, error) {
+	return r.repository.Set(ctx, key, value, userID, workspaceID)
 }
 
 func (r *Repo) Get(ctx context.Context, s string) (string, bool, error) {
 	return r.repository.Get(ctx, s)
 }
 
+func (r *Repo) GetOwner(ctx context.Context, s string) (string, error) {
+	return r.repository.GetOwner(ctx, s)
+}
+
+func (r *Repo) GetLink(ctx context.Context, s string) (entities.Item, error) {
+	return r.repository.GetLink(ctx, s)
+}
+
+func (r *Repo) UpdateLink(ctx context.Context, item entities.Item) error {
+	return r.repository.UpdateLink(ctx, item)
+}
+
+func (r *Repo) CanonicalizeURLs(ctx context.Context, canonical func(string) (string, error)) (int, error) {
+	return r.repository.CanonicalizeURLs(ctx, canonical)
+}
+
 func (r *Repo) GetCount(ctx context.Context) (int, error) {
 	return r.repository.GetCount(ctx)
 }
@@ -87,10 +161,138 @@ func (r *Repo) Ping(ctx context.Context) error {
 	return r.psql.Ping(ctx)
 }
 
-func (r *Repo) GetUsersUrls(ctx context.Context, userID string) ([]entities.Item, error) {
-	return r.repository.GetUsersUrls(ctx, userID)
+func (r *Repo) AddClicks(ctx context.Context, counts map[string]int64) error {
+	return r.repository.AddClicks(ctx, counts)
+}
+
+func (r *Repo) GetUsersUrls(ctx context.Context, userID string, q entities.URLQuery) ([]entities.Item, error) {
+	return r.repository.GetUsersUrls(ctx, userID, q)
+}
+
+func (r *Repo) Delete(ctx context.Context, items []entities.DeleteItem) ([]entities.DeleteItem, error) {
+	return r.repository.Delete(ctx, items)
+}
+
+func (r *Repo) CreateWebhook(ctx context.Context, wh entities.Webhook) error {
+	return r.repository.CreateWebhook(ctx, wh)
+}
+
+func (r *Repo) GetWebhooks(ctx context.Context, userID string) ([]entities.Webhook, error) {
+	return r.repository.GetWebhooks(ctx, userID)
+}
+
+func (r *Repo) GetWebhook(ctx context.Context, id, userID string) (entities.Webhook, bool, error) {
+	return r.repository.GetWebhook(ctx, id, userID)
+}
+
+func (r *Repo) GetWebhooksByEvent(ctx context.Context, userID, event string) ([]entities.Webhook, error) {
+	return r.repository.GetWebhooksByEvent(ctx, userID, event)
+}
+
+func (r *Repo) DeleteWebhook(ctx context.Context, id, userID string) (bool, error) {
+	return r.repository.DeleteWebhook(ctx, id, userID)
+}
+
+func (r *Repo) EnqueueDeliveries(ctx context.Context, deliveries []entities.WebhookDelivery) error {
+	return r.repository.EnqueueDeliveries(ctx, deliveries)
+}
+
+func (r *Repo) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error) {
+	return r.repository.ClaimDeliveries(ctx, now, lease, limit)
+}
+
+func (r *Repo) UpdateDelivery(ctx context.Context, d entities.WebhookDelivery) error {
+	return r.repository.UpdateDelivery(ctx, d)
+}
+
+func (r *Repo) GetDeliveries(ctx context.Context, webhookID, userID string, limit int) ([]entities.WebhookDelivery, error) {
+	return r.repository.GetDeliveries(ctx, webhookID, userID, limit)
+}
+
+func (r *Repo) CreateAPIKey(ctx context.Context, key entities.APIKey) error {
+	return r.repository.CreateAPIKey(ctx, key)
+}
+
+func (r *Repo) GetAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error) {
+	return r.repository.GetAPIKeys(ctx, userID)
+}
+
+func (r *Repo) GetAPIKeyByHash(ctx context.Context, hash string) (entities.APIKey, error) {
+	return r.repository.GetAPIKeyByHash(ctx, hash)
+}
+
+func (r *Repo) DeleteAPIKey(ctx context.Context, id, userID string) (bool, error) {
+	return r.repository.DeleteAPIKey(ctx, id, userID)
+}
+
+func (r *Repo) CreateAccount(ctx context.Context, account entities.Account) error {
+	return r.repository.CreateAccount(ctx, account)
+}
+
+func (r *Repo) GetAccountByEmail(ctx context.Context, email string) (entities.Account, error) {
+	return r.repository.GetAccountByEmail(ctx, email)
+}
+
+func (r *Repo) GetAccountByID(ctx context.Context, id string) (entities.Account, error) {
+	return r.repository.GetAccountByID(ctx, id)
+}
+
+func (r *Repo) MoveUser(ctx context.Context, from, to string) (entities.UserMove, error) {
+	return r.repository.MoveUser(ctx, from, to)
+}
+
+func (r *Repo) CreateIdentity(ctx context.Context, identity entities.Identity) error {
+	return r.repository.CreateIdentity(ctx, identity)
+}
+
+func (r *Repo) GetIdentity(ctx context.Context, issuer, subject string) (entities.Identity, error) {
+	return r.repository.GetIdentity(ctx, issuer, subject)
+}
+
+func (r *Repo) GetIdentityByUserID(ctx context.Context, userID string) (entities.Identity, error) {
+	return r.repository.GetIdentityByUserID(ctx, userID)
+}
+
+func (r *Repo) CreateWorkspace(ctx context.Context, ws entities.Workspace, owner entities.Member) error {
+	return r.repository.CreateWorkspace(ctx, ws, owner)
+}
+
+func (r *Repo) GetWorkspaces(ctx context.Context, userID string) ([]entities.Workspace, error) {
+	return r.repository.GetWorkspaces(ctx, userID)
+}
+
+func (r *Repo) GetMember(ctx context.Context, workspaceID, userID string) (entities.Member, error) {
+	return r.repository.GetMember(ctx, workspaceID, userID)
+}
+
+func (r *Repo) GetMembers(ctx context.Context, workspaceID string) ([]entities.Member, error) {
+	return r.repository.GetMembers(ctx, workspaceID)
+}
+
+func (r *Repo) SetMember(ctx context.Context, m entities.Member) error {
+	return r.repository.SetMember(ctx, m)
+}
+
+func (r *Repo) DeleteMember(ctx context.Context, workspaceID, userID string) (bool, error) {
+	return r.repository.DeleteMember(ctx, workspaceID, userID)
+}
+
+func (r *Repo) SearchLinks(ctx context.Context, q entities.LinkQuery) ([]entities.Item, error) {
+	return r.repository.SearchLinks(ctx, q)
+}
+
+func (r *Repo) SetDisabled(ctx context.Context, shortURLs []string, reason string, at *time.Time) ([]string, error) {
+	return r.repository.SetDisabled(ctx, shortURLs, reason, at)
+}
+
+func (r *Repo) AppendAudit(ctx context.Context, entries []entities.AuditEntry) error {
+	return r.repository.AppendAudit(ctx, entries)
+}
+
+func (r *Repo) QueryAudit(ctx context.Context, q entities.AuditQuery) ([]entities.AuditEntry, error) {
+	return r.repository.QueryAudit(ctx, q)
 }
 
-func (r *Repo) Delete(ctx context.Context, shortURL []string, userID string) error {
-	return r.psql.Delete(ctx, shortURL, userID)
+func (r *Repo) TakeToken(ctx context.Context, key string, limit entities.RateLimit) (entities.RateDecision, error) {
+	return r.limiter.TakeToken(ctx, key, limit)
 }
@@ -0,0 +1,217 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// -----------------------------------------------------------------------------
+// Accounts
+// -----------------------------------------------------------------------------
+
+const (
+	minPasswordLen = 8
+	// bcrypt ignores everything past 72 bytes.
+	maxPasswordLen = 72
+)
+
+var (
+	// ErrInvalidAccount is returned for malformed emails and weak passwords.
+	ErrInvalidAccount = errors.New("invalid account")
+	// ErrInvalidCredentials does not tell an unknown email from a wrong
+	// password.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrEmailTaken         = fmt.Errorf("%w: email is already registered", ErrConflict)
+)
+
+type accountRepo interface {
+	CreateAccount(ctx context.Context, account entities.Account) error
+	GetAccountByEmail(ctx context.Context, email string) (entities.Account, error)
+	GetAccountByID(ctx context.Context, id string) (entities.Account, error)
+	MoveUser(ctx context.Context, from, to string) (entities.UserMove, error)
+	CreateIdentity(ctx context.Context, identity entities.Identity) error
+	GetIdentity(ctx context.Context, issuer, subject string) (entities.Identity, error)
+	GetIdentityByUserID(ctx context.Context, userID string) (entities.Identity, error)
+}
+
+// dummyHash is compared against on unknown emails, so that a login takes as
+// long whether the account exists or not.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// SignUp registers an account and, like Login, hands it the links of the
+// caller's current identity.
+func (u *Usecase) SignUp(ctx context.Context, currentUserID, email, password string) (entities.Account, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return entities.Account{}, err
+	}
+	if len(password) < minPasswordLen || len(password) > maxPasswordLen {
+		return entities.Account{}, fmt.Errorf("%w: password must be %d to %d bytes long", ErrInvalidAccount, minPasswordLen, maxPasswordLen)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return entities.Account{}, err
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return entities.Account{}, err
+	}
+
+	account := entities.Account{
+		ID:           id.String(),
+		Email:        email,
+		PasswordHash: hash,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	err = u.accounts.CreateAccount(ctx, account)
+	if errors.Is(err, entities.ErrAlreadyExists) {
+		return entities.Account{}, ErrEmailTaken
+	}
+	if err != nil {
+		u.log.Error("failed to create account", zap.Error(err))
+		return entities.Account{}, err
+	}
+
+	u.claimLinks(ctx, currentUserID, account.ID)
+
+	return account, nil
+}
+
+// Login checks the credentials and moves the links of the caller's current
+// anonymous identity into the account.
+func (u *Usecase) Login(ctx context.Context, currentUserID, email, password string) (entities.Account, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return entities.Account{}, ErrInvalidCredentials
+	}
+
+	account, err := u.accounts.GetAccountByEmail(ctx, email)
+	if errors.Is(err, entities.ErrNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return entities.Account{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		u.log.Error("failed to get account", zap.Error(err))
+		return entities.Account{}, err
+	}
+
+	if bcrypt.CompareHashAndPassword(account.PasswordHash, []byte(password)) != nil {
+		return entities.Account{}, ErrInvalidCredentials
+	}
+
+	u.claimLinks(ctx, currentUserID, account.ID)
+
+	return account, nil
+}
+
+// LoginExternal signs in the subject of an external provider. The first
+// login creates the user the subject maps to; like Login, every login takes
+// over the links of the caller's current anonymous identity. Accounts with
+// the same email are not linked: the provider may not have verified it.
+func (u *Usecase) LoginExternal(ctx context.Context, currentUserID, issuer, subject, email string) (entities.Identity, error) {
+	identity, err := u.accounts.GetIdentity(ctx, issuer, subject)
+	if errors.Is(err, entities.ErrNotFound) {
+		identity, err = u.createIdentity(ctx, issuer, subject, email)
+	}
+	if err != nil {
+		u.log.Error("failed to get external identity", zap.String("issuer", issuer), zap.Error(err))
+		return entities.Identity{}, err
+	}
+
+	u.claimLinks(ctx, currentUserID, identity.UserID)
+
+	return identity, nil
+}
+
+func (u *Usecase) createIdentity(ctx context.Context, issuer, subject, email string) (entities.Identity, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return entities.Identity{}, err
+	}
+
+	identity := entities.Identity{
+		Issuer:    issuer,
+		Subject:   subject,
+		UserID:    id.String(),
+		Email:     strings.ToLower(email),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err = u.accounts.CreateIdentity(ctx, identity)
+	if errors.Is(err, entities.ErrAlreadyExists) {
+		// A concurrent first login won.
+		return u.accounts.GetIdentity(ctx, issuer, subject)
+	}
+	if err != nil {
+		return entities.Identity{}, err
+	}
+
+	return identity, nil
+}
+
+// claimLinks moves the links, webhooks, API keys and deletion jobs of an
+// anonymous identity to a registered user. Data of another registered user
+// is never taken over, nor is a failure fatal to the login: it stays with the
+// old identity.
+func (u *Usecase) claimLinks(ctx context.Context, from, to string) {
+	if from == "" || from == to {
+		return
+	}
+
+	registered, err := u.registered(ctx, from)
+	if err != nil {
+		u.log.Error("failed to check account", zap.Error(err))
+		return
+	}
+	if registered {
+		return
+	}
+
+	moved, err := u.accounts.MoveUser(ctx, from, to)
+	if err != nil {
+		u.log.Error("failed to move links to account", zap.String("account", to), zap.Error(err))
+		return
+	}
+	jobs := u.deletions.reassign(from, to)
+
+	if moved != (entities.UserMove{}) || jobs > 0 {
+		u.log.Info("links moved to account", zap.String("account", to), zap.Int64("links", moved.URLs),
+			zap.Int64("webhooks", moved.Webhooks), zap.Int64("api_keys", moved.APIKeys), zap.Int("jobs", jobs))
+	}
+}
+
+// registered reports whether userID is an account or an external identity.
+func (u *Usecase) registered(ctx context.Context, userID string) (bool, error) {
+	_, err := u.accounts.GetAccountByID(ctx, userID)
+	if !errors.Is(err, entities.ErrNotFound) {
+		return err == nil, err
+	}
+
+	_, err = u.accounts.GetIdentityByUserID(ctx, userID)
+	if !errors.Is(err, entities.ErrNotFound) {
+		return err == nil, err
+	}
+
+	return false, nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || addr.Name != "" {
+		return "", fmt.Errorf("%w: malformed email", ErrInvalidAccount)
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
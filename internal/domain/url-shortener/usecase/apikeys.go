@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+)
+
+// -----------------------------------------------------------------------------
+// API keys
+// -----------------------------------------------------------------------------
+
+const (
+	// APIKeyPrefix marks API keys so that they are told apart from JWTs in an
+	// Authorization header and are easy to find by secret scanners.
+	APIKeyPrefix = "shk_"
+
+	apiKeySize       = 32
+	apiKeyShownChars = 12
+	apiKeyNameMax    = 100
+)
+
+var (
+	ErrAPIKeyNotFound = fmt.Errorf("api key %w", ErrNotFound)
+	// ErrInvalidAPIKey is returned for unknown, revoked or malformed keys.
+	ErrInvalidAPIKey = errors.New("invalid api key")
+)
+
+type apiKeyRepo interface {
+	CreateAPIKey(ctx context.Context, key entities.APIKey) error
+	GetAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (entities.APIKey, error)
+	DeleteAPIKey(ctx context.Context, id, userID string) (bool, error)
+}
+
+// CreateAPIKey issues a key acting as userID. The returned key is the only
+// place the plain key appears, the store keeps its hash.
+func (u *Usecase) CreateAPIKey(ctx context.Context, userID, name string, readOnly bool) (entities.APIKey, error) {
+	// Long names are cut on a character boundary, the store refuses broken
+	// UTF-8.
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > apiKeyNameMax {
+		name = string([]rune(name)[:apiKeyNameMax])
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return entities.APIKey{}, err
+	}
+
+	secret := make([]byte, apiKeySize)
+	if _, err = rand.Read(secret); err != nil {
+		return entities.APIKey{}, err
+	}
+	raw := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := entities.APIKey{
+		ID:        id.String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:apiKeyShownChars],
+		Hash:      hashAPIKey(raw),
+		ReadOnly:  readOnly,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err = u.apiKeys.CreateAPIKey(ctx, key); err != nil {
+		u.log.Error("failed to create api key", zap.Error(err))
+		return entities.APIKey{}, err
+	}
+
+	key.Key = raw
+	return key, nil
+}
+
+func (u *Usecase) GetAPIKeys(ctx context.Context, userID string) ([]entities.APIKey, error) {
+	keys, err := u.apiKeys.GetAPIKeys(ctx, userID)
+	if err != nil {
+		u.log.Error("failed to get api keys", zap.Error(err))
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (u *Usecase) RevokeAPIKey(ctx context.Context, id, userID string) error {
+	found, err := u.apiKeys.DeleteAPIKey(ctx, id, userID)
+	if err != nil {
+		u.log.Error("failed to revoke api key", zap.String("key", id), zap.Error(err))
+		return err
+	}
+
+	if !found {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey resolves a plain key to the stored one. Unknown keys
+// fail with ErrInvalidAPIKey.
+func (u *Usecase) AuthenticateAPIKey(ctx context.Context, raw string) (entities.APIKey, error) {
+	if !strings.HasPrefix(raw, APIKeyPrefix) {
+		return entities.APIKey{}, ErrInvalidAPIKey
+	}
+
+	key, err := u.apiKeys.GetAPIKeyByHash(ctx, hashAPIKey(raw))
+	if errors.Is(err, entities.ErrNotFound) {
+		return entities.APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		u.log.Error("failed to look up api key", zap.Error(err))
+		return entities.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// hashAPIKey needs no salt or stretching: keys are random 256 bit values,
+// not passwords.
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
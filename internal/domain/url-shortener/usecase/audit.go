@@ -0,0 +1,171 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+)
+
+// -----------------------------------------------------------------------------
+// Audit log
+// -----------------------------------------------------------------------------
+
+// auditHistorySize bounds the history of a link returned at once.
+const auditHistorySize = 100
+
+type auditRepo interface {
+	AppendAudit(ctx context.Context, entries []entities.AuditEntry) error
+	QueryAudit(ctx context.Context, q entities.AuditQuery) ([]entities.AuditEntry, error)
+}
+
+// requestIDMax bounds the request ids taken from clients.
+const requestIDMax = 128
+
+// ValidRequestID reports whether a request id sent by a client is sane
+// enough to be kept for the audit log: short printable ASCII.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMax {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// auditState holds the fields of a link an action changed.
+type auditState map[string]any
+
+// auditChange is what an action did to one link.
+type auditChange struct {
+	target        string
+	before, after auditState
+}
+
+// record appends an entry per change made by actorID in the request of ctx.
+// The changes are already stored, so a failure is only logged.
+func (u *Usecase) record(ctx context.Context, action, actorID, reason string, changes []auditChange) {
+	if u.audit == nil || len(changes) == 0 {
+		return
+	}
+
+	req := entities.RequestInfoFrom(ctx)
+	now := time.Now().UTC()
+
+	entries := make([]entities.AuditEntry, 0, len(changes))
+	for _, change := range changes {
+		id, err := uuid.NewV7()
+		if err != nil {
+			u.log.Error("failed to create audit entry id", zap.Error(err))
+			return
+		}
+
+		entries = append(entries, entities.AuditEntry{
+			ID:        id.String(),
+			Action:    action,
+			ActorID:   actorID,
+			Target:    change.target,
+			Reason:    reason,
+			IP:        req.IP,
+			RequestID: req.RequestID,
+			Before:    change.before.encode(),
+			After:     change.after.encode(),
+			CreatedAt: now,
+		})
+	}
+
+	if err := u.audit.AppendAudit(ctx, entries); err != nil {
+		u.log.Error("failed to append audit entries", zap.String("action", action), zap.Int("entries", len(entries)), zap.Error(err))
+	}
+}
+
+func (s auditState) encode() json.RawMessage {
+	if s == nil {
+		return nil
+	}
+
+	data, _ := json.Marshal(s)
+	return data
+}
+
+// QueryAudit returns one page of the audit log matching q, newest first.
+func (u *Usecase) QueryAudit(ctx context.Context, adminID string, q entities.AuditQuery) (entities.AuditPage, error) {
+	if !u.IsAdmin(adminID) {
+		return entities.AuditPage{}, ErrNotAdmin
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = defaultPageSize
+	case q.Limit > maxPageSize:
+		q.Limit = maxPageSize
+	}
+
+	if q.Cursor != "" {
+		after, err := decodeAuditCursor(q.Cursor)
+		if err != nil {
+			return entities.AuditPage{}, ErrInvalidCursor
+		}
+		q.After = &after
+	}
+
+	limit := q.Limit
+	q.Limit++
+
+	entries, err := u.audit.QueryAudit(ctx, q)
+	if err != nil {
+		u.log.Error("failed to query audit", zap.Error(err))
+		return entities.AuditPage{}, err
+	}
+
+	page := entities.AuditPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		last := page.Entries[limit-1]
+		page.Next = encodeAuditCursor(entities.AuditCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	return page, nil
+}
+
+// GetAudit returns the latest history of a link, newest first.
+func (u *Usecase) GetAudit(ctx context.Context, adminID, shortURL string) ([]entities.AuditEntry, error) {
+	page, err := u.QueryAudit(ctx, adminID, entities.AuditQuery{Target: shortURL, Limit: auditHistorySize})
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Entries, nil
+}
+
+func encodeAuditCursor(c entities.AuditCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeAuditCursor(s string) (entities.AuditCursor, error) {
+	var c entities.AuditCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+
+	if err = json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	if c.ID == "" {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
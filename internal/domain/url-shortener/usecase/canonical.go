@@ -0,0 +1,229 @@
+package usecase
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// -----------------------------------------------------------------------------
+// URL canonicalization
+// -----------------------------------------------------------------------------
+
+// defaultPorts are dropped from canonical URLs.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// trackingParams are the click ids of ad and mail networks. utm_* parameters
+// are tracking parameters too.
+var trackingParams = map[string]struct{}{
+	"fbclid": {}, "gclid": {}, "dclid": {}, "gbraid": {}, "wbraid": {}, "msclkid": {},
+	"yclid": {}, "igshid": {}, "mc_cid": {}, "mc_eid": {}, "_ga": {}, "_gl": {},
+}
+
+// canonicalURL is the form links are stored and deduplicated in, so that
+// spellings of one destination share a short link: http is the default
+// scheme, the host is lowercase ASCII with internationalized names in
+// punycode, default ports and the root dot are dropped, an empty path is
+// "/", and percent-encoding is in upper case and only where needed. With
+// stripTracking, tracking parameters are removed from the query; the order
+// of the other parameters is kept since servers may depend on it.
+func canonicalURL(rawURL string, stripTracking bool) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Scheme == "" {
+		u, err = url.Parse("http://" + rawURL)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%w: unsupported scheme %q", ErrInvalidURL, u.Scheme)
+	}
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+
+	var b strings.Builder
+	b.WriteString(u.Scheme + "://")
+	if u.User != nil {
+		b.WriteString(u.User.String() + "@")
+	}
+	b.WriteString(host)
+
+	path := normalizeEscapes(u.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+
+	if query := canonicalQuery(u.RawQuery, stripTracking); query != "" {
+		b.WriteString("?" + query)
+	}
+	if fragment := normalizeEscapes(u.EscapedFragment()); fragment != "" {
+		b.WriteString("#" + fragment)
+	}
+
+	return b.String(), nil
+}
+
+// ValidURL reports whether rawURL is an http or https URL with a host; a
+// missing scheme means http. The transports check links with it before
+// handing them over.
+func ValidURL(urlStr string) bool {
+	urlStr = strings.TrimSpace(urlStr)
+	if urlStr == "" {
+		return false
+	}
+
+	// Пытаемся распарсить URL
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+
+	// Если нет схемы, добавляем http:// и пытаемся снова
+	if u.Scheme == "" {
+		u, err = url.Parse("http://" + urlStr)
+		if err != nil {
+			return false
+		}
+	}
+
+	// Проверяем, что есть host
+	if u.Host == "" {
+		return false
+	}
+
+	// Проверяем, что схема поддерживается
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	return true
+}
+
+// storedURL canonicalizes links stored before canonicalization. Tracking
+// parameters are kept: destinations already handed out are not changed
+// beyond their spelling.
+func storedURL(rawURL string) (string, error) {
+	return canonicalURL(rawURL, false)
+}
+
+func canonicalHost(host string) (string, error) {
+	if strings.Contains(host, ":") {
+		return "[" + strings.ToLower(host) + "]", nil
+	}
+
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", fmt.Errorf("%w: no host", ErrInvalidURL)
+	}
+
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			ascii, err := idna.Lookup.ToASCII(host)
+			if err != nil {
+				return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+			}
+			return ascii, nil
+		}
+	}
+
+	return strings.ToLower(host), nil
+}
+
+func canonicalQuery(rawQuery string, stripTracking bool) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+		param = normalizeEscapes(param)
+		if stripTracking && trackingParam(param) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+
+	return strings.Join(kept, "&")
+}
+
+func trackingParam(param string) bool {
+	key, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		key = unescaped
+	}
+	key = strings.ToLower(key)
+
+	if strings.HasPrefix(key, "utm_") {
+		return true
+	}
+	_, ok := trackingParams[key]
+
+	return ok
+}
+
+// normalizeEscapes decodes escaped unreserved characters, upper-cases the
+// other escapes and escapes spaces, control and non-ASCII bytes.
+func normalizeEscapes(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && ishex(s[i+1]) && ishex(s[i+2]):
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if unreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(hex[decoded>>4])
+				b.WriteByte(hex[decoded&0x0f])
+			}
+			i += 2
+		case c <= ' ' || c >= 0x7f:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0x0f])
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func unreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func ishex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,342 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"go.uber.org/zap"
+)
+
+// -----------------------------------------------------------------------------
+// Live click stream (in-process pub/sub)
+// -----------------------------------------------------------------------------
+
+const (
+	defaultSubscriberBuffer = 64
+	defaultClickQueue       = 1024
+	defaultClickFlush       = 5 * time.Second
+)
+
+// clickHub fans click events out to the live subscribers of the link owner.
+// Every subscriber has its own bounded buffer: when it is full the event is
+// dropped for that subscriber only, so a slow consumer never stalls redirects.
+type clickHub struct {
+	mu          sync.RWMutex
+	subs        map[string]map[*clickSubscriber]struct{}
+	buffer      int
+	subscribers atomic.Int64
+}
+
+type clickSubscriber struct {
+	ch      chan entities.ClickEvent
+	dropped atomic.Uint64
+}
+
+func newClickHub(buffer int) *clickHub {
+	if buffer <= 0 {
+		buffer = defaultSubscriberBuffer
+	}
+
+	return &clickHub{
+		subs:   make(map[string]map[*clickSubscriber]struct{}),
+		buffer: buffer,
+	}
+}
+
+// active reports whether anyone listens at all, letting the click feed skip
+// the owner lookup when there is nobody to notify.
+func (h *clickHub) active() bool {
+	return h != nil && h.subscribers.Load() > 0
+}
+
+func (h *clickHub) subscribe(userID string) *clickSubscriber {
+	sub := &clickSubscriber{ch: make(chan entities.ClickEvent, h.buffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*clickSubscriber]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	h.subscribers.Add(1)
+
+	return sub
+}
+
+// unsubscribe removes the subscriber and closes its channel. It is safe to
+// call more than once.
+func (h *clickHub) unsubscribe(userID string, sub *clickSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[userID][sub]; !ok {
+		return
+	}
+
+	delete(h.subs[userID], sub)
+	if len(h.subs[userID]) == 0 {
+		delete(h.subs, userID)
+	}
+	h.subscribers.Add(-1)
+	close(sub.ch)
+}
+
+func (h *clickHub) publish(event entities.ClickEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subs[event.UserID] {
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// SubscribeClicks streams click events on the links owned by userID until the
+// returned cancel function is called.
+func (u *Usecase) SubscribeClicks(userID string) (<-chan entities.ClickEvent, func()) {
+	sub := u.clicks.subscribe(userID)
+
+	return sub.ch, func() {
+		u.clicks.unsubscribe(userID, sub)
+		if dropped := sub.dropped.Load(); dropped > 0 {
+			u.log.Warn("slow click stream subscriber",
+				zap.String("userID", userID), zap.Uint64("dropped", dropped))
+		}
+	}
+}
+
+// clickFeed carries clicks from the redirect path to a background worker that
+// notifies the link owner, so redirects never wait for the owner and webhook
+// lookups. When the buffer is full the click is not notified.
+type clickFeed struct {
+	log    *zap.Logger
+	fanOut func(entities.ClickEvent)
+
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan entities.ClickEvent
+	dropped atomic.Uint64
+	done    chan struct{}
+}
+
+func newClickFeed(l *zap.Logger, cfg *config.Model, fanOut func(entities.ClickEvent)) *clickFeed {
+	size := cfg.Clicks.QueueSize
+	if size <= 0 {
+		size = defaultClickQueue
+	}
+
+	return &clickFeed{
+		log:    l.Named("clicks"),
+		fanOut: fanOut,
+		queue:  make(chan entities.ClickEvent, size),
+		done:   make(chan struct{}),
+	}
+}
+
+func (f *clickFeed) start() {
+	if f == nil {
+		return
+	}
+
+	go func() {
+		defer close(f.done)
+
+		for event := range f.queue {
+			f.fanOut(event)
+		}
+	}()
+}
+
+// shutdown stops accepting clicks and waits until the queued ones are
+// notified.
+func (f *clickFeed) shutdown(ctx context.Context) error {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.queue)
+	}
+	f.mu.Unlock()
+
+	if dropped := f.dropped.Load(); dropped > 0 {
+		f.log.Warn("click notifications dropped", zap.Uint64("dropped", dropped))
+	}
+
+	select {
+	case <-f.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *clickFeed) push(event entities.ClickEvent) {
+	if f == nil {
+		return
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return
+	}
+
+	select {
+	case f.queue <- event:
+	default:
+		f.dropped.Add(1)
+	}
+}
+
+type clickRepo interface {
+	AddClicks(ctx context.Context, counts map[string]int64) error
+}
+
+// clickCounter sums clicks in memory and a background loop adds them to the
+// repository every FlushInterval with one write, so redirects do not write.
+// Counts that fail to flush are kept for the next flush; on shutdown the
+// pending counts are flushed.
+type clickCounter struct {
+	log      *zap.Logger
+	repo     clickRepo
+	interval time.Duration
+
+	mu     sync.Mutex
+	counts map[string]int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newClickCounter(l *zap.Logger, cfg *config.Model, repo clickRepo) *clickCounter {
+	interval := cfg.Clicks.FlushInterval
+	if interval <= 0 {
+		interval = defaultClickFlush
+	}
+
+	return &clickCounter{
+		log:      l.Named("clicks"),
+		repo:     repo,
+		interval: interval,
+		counts:   make(map[string]int64),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (c *clickCounter) start() {
+	if c == nil {
+		return
+	}
+
+	go func() {
+		defer close(c.done)
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stop:
+				c.flush(context.Background())
+				return
+			case <-ticker.C:
+				c.flush(context.Background())
+			}
+		}
+	}()
+}
+
+// shutdown stops the loop after a last flush.
+func (c *clickCounter) shutdown(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+
+	close(c.stop)
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *clickCounter) add(shortURL string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.counts[shortURL]++
+	c.mu.Unlock()
+}
+
+func (c *clickCounter) flush(ctx context.Context) {
+	c.mu.Lock()
+	counts := c.counts
+	c.counts = make(map[string]int64)
+	c.mu.Unlock()
+
+	if len(counts) == 0 {
+		return
+	}
+
+	if err := c.repo.AddClicks(ctx, counts); err != nil {
+		c.log.Error("failed to count clicks", zap.Int("links", len(counts)), zap.Error(err))
+
+		c.mu.Lock()
+		for shortURL, n := range counts {
+			c.counts[shortURL] += n
+		}
+		c.mu.Unlock()
+	}
+}
+
+// publishClick hands the click to the feed without blocking the redirect.
+func (u *Usecase) publishClick(shortURL, originalURL string) {
+	u.feed.push(entities.ClickEvent{
+		ShortURL:    shortURL,
+		OriginalURL: originalURL,
+		Timestamp:   time.Now().UTC(),
+	})
+}
+
+// fanOutClick notifies live subscribers and click webhooks of the link owner.
+func (u *Usecase) fanOutClick(event entities.ClickEvent) {
+	if !u.clicks.active() && u.webhooks == nil {
+		return
+	}
+
+	ctx := context.Background()
+
+	owner, err := u.repo.GetOwner(ctx, event.ShortURL)
+	if err != nil {
+		u.log.Error("failed to get url owner", zap.String("url", event.ShortURL), zap.Error(err))
+		return
+	}
+
+	if owner == "" {
+		return
+	}
+
+	event.UserID = owner
+	if u.clicks.active() {
+		u.clicks.publish(event)
+	}
+
+	u.webhooks.enqueue(ctx, entities.EventLinkClicked, owner, event.ShortURL, event.OriginalURL)
+}
@@ -0,0 +1,409 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+)
+
+// -----------------------------------------------------------------------------
+// Asynchronous deletion jobs
+// -----------------------------------------------------------------------------
+
+const (
+	defaultDeleteBatch = 1000
+	sweepInterval      = time.Minute
+)
+
+var (
+	ErrDeletionQueueFull = errors.New("deletion queue is full")
+	ErrDeletionStopped   = errors.New("deletion queue is stopped")
+	ErrJobNotFound       = fmt.Errorf("job %w", ErrNotFound)
+)
+
+type deletionRepo interface {
+	Delete(ctx context.Context, items []entities.DeleteItem) ([]entities.DeleteItem, error)
+}
+
+type deletionJob struct {
+	entities.DeletionJob
+	shortURL []string
+	// request is the request that created the job, for the audit log.
+	request entities.RequestInfo
+}
+
+// deletionChunk is the part of a job that fits into one flush.
+type deletionChunk struct {
+	job      *deletionJob
+	shortURL []string
+	// userID is the owner of the job when the chunk was flushed; a login may
+	// reassign the job while the repository deletes.
+	userID string
+}
+
+// deletionQueue is a fan-in pipeline: accepted jobs go to a single collector
+// that accumulates them for BatchWindow or until BatchSize urls are collected,
+// and a pool of workers flushes every batch with one multi-user UPDATE. On
+// shutdown the collector drains the queue, so accepted jobs are not lost.
+//
+// Jobs live in the memory of the instance that accepted them: the job id is
+// only valid there and does not survive a restart, whatever the storage.
+type deletionQueue struct {
+	log     *zap.Logger
+	repo    deletionRepo
+	cfg     config.DeletionConfig
+	deleted func(context.Context, []entities.DeleteItem)
+
+	mu        sync.RWMutex
+	jobs      map[string]*deletionJob
+	closed    bool
+	lastSweep time.Time
+
+	queue   chan *deletionJob
+	batches chan []deletionChunk
+	wg      sync.WaitGroup
+}
+
+func newDeletionQueue(l *zap.Logger, cfg *config.Model, repo deletionRepo, deleted func(context.Context, []entities.DeleteItem)) *deletionQueue {
+	size := cfg.Deletion.QueueSize
+	if size <= 0 {
+		size = 1
+	}
+
+	return &deletionQueue{
+		log:     l.Named("deletion"),
+		repo:    repo,
+		cfg:     cfg.Deletion,
+		deleted: deleted,
+		jobs:    make(map[string]*deletionJob),
+		queue:   make(chan *deletionJob, size),
+		batches: make(chan []deletionChunk),
+	}
+}
+
+func (d *deletionQueue) start() {
+	if d == nil {
+		return
+	}
+
+	workers := d.cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	d.wg.Add(workers + 1)
+	go d.collect()
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+}
+
+// shutdown rejects new jobs and waits until the collector has drained the
+// queue and the workers have applied every accepted job.
+func (d *deletionQueue) shutdown(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *deletionQueue) enqueue(shortURL []string, userID string, request entities.RequestInfo) (entities.DeletionJob, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return entities.DeletionJob{}, err
+	}
+
+	job := &deletionJob{
+		DeletionJob: entities.DeletionJob{
+			ID:        id.String(),
+			UserID:    userID,
+			Status:    entities.JobQueued,
+			Total:     len(shortURL),
+			CreatedAt: time.Now().UTC(),
+		},
+		shortURL: shortURL,
+		request:  request,
+	}
+
+	if job.Total == 0 {
+		job.Status = entities.JobDone
+		job.FinishedAt = &job.CreatedAt
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return entities.DeletionJob{}, ErrDeletionStopped
+	}
+
+	if job.Total == 0 {
+		d.jobs[job.ID] = job
+		return job.DeletionJob, nil
+	}
+
+	select {
+	case d.queue <- job:
+	default:
+		return entities.DeletionJob{}, ErrDeletionQueueFull
+	}
+
+	d.jobs[job.ID] = job
+	d.sweep(job.CreatedAt)
+
+	return job.DeletionJob, nil
+}
+
+func (d *deletionQueue) get(id, userID string) (entities.DeletionJob, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	job, ok := d.jobs[id]
+	if !ok || job.UserID != userID {
+		return entities.DeletionJob{}, ErrJobNotFound
+	}
+
+	return job.DeletionJob, nil
+}
+
+// reassign hands the jobs of from over to to, so that to follows their
+// progress and pending deletions apply to the links moved with them.
+func (d *deletionQueue) reassign(from, to string) int {
+	if d == nil {
+		return 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	moved := 0
+	for _, job := range d.jobs {
+		if job.UserID == from {
+			job.UserID = to
+			moved++
+		}
+	}
+
+	return moved
+}
+
+// sweep forgets finished jobs older than JobTTL. It must be called with mu held.
+func (d *deletionQueue) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < sweepInterval {
+		return
+	}
+	d.lastSweep = now
+
+	for id, job := range d.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > d.cfg.JobTTL {
+			delete(d.jobs, id)
+		}
+	}
+}
+
+func (d *deletionQueue) batchSize() int {
+	if d.cfg.BatchSize <= 0 {
+		return defaultDeleteBatch
+	}
+
+	return d.cfg.BatchSize
+}
+
+// collect accumulates queued jobs into batches. A batch is handed to the
+// workers when it reaches BatchSize urls or BatchWindow after its first url,
+// whichever comes first; jobs larger than BatchSize are split.
+func (d *deletionQueue) collect() {
+	defer d.wg.Done()
+	defer close(d.batches)
+
+	var (
+		batch   []deletionChunk
+		size    int
+		timer   *time.Timer
+		timeout <-chan time.Time
+	)
+
+	handOff := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+
+		if len(batch) > 0 {
+			d.batches <- batch
+			batch, size = nil, 0
+		}
+	}
+
+	for {
+		select {
+		case job, ok := <-d.queue:
+			if !ok {
+				handOff()
+				return
+			}
+
+			for urls := job.shortURL; len(urls) > 0; {
+				n := min(d.batchSize()-size, len(urls))
+				batch = append(batch, deletionChunk{job: job, shortURL: urls[:n]})
+				size += n
+				urls = urls[n:]
+
+				if size >= d.batchSize() {
+					handOff()
+				}
+			}
+
+			if len(batch) > 0 && timer == nil {
+				timer = time.NewTimer(d.cfg.BatchWindow)
+				timeout = timer.C
+			}
+		case <-timeout:
+			timer, timeout = nil, nil
+			handOff()
+		}
+	}
+}
+
+func (d *deletionQueue) work() {
+	defer d.wg.Done()
+
+	for batch := range d.batches {
+		d.flush(batch)
+	}
+}
+
+// flush applies a batch with a single repository call and updates the
+// progress of the jobs it contains.
+func (d *deletionQueue) flush(batch []deletionChunk) {
+	ctx := context.Background()
+
+	items := make([]entities.DeleteItem, 0, d.batchSize())
+
+	d.mu.Lock()
+	for i, chunk := range batch {
+		chunk.job.Status = entities.JobRunning
+		batch[i].userID = chunk.job.UserID
+		for _, shortURL := range chunk.shortURL {
+			items = append(items, entities.DeleteItem{ShortURL: shortURL, UserID: batch[i].userID})
+		}
+	}
+	d.mu.Unlock()
+
+	deleted, err := d.repo.Delete(ctx, items)
+	if err != nil {
+		d.log.Error("failed to delete urls", zap.Int("chunks", len(batch)), zap.Int("urls", len(items)), zap.Error(err))
+	}
+
+	pending := make(map[entities.DeleteItem]struct{}, len(deleted))
+	for _, item := range deleted {
+		pending[item] = struct{}{}
+	}
+
+	now := time.Now().UTC()
+	// chunkDeleted are the links each chunk deleted, reported with the
+	// request of its job.
+	chunkDeleted := make([][]entities.DeleteItem, len(batch))
+
+	d.mu.Lock()
+	for i, chunk := range batch {
+		job := chunk.job
+		job.Processed += len(chunk.shortURL)
+
+		if err != nil {
+			job.Failed += len(chunk.shortURL)
+			job.Error = "failed to delete urls"
+		} else {
+			for _, shortURL := range chunk.shortURL {
+				item := entities.DeleteItem{ShortURL: shortURL, UserID: chunk.userID}
+				if _, ok := pending[item]; ok {
+					delete(pending, item)
+					chunkDeleted[i] = append(chunkDeleted[i], item)
+					job.Deleted++
+				} else {
+					job.Skipped++
+				}
+			}
+		}
+
+		if job.Processed < job.Total {
+			continue
+		}
+
+		job.FinishedAt = &now
+		job.Status = entities.JobDone
+		if job.Failed > 0 {
+			job.Status = entities.JobFailed
+		}
+	}
+	d.mu.Unlock()
+
+	if d.deleted == nil {
+		return
+	}
+	for i, items := range chunkDeleted {
+		if len(items) > 0 {
+			d.deleted(entities.WithRequestInfo(ctx, batch[i].job.request), items)
+		}
+	}
+}
+
+// EnqueueDeletion accepts the user's links for asynchronous deletion and
+// returns the job tracking it.
+func (u *Usecase) EnqueueDeletion(ctx context.Context, shortURL []string, userID string) (entities.DeletionJob, error) {
+	job, err := u.deletions.enqueue(shortURL, userID, entities.RequestInfoFrom(ctx))
+	if err != nil {
+		u.log.Error("failed to enqueue deletion", zap.Error(err))
+		return entities.DeletionJob{}, err
+	}
+
+	return job, nil
+}
+
+func (u *Usecase) GetDeletionJob(_ context.Context, id, userID string) (entities.DeletionJob, error) {
+	return u.deletions.get(id, userID)
+}
+
+// emitDeleted notifies webhooks and records the deletions; items are deleted
+// by their UserID.
+func (u *Usecase) emitDeleted(ctx context.Context, items []entities.DeleteItem) {
+	changes := make(map[string][]auditChange)
+	for _, item := range items {
+		u.webhooks.enqueue(ctx, entities.EventLinkDeleted, item.UserID, item.ShortURL, "")
+		changes[item.UserID] = append(changes[item.UserID], auditChange{
+			target: item.ShortURL,
+			before: auditState{"is_deleted": false},
+			after:  auditState{"is_deleted": true},
+		})
+	}
+
+	for userID, userChanges := range changes {
+		u.record(ctx, entities.AuditLinkDeleted, userID, "", userChanges)
+	}
+}
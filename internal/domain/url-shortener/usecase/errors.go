@@ -0,0 +1,49 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+)
+
+// -----------------------------------------------------------------------------
+// Domain errors
+// -----------------------------------------------------------------------------
+
+// Kinds of failures the delivery layers translate into protocol answers.
+// Specific errors wrap one of them, so callers match with errors.Is; anything
+// else is an internal failure whose text must not reach clients.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrDeleted    = errors.New("deleted")
+	ErrDisabled   = errors.New("disabled")
+	ErrConflict   = errors.New("conflict")
+	ErrInvalidURL = errors.New("invalid url")
+	ErrForbidden  = errors.New("forbidden")
+	// ErrInvalidQuery covers malformed listing parameters and cursors.
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// ErrLinkNotFound is returned for short URLs that were never issued.
+var ErrLinkNotFound = fmt.Errorf("link %w", ErrNotFound)
+
+// ErrLinkExpired is returned for links whose expiry passed; like deleted
+// links they are gone.
+var ErrLinkExpired = fmt.Errorf("link expired: %w", ErrDeleted)
+
+// ErrURLTaken is returned when a link is edited to an original URL that
+// another link already has.
+var ErrURLTaken = fmt.Errorf("%w: the url is already shortened", ErrConflict)
+
+// LinkDisabledError is returned for links a moderator disabled; Reason is
+// shown to visitors instead of redirecting them.
+type LinkDisabledError struct {
+	Reason string
+}
+
+func (e *LinkDisabledError) Error() string {
+	return "link disabled: " + e.Reason
+}
+
+func (e *LinkDisabledError) Unwrap() error {
+	return ErrDisabled
+}
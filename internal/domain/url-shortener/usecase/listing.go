@@ -0,0 +1,123 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"go.uber.org/zap"
+)
+
+// -----------------------------------------------------------------------------
+// Paginated listing of user links
+// -----------------------------------------------------------------------------
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+var ErrInvalidCursor = fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+
+// GetUsersUrls returns one page of the user's links, or of the links of
+// q.Workspace to its members; with q.All, all of them. The next page
+// continues after the last returned link, so concurrent inserts never shift
+// pages.
+func (u *Usecase) GetUsersUrls(ctx context.Context, userID string, q entities.URLQuery) (entities.URLPage, error) {
+	if q.Workspace != "" {
+		if _, err := u.role(ctx, q.Workspace, userID); err != nil {
+			return entities.URLPage{}, err
+		}
+	}
+
+	if q.Sort == "" {
+		q.Sort = entities.SortCreatedAt
+	}
+	if q.Sort != entities.SortCreatedAt && q.Sort != entities.SortClicks {
+		return entities.URLPage{}, fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, q.Sort)
+	}
+
+	if q.All {
+		q.Limit, q.Cursor = 0, ""
+		urls, err := u.repo.GetUsersUrls(ctx, userID, q)
+		if err != nil {
+			u.log.Error("failed to get users urls", zap.Error(err))
+			return entities.URLPage{}, err
+		}
+		return entities.URLPage{Items: urls}, nil
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = defaultPageSize
+	case q.Limit > maxPageSize:
+		q.Limit = maxPageSize
+	}
+
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return entities.URLPage{}, ErrInvalidCursor
+		}
+		if after.Sort != q.Sort || after.Desc != q.Desc {
+			return entities.URLPage{}, fmt.Errorf("%w: cursor belongs to another order", ErrInvalidQuery)
+		}
+		q.After = &after
+	}
+
+	// One extra link tells whether there is a next page.
+	limit := q.Limit
+	q.Limit++
+
+	urls, err := u.repo.GetUsersUrls(ctx, userID, q)
+	if err != nil {
+		u.log.Error("failed to get users urls", zap.Error(err))
+		return entities.URLPage{}, err
+	}
+
+	return newPage(urls, limit, q.Sort, q.Desc), nil
+}
+
+// newPage cuts the links fetched with one extra down to limit and points the
+// next cursor at the last one kept.
+func newPage(urls []entities.Item, limit int, sort string, desc bool) entities.URLPage {
+	page := entities.URLPage{Items: urls}
+	if len(urls) > limit {
+		page.Items = urls[:limit]
+		last := page.Items[limit-1]
+		page.Next = encodeCursor(entities.URLCursor{
+			Sort:      sort,
+			Desc:      desc,
+			CreatedAt: last.CreatedAt,
+			Clicks:    last.Clicks,
+			ShortURL:  last.ShortURL,
+		})
+	}
+
+	return page
+}
+
+func encodeCursor(c entities.URLCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (entities.URLCursor, error) {
+	var c entities.URLCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+
+	if err = json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	if c.ShortURL == "" {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
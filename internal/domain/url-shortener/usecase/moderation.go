@@ -0,0 +1,251 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"go.uber.org/zap"
+)
+
+// -----------------------------------------------------------------------------
+// Moderation
+// -----------------------------------------------------------------------------
+
+const reasonMax = 500
+
+var (
+	ErrNotAdmin = fmt.Errorf("%w: admin role required", ErrForbidden)
+	// ErrInvalidModeration is returned for missing reasons and malformed
+	// domains.
+	ErrInvalidModeration = errors.New("invalid moderation")
+)
+
+type moderationRepo interface {
+	SearchLinks(ctx context.Context, q entities.LinkQuery) ([]entities.Item, error)
+	SetDisabled(ctx context.Context, shortURLs []string, reason string, at *time.Time) ([]string, error)
+}
+
+// IsAdmin reports whether userID has the admin role.
+func (u *Usecase) IsAdmin(userID string) bool {
+	_, ok := u.admins[userID]
+	return ok
+}
+
+// SearchLinks returns one page of the links of all users matching q, newest
+// first.
+func (u *Usecase) SearchLinks(ctx context.Context, adminID string, q entities.LinkQuery) (entities.URLPage, error) {
+	if !u.IsAdmin(adminID) {
+		return entities.URLPage{}, ErrNotAdmin
+	}
+
+	if q.Domain != "" {
+		domain, err := normalizeDomain(q.Domain)
+		if err != nil {
+			return entities.URLPage{}, fmt.Errorf("%w: malformed domain %q", ErrInvalidQuery, q.Domain)
+		}
+		q.Domain = domain
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = defaultPageSize
+	case q.Limit > maxPageSize:
+		q.Limit = maxPageSize
+	}
+
+	if q.Cursor != "" {
+		after, err := decodeCursor(q.Cursor)
+		if err != nil || after.Sort != entities.SortCreatedAt || !after.Desc {
+			return entities.URLPage{}, ErrInvalidCursor
+		}
+		q.After = &after
+	}
+
+	limit := q.Limit
+	q.Limit++
+
+	urls, err := u.moderation.SearchLinks(ctx, q)
+	if err != nil {
+		u.log.Error("failed to search links", zap.Error(err))
+		return entities.URLPage{}, err
+	}
+
+	return newPage(urls, limit, entities.SortCreatedAt, true), nil
+}
+
+// DisableURL stops redirects of a link; visitors see reason on a warning page
+// instead. Disabling a disabled link changes nothing.
+func (u *Usecase) DisableURL(ctx context.Context, adminID, shortURL, reason string) (entities.Item, error) {
+	if !u.IsAdmin(adminID) {
+		return entities.Item{}, ErrNotAdmin
+	}
+
+	reason, err := checkReason(reason, true)
+	if err != nil {
+		return entities.Item{}, err
+	}
+
+	now := time.Now().UTC()
+	return u.moderate(ctx, adminID, shortURL, reason, &now)
+}
+
+// EnableURL lets a disabled link redirect again, e.g. after a false report.
+func (u *Usecase) EnableURL(ctx context.Context, adminID, shortURL, reason string) (entities.Item, error) {
+	if !u.IsAdmin(adminID) {
+		return entities.Item{}, ErrNotAdmin
+	}
+
+	reason, err := checkReason(reason, false)
+	if err != nil {
+		return entities.Item{}, err
+	}
+
+	return u.moderate(ctx, adminID, shortURL, reason, nil)
+}
+
+func (u *Usecase) moderate(ctx context.Context, adminID, shortURL, reason string, at *time.Time) (entities.Item, error) {
+	changed, err := u.moderation.SetDisabled(ctx, []string{shortURL}, reason, at)
+	if err != nil {
+		u.log.Error("failed to moderate url", zap.String("url", shortURL), zap.Error(err))
+		return entities.Item{}, err
+	}
+
+	u.recordModeration(ctx, adminID, changed, reason, at != nil)
+
+	item, err := u.repo.GetLink(ctx, shortURL)
+	if errors.Is(err, entities.ErrNotFound) {
+		return entities.Item{}, ErrLinkNotFound
+	}
+	if err != nil {
+		u.log.Error("failed to get url", zap.String("url", shortURL), zap.Error(err))
+		return entities.Item{}, err
+	}
+
+	return item, nil
+}
+
+// DisableDomain disables every enabled link to domain or its subdomains and
+// returns how many were disabled.
+func (u *Usecase) DisableDomain(ctx context.Context, adminID, domain, reason string) (int, error) {
+	if !u.IsAdmin(adminID) {
+		return 0, ErrNotAdmin
+	}
+
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return 0, err
+	}
+	reason, err = checkReason(reason, true)
+	if err != nil {
+		return 0, err
+	}
+
+	enabled := false
+	q := entities.LinkQuery{Domain: domain, Disabled: &enabled, Limit: maxPageSize}
+	now := time.Now().UTC()
+	total := 0
+
+	for {
+		urls, err := u.moderation.SearchLinks(ctx, q)
+		if err != nil {
+			u.log.Error("failed to search links", zap.String("domain", domain), zap.Error(err))
+			return total, err
+		}
+		if len(urls) == 0 {
+			return total, nil
+		}
+
+		shortURLs := make([]string, 0, len(urls))
+		for _, item := range urls {
+			shortURLs = append(shortURLs, item.ShortURL)
+		}
+
+		changed, err := u.moderation.SetDisabled(ctx, shortURLs, reason, &now)
+		if err != nil {
+			u.log.Error("failed to disable urls", zap.String("domain", domain), zap.Error(err))
+			return total, err
+		}
+		u.recordModeration(ctx, adminID, changed, reason, true)
+		total += len(changed)
+
+		if len(urls) < q.Limit {
+			return total, nil
+		}
+		last := urls[len(urls)-1]
+		q.After = &entities.URLCursor{Sort: entities.SortCreatedAt, Desc: true, CreatedAt: last.CreatedAt, ShortURL: last.ShortURL}
+	}
+}
+
+// recordModeration records that adminID disabled or enabled the links.
+func (u *Usecase) recordModeration(ctx context.Context, adminID string, shortURLs []string, reason string, disabled bool) {
+	action := entities.AuditLinkEnabled
+	if disabled {
+		action = entities.AuditLinkDisabled
+	}
+
+	changes := make([]auditChange, 0, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		changes = append(changes, auditChange{
+			target: shortURL,
+			before: auditState{"disabled": !disabled},
+			after:  auditState{"disabled": disabled},
+		})
+	}
+
+	u.record(ctx, action, adminID, reason, changes)
+}
+
+// disabled is the error for a disabled link, carrying the moderator's reason.
+func (u *Usecase) disabled(ctx context.Context, shortURL string) error {
+	item, err := u.repo.GetLink(ctx, shortURL)
+	if err != nil {
+		u.log.Error("failed to get url", zap.String("url", shortURL), zap.Error(err))
+		return &LinkDisabledError{}
+	}
+
+	return &LinkDisabledError{Reason: item.DisabledReason}
+}
+
+func checkReason(reason string, required bool) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if required && reason == "" {
+		return "", fmt.Errorf("%w: a reason is required", ErrInvalidModeration)
+	}
+	if len(reason) > reasonMax {
+		return "", fmt.Errorf("%w: reason is longer than %d bytes", ErrInvalidModeration, reasonMax)
+	}
+
+	return reason, nil
+}
+
+// normalizeDomain lowercases a host name and rejects anything else, like URLs
+// or wildcards.
+func normalizeDomain(domain string) (string, error) {
+	normalized, ok := hostName(domain)
+	if !ok {
+		return "", fmt.Errorf("%w: malformed domain %q", ErrInvalidModeration, domain)
+	}
+
+	return normalized, nil
+}
+
+// hostName lowercases a host name without the root dot and reports whether
+// it is one.
+func hostName(domain string) (string, bool) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" || strings.HasPrefix(domain, ".") || strings.Contains(domain, "..") {
+		return "", false
+	}
+
+	for _, r := range domain {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '.' {
+			return "", false
+		}
+	}
+
+	return domain, true
+}
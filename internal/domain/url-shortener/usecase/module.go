@@ -15,6 +15,7 @@ func New() fx.Option {
 			func(lc fx.Lifecycle, s *Usecase) {
 				lc.Append(fx.Hook{
 					OnStart: s.OnStart,
+					OnStop:  s.OnStop,
 				})
 			},
 		),
@@ -0,0 +1,324 @@
+package usecase
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"go.uber.org/zap"
+)
+
+// -----------------------------------------------------------------------------
+// Destination policy
+// -----------------------------------------------------------------------------
+
+const defaultPolicyReload = 30 * time.Second
+
+// ErrURLNotAllowed is returned for destinations the policy refuses.
+var ErrURLNotAllowed = fmt.Errorf("%w: destination not allowed", ErrInvalidURL)
+
+var (
+	// reservedPrefixes are the networks that are not reachable from the
+	// internet, besides those netip.Addr classifies itself.
+	reservedPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("100.64.0.0/10"),
+		netip.MustParsePrefix("192.0.0.0/24"),
+		netip.MustParsePrefix("198.18.0.0/15"),
+		netip.MustParsePrefix("240.0.0.0/4"),
+	}
+	// localSuffixes are names that only resolve inside a network.
+	localSuffixes = []string{"localhost", "local", "internal", "home.arpa"}
+)
+
+// urlPolicy decides which destinations may be shortened: never the short
+// domain itself, which would make a redirect loop, nor loopback, private and
+// local hosts, nor blocked domains, and in allowlist-only mode nothing but
+// allowed domains. The lists are polled for changes, so rules are updated
+// without a restart.
+type urlPolicy struct {
+	log          *zap.Logger
+	short        string
+	allowOnly    bool
+	allowPrivate bool
+	interval     time.Duration
+
+	blocklist *domainList
+	allowlist *domainList
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newURLPolicy(l *zap.Logger, cfg *config.Model) (*urlPolicy, error) {
+	p := &urlPolicy{
+		log:          l.Named("policy"),
+		allowOnly:    cfg.Policy.AllowlistOnly,
+		allowPrivate: cfg.Policy.AllowPrivate,
+		interval:     cfg.Policy.Reload,
+		blocklist:    &domainList{path: cfg.Policy.BlocklistFile},
+		allowlist:    &domainList{path: cfg.Policy.AllowlistFile},
+	}
+	if p.interval <= 0 {
+		p.interval = defaultPolicyReload
+	}
+
+	if returning, err := url.Parse(cfg.HTTP.ReturningURL); err == nil {
+		p.short, _ = hostName(returning.Hostname())
+	}
+
+	if p.allowOnly && p.allowlist.path == "" {
+		return nil, fmt.Errorf("allowlist-only mode requires an allowlist file")
+	}
+	for _, list := range []*domainList{p.blocklist, p.allowlist} {
+		if _, err := list.reload(); err != nil {
+			return nil, fmt.Errorf("load destination policy: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+// check returns ErrURLNotAllowed, or ErrInvalidURL for unparsable URLs, when
+// rawURL must not be shortened.
+func (p *urlPolicy) check(rawURL string) error {
+	if p == nil {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Scheme == "" {
+		u, err = url.Parse("http://" + rawURL)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return fmt.Errorf("%w: no host", ErrInvalidURL)
+	}
+
+	if p.short != "" && host == p.short {
+		return fmt.Errorf("%w: %s is the short link domain", ErrURLNotAllowed, host)
+	}
+	if err = checkPrivate(host, p.allowPrivate); err != nil {
+		return err
+	}
+	if p.blocklist.match(host) {
+		return fmt.Errorf("%w: %s is blocked", ErrURLNotAllowed, host)
+	}
+	if p.allowOnly && !p.allowlist.match(host) {
+		return fmt.Errorf("%w: %s is not on the allowlist", ErrURLNotAllowed, host)
+	}
+
+	return nil
+}
+
+// checkPrivate refuses IP addresses outside of the public internet and names
+// that only resolve locally, unless allowPrivate is set. Numeric hosts that
+// are no canonical address, like 0x7f.1 or 2130706433, are refused always:
+// browsers take them for addresses.
+func checkPrivate(host string, allowPrivate bool) error {
+	last := host[strings.LastIndexByte(host, '.')+1:]
+	if !strings.Contains(host, ":") && !numericLabel(last) {
+		if allowPrivate {
+			return nil
+		}
+		if !strings.Contains(host, ".") {
+			return fmt.Errorf("%w: %s is a local host name", ErrURLNotAllowed, host)
+		}
+		for _, suffix := range localSuffixes {
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				return fmt.Errorf("%w: %s is a local host name", ErrURLNotAllowed, host)
+			}
+		}
+		return nil
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || addr.Zone() != "" {
+		return fmt.Errorf("%w: %s is an ambiguous address", ErrURLNotAllowed, host)
+	}
+	if !allowPrivate && privateAddr(addr) {
+		return fmt.Errorf("%w: %s is a private address", ErrURLNotAllowed, host)
+	}
+
+	return nil
+}
+
+func numericLabel(label string) bool {
+	if strings.HasPrefix(label, "0x") {
+		return true
+	}
+
+	for _, r := range label {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return label != ""
+}
+
+func privateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() || addr.IsMulticast() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return true
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *urlPolicy) start() {
+	if p == nil || (p.blocklist.path == "" && p.allowlist.path == "") {
+		return
+	}
+
+	p.stop, p.done = make(chan struct{}), make(chan struct{})
+	go p.watch()
+}
+
+func (p *urlPolicy) shutdown() {
+	if p == nil || p.stop == nil {
+		return
+	}
+
+	close(p.stop)
+	<-p.done
+}
+
+func (p *urlPolicy) watch() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			for _, list := range []*domainList{p.blocklist, p.allowlist} {
+				reloaded, err := list.reload()
+				if err != nil {
+					p.log.Error("failed to reload destination policy", zap.String("file", list.path), zap.Error(err))
+					continue
+				}
+				if reloaded {
+					p.log.Info("destination policy reloaded", zap.String("file", list.path), zap.Int("domains", list.size()))
+				}
+			}
+		}
+	}
+}
+
+// domainList is a rules file of domains, one per line, with # comments. A
+// domain matches its subdomains too; a leading "*." is allowed for clarity.
+type domainList struct {
+	path string
+
+	mu      sync.RWMutex
+	domains map[string]struct{}
+	mod     time.Time
+}
+
+// match reports whether host or one of its parent domains is listed.
+func (l *domainList) match(host string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.domains) == 0 {
+		return false
+	}
+
+	for {
+		if _, ok := l.domains[host]; ok {
+			return true
+		}
+
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+}
+
+func (l *domainList) size() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.domains)
+}
+
+// reload loads the file if it changed since the last load. A broken file is
+// refused and the loaded rules stay in use.
+func (l *domainList) reload() (bool, error) {
+	if l.path == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return false, err
+	}
+
+	l.mu.RLock()
+	unchanged := l.domains != nil && info.ModTime().Equal(l.mod)
+	l.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return false, err
+	}
+
+	domains, err := parseDomainList(data)
+	if err != nil {
+		return false, fmt.Errorf("%s:%w", l.path, err)
+	}
+
+	l.mu.Lock()
+	l.domains, l.mod = domains, info.ModTime()
+	l.mu.Unlock()
+
+	return true, nil
+}
+
+func parseDomainList(data []byte) (map[string]struct{}, error) {
+	domains := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimPrefix(strings.TrimSpace(line), "*.")
+		if line == "" {
+			continue
+		}
+
+		domain, ok := hostName(line)
+		if !ok {
+			return nil, fmt.Errorf("%d: malformed domain %q", n, line)
+		}
+		domains[domain] = struct{}{}
+	}
+
+	return domains, scanner.Err()
+}
@@ -0,0 +1,20 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"go.uber.org/zap"
+)
+
+// TakeToken takes a token from the bucket of key. A broken bucket store must
+// not take the whole API down, so its failures let the request through.
+func (u *Usecase) TakeToken(ctx context.Context, key string, limit entities.RateLimit) entities.RateDecision {
+	decision, err := u.repo.TakeToken(ctx, key, limit)
+	if err != nil {
+		u.log.Warn("rate limit store failed, request allowed", zap.String("key", key), zap.Error(err))
+		return entities.RateDecision{Allowed: true}
+	}
+
+	return decision
+}
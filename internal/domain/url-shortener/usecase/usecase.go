@@ -2,9 +2,13 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/MV7VM/url-shortener/internal/config"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
 	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/repository"
 	"go.uber.org/zap"
@@ -19,25 +23,81 @@ const (
 )
 
 type Usecase struct {
-	log   *zap.Logger
-	count atomic.Uint64
-	repo  repo
+	log        *zap.Logger
+	count      atomic.Uint64
+	repo       repo
+	clicks     *clickHub
+	feed       *clickFeed
+	counter    *clickCounter
+	webhooks   *webhookDispatcher
+	deletions  *deletionQueue
+	apiKeys    apiKeyRepo
+	accounts   accountRepo
+	workspaces workspaceRepo
+	moderation moderationRepo
+	audit      auditRepo
+	policy     *urlPolicy
+	// stripTracking removes tracking parameters from destinations.
+	stripTracking bool
+	// admins are the user ids with the admin role.
+	admins map[string]struct{}
 }
 
 type repo interface {
-	Set(ctx context.Context, key, value, userID string) (string, error)
+	Set(ctx context.Context, key, value, userID, workspaceID string) (string, error)
 	Get(ctx context.Context, s string) (string, bool, error)
+	GetOwner(ctx context.Context, s string) (string, error)
+	GetLink(ctx context.Context, s string) (entities.Item, error)
+	UpdateLink(ctx context.Context, item entities.Item) error
+	CanonicalizeURLs(ctx context.Context, canonical func(string) (string, error)) (int, error)
 	GetCount(ctx context.Context) (int, error)
 	Ping(ctx context.Context) error
-	GetUsersUrls(ctx context.Context, userID string) ([]entities.Item, error)
-	Delete(ctx context.Context, shortURL []string, userID string) error
+	AddClicks(ctx context.Context, counts map[string]int64) error
+	GetUsersUrls(ctx context.Context, userID string, q entities.URLQuery) ([]entities.Item, error)
+	Delete(ctx context.Context, items []entities.DeleteItem) ([]entities.DeleteItem, error)
+	TakeToken(ctx context.Context, key string, limit entities.RateLimit) (entities.RateDecision, error)
 }
 
-func NewUsecase(l *zap.Logger, repo *repository.Repo) (*Usecase, error) {
-	return &Usecase{log: l.Named("usecase"), repo: repo}, nil
+func NewUsecase(l *zap.Logger, cfg *config.Model, repo *repository.Repo) (*Usecase, error) {
+	policy, err := newURLPolicy(l, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &Usecase{
+		log:        l.Named("usecase"),
+		repo:       repo,
+		clicks:     newClickHub(cfg.Clicks.SubscriberBuffer),
+		webhooks:   newWebhookDispatcher(l, cfg, repo),
+		apiKeys:    repo,
+		accounts:   repo,
+		workspaces: repo,
+		moderation: repo,
+		audit:      repo,
+		policy:     policy,
+		admins:     make(map[string]struct{}, len(cfg.Auth.Admins)),
+
+		stripTracking: cfg.Policy.StripTracking,
+	}
+	for _, id := range cfg.Auth.Admins {
+		u.admins[id] = struct{}{}
+	}
+	u.deletions = newDeletionQueue(l, cfg, repo, u.emitDeleted)
+	u.feed = newClickFeed(l, cfg, u.fanOutClick)
+	u.counter = newClickCounter(l, cfg, repo)
+
+	return u, nil
 }
 
 func (u *Usecase) OnStart(ctx context.Context) error {
+	rewritten, err := u.repo.CanonicalizeURLs(ctx, storedURL)
+	if err != nil {
+		return err
+	}
+	if rewritten > 0 {
+		u.log.Info("canonicalized stored urls", zap.Int("urls", rewritten))
+	}
+
 	count, err := u.repo.GetCount(ctx)
 	if err != nil {
 		return err
@@ -47,23 +107,63 @@ func (u *Usecase) OnStart(ctx context.Context) error {
 
 	u.log.Info("started from", zap.Uint64("count", u.count.Load()))
 
+	u.feed.start()
+	u.counter.start()
+	u.webhooks.start()
+	u.deletions.start()
+	u.policy.start()
+
 	return nil
 }
 
+func (u *Usecase) OnStop(ctx context.Context) error {
+	u.policy.shutdown()
+
+	return errors.Join(
+		u.feed.shutdown(ctx),
+		u.counter.shutdown(ctx),
+		u.deletions.shutdown(ctx),
+		u.webhooks.shutdown(ctx),
+	)
+}
+
 func (u *Usecase) GetByID(ctx context.Context, s string) (string, bool, error) {
 	url, isDeleted, err := u.repo.Get(ctx, s)
+	if errors.Is(err, entities.ErrNotFound) {
+		return "", false, ErrLinkNotFound
+	}
+	if errors.Is(err, entities.ErrDisabled) {
+		return "", false, u.disabled(ctx, s)
+	}
+	if errors.Is(err, entities.ErrExpired) {
+		return "", false, ErrLinkExpired
+	}
 	if err != nil {
 		u.log.Error("failed to get url", zap.String("url", s), zap.Error(err))
 		return "", false, err
 	}
 
+	if !isDeleted {
+		u.counter.add(s)
+		u.publishClick(s, url)
+	}
+
 	return url, isDeleted, nil
 }
 
 func (u *Usecase) CreateShortURL(ctx context.Context, url, userID string) (string, bool, error) {
+	return u.createShortURL(ctx, url, userID, "")
+}
+
+func (u *Usecase) createShortURL(ctx context.Context, url, userID, workspaceID string) (string, bool, error) {
+	url, err := u.destination(url)
+	if err != nil {
+		return "", false, err
+	}
+
 	encodedURL := u.shortenURL()
 
-	shortURL, err := u.repo.Set(ctx, encodedURL, url, userID)
+	shortURL, err := u.repo.Set(ctx, encodedURL, url, userID, workspaceID)
 	if err != nil {
 		u.log.Error("failed to set url", zap.String("url", url), zap.Error(err))
 		return "", false, err
@@ -73,6 +173,9 @@ func (u *Usecase) CreateShortURL(ctx context.Context, url, userID string) (strin
 		return shortURL, true, nil
 	}
 
+	u.webhooks.enqueue(ctx, entities.EventLinkCreated, userID, shortURL, url)
+	u.record(ctx, entities.AuditLinkCreated, userID, "", []auditChange{created(shortURL, url, workspaceID)})
+
 	return shortURL, false, nil
 }
 
@@ -87,15 +190,32 @@ func (u *Usecase) Ping(ctx context.Context) error {
 }
 
 func (u *Usecase) BatchURLs(ctx context.Context, urls []entities.BatchItem, userID string) error {
+	// A refused destination refuses the whole batch before anything is stored.
+	for i, item := range urls {
+		url, err := u.destination(item.OriginalURL)
+		if err != nil {
+			return fmt.Errorf("correlation_id %s: %w", item.CorrelationID, err)
+		}
+		urls[i].OriginalURL = url
+	}
+
+	changes := make([]auditChange, 0, len(urls))
+	defer func() { u.record(ctx, entities.AuditLinkCreated, userID, "", changes) }()
+
 	for i := range urls {
 		urls[i].ShortURL = u.shortenURL()
 
-		shortURL, err := u.repo.Set(ctx, urls[i].ShortURL, urls[i].OriginalURL, userID)
+		shortURL, err := u.repo.Set(ctx, urls[i].ShortURL, urls[i].OriginalURL, userID, "")
 		if err != nil {
 			u.log.Error("failed to set url", zap.String("url", urls[i].OriginalURL), zap.Error(err))
 			return err
 		}
 
+		if shortURL == urls[i].ShortURL {
+			u.webhooks.enqueue(ctx, entities.EventLinkCreated, userID, shortURL, urls[i].OriginalURL)
+			changes = append(changes, created(shortURL, urls[i].OriginalURL, ""))
+		}
+
 		urls[i].OriginalURL = ""
 		urls[i].ShortURL = shortURL
 	}
@@ -103,26 +223,120 @@ func (u *Usecase) BatchURLs(ctx context.Context, urls []entities.BatchItem, user
 	return nil
 }
 
-func (u *Usecase) GetUsersUrls(ctx context.Context, userID string) ([]entities.Item, error) {
-	urls, err := u.repo.GetUsersUrls(ctx, userID)
-	if err != nil {
-		u.log.Error("failed to get users urls", zap.Error(err))
-		return nil, err
+// Delete marks the links userID may change as deleted: the personal links the
+// user created and the links of workspaces where the user is an owner or
+// editor. The repositories check this per link, so that large asynchronous
+// deletions need no lookups.
+func (u *Usecase) Delete(ctx context.Context, shortURL []string, userID string) error {
+	items := make([]entities.DeleteItem, 0, len(shortURL))
+	for _, key := range shortURL {
+		items = append(items, entities.DeleteItem{ShortURL: key, UserID: userID})
 	}
 
-	return urls, nil
-}
-
-func (u *Usecase) Delete(ctx context.Context, shortURL []string, userID string) error {
-	err := u.repo.Delete(ctx, shortURL, userID)
+	deleted, err := u.repo.Delete(ctx, items)
 	if err != nil {
 		u.log.Error("failed to delete urls", zap.Error(err))
 		return err
 	}
 
+	u.emitDeleted(ctx, deleted)
+
 	return nil
 }
 
+// UpdateURL changes the original URL of a link and, when workspaceID is set,
+// moves the link into that workspace; a non-nil expiresAt becomes its expiry,
+// after which it stops redirecting. Empty arguments keep the current value.
+// The creator of a personal link may edit it, links of a workspace are edited
+// by its owners and editors.
+func (u *Usecase) UpdateURL(ctx context.Context, shortURL, userID, originalURL, workspaceID string, expiresAt *time.Time) (entities.Item, error) {
+	if originalURL != "" {
+		url, err := u.destination(originalURL)
+		if err != nil {
+			return entities.Item{}, err
+		}
+		originalURL = url
+	}
+
+	item, err := u.repo.GetLink(ctx, shortURL)
+	if errors.Is(err, entities.ErrNotFound) {
+		return entities.Item{}, ErrLinkNotFound
+	}
+	if err != nil {
+		u.log.Error("failed to get url", zap.String("url", shortURL), zap.Error(err))
+		return entities.Item{}, err
+	}
+
+	if err = u.checkCanEdit(ctx, item, userID); err != nil {
+		return entities.Item{}, err
+	}
+	if item.IsDeleted {
+		return entities.Item{}, ErrDeleted
+	}
+
+	before := editable(item)
+
+	if workspaceID != "" && workspaceID != item.WorkspaceID {
+		role, err := u.role(ctx, workspaceID, userID)
+		if err != nil {
+			return entities.Item{}, err
+		}
+		if !entities.CanEdit(role) {
+			return entities.Item{}, ErrViewer
+		}
+		item.WorkspaceID = workspaceID
+	}
+	if originalURL != "" {
+		item.OriginalURL = originalURL
+	}
+	if expiresAt != nil {
+		item.ExpiresAt = expiresAt
+	}
+
+	err = u.repo.UpdateLink(ctx, item)
+	if errors.Is(err, entities.ErrAlreadyExists) {
+		return entities.Item{}, ErrURLTaken
+	}
+	if err != nil {
+		u.log.Error("failed to update url", zap.String("url", shortURL), zap.Error(err))
+		return entities.Item{}, err
+	}
+
+	u.record(ctx, entities.AuditLinkUpdated, userID, "", []auditChange{{target: shortURL, before: before, after: editable(item)}})
+
+	return item, nil
+}
+
+// destination canonicalizes a destination URL and checks it against the
+// policy.
+func (u *Usecase) destination(rawURL string) (string, error) {
+	url, err := canonicalURL(rawURL, u.stripTracking)
+	if err != nil {
+		return "", err
+	}
+
+	return url, u.policy.check(url)
+}
+
+func created(shortURL, originalURL, workspaceID string) auditChange {
+	after := auditState{"original_url": originalURL}
+	if workspaceID != "" {
+		after["workspace_id"] = workspaceID
+	}
+
+	return auditChange{target: shortURL, after: after}
+}
+
+// editable is the state of the fields UpdateURL changes.
+func editable(item entities.Item) auditState {
+	state := auditState{"original_url": item.OriginalURL, "workspace_id": item.WorkspaceID}
+	if item.ExpiresAt != nil {
+		state["expires_at"] = *item.ExpiresAt
+	}
+
+	return state
+}
+
 func (u *Usecase) shortenURL() string {
 	u.count.Add(1)
 	return base62Encode(u.count.Load())
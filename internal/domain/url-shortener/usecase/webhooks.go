@@ -0,0 +1,460 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+)
+
+// -----------------------------------------------------------------------------
+// Outgoing webhooks
+// -----------------------------------------------------------------------------
+
+const (
+	deliveriesLimit = 100
+
+	HeaderWebhookEvent     = "X-Shortener-Event"
+	HeaderWebhookDelivery  = "X-Shortener-Delivery"
+	HeaderWebhookSignature = "X-Shortener-Signature"
+)
+
+var (
+	ErrInvalidWebhookURL   = fmt.Errorf("%w: webhook url must be an absolute http(s) url", ErrInvalidURL)
+	ErrInvalidWebhookEvent = errors.New("unknown webhook event")
+	ErrWebhookNotFound     = fmt.Errorf("webhook %w", ErrNotFound)
+
+	webhookEvents = []string{
+		entities.EventLinkCreated,
+		entities.EventLinkDeleted,
+		entities.EventLinkClicked,
+	}
+)
+
+type webhookRepo interface {
+	CreateWebhook(ctx context.Context, wh entities.Webhook) error
+	GetWebhooks(ctx context.Context, userID string) ([]entities.Webhook, error)
+	GetWebhook(ctx context.Context, id, userID string) (entities.Webhook, bool, error)
+	GetWebhooksByEvent(ctx context.Context, userID, event string) ([]entities.Webhook, error)
+	DeleteWebhook(ctx context.Context, id, userID string) (bool, error)
+	EnqueueDeliveries(ctx context.Context, deliveries []entities.WebhookDelivery) error
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]entities.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, d entities.WebhookDelivery) error
+	GetDeliveries(ctx context.Context, webhookID, userID string, limit int) ([]entities.WebhookDelivery, error)
+}
+
+type webhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      webhookLink `json:"data"`
+}
+
+type webhookLink struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url,omitempty"`
+}
+
+// webhookDispatcher turns link events into rows of the persistent delivery
+// queue and a background loop drains that queue, retrying failed deliveries
+// with exponential backoff until MaxAttempts is reached and the delivery is
+// dead-lettered.
+type webhookDispatcher struct {
+	log       *zap.Logger
+	repo      webhookRepo
+	cfg       config.WebhooksConfig
+	client    *http.Client
+	returning string
+	// allowPrivate permits receivers on loopback, private and local hosts.
+	allowPrivate bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWebhookDispatcher(l *zap.Logger, cfg *config.Model, repo webhookRepo) *webhookDispatcher {
+	returning := cfg.HTTP.ReturningURL
+	if !strings.HasSuffix(returning, "/") {
+		returning += "/"
+	}
+
+	client := &http.Client{
+		Timeout: cfg.Webhooks.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if !cfg.Policy.AllowPrivate {
+		client.Transport = publicTransport()
+	}
+
+	return &webhookDispatcher{
+		log:          l.Named("webhooks"),
+		repo:         repo,
+		cfg:          cfg.Webhooks,
+		returning:    returning,
+		client:       client,
+		allowPrivate: cfg.Policy.AllowPrivate,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// publicTransport only connects to public addresses. The address is checked
+// after the name is resolved, so a receiver whose name later resolves to a
+// private address is refused too. Proxies are not used: they would connect
+// on our behalf without the check.
+func publicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   refusePrivate,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return transport
+}
+
+func refusePrivate(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if privateAddr(addr) {
+		return fmt.Errorf("%w: %s is a private address", ErrURLNotAllowed, addr)
+	}
+
+	return nil
+}
+
+func (d *webhookDispatcher) start() {
+	if d == nil {
+		return
+	}
+
+	interval := d.cfg.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.dispatch(context.Background())
+			}
+		}
+	}()
+}
+
+// shutdown stops polling and waits for the in-flight batch. Deliveries that do
+// not finish stay leased and are retried after the lease expires.
+func (d *webhookDispatcher) shutdown(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+
+	close(d.stop)
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *webhookDispatcher) enqueue(ctx context.Context, event, userID, shortURL, originalURL string) {
+	if d == nil || userID == "" {
+		return
+	}
+
+	hooks, err := d.repo.GetWebhooksByEvent(ctx, userID, event)
+	if err != nil {
+		d.log.Error("failed to get webhooks", zap.String("event", event), zap.Error(err))
+		return
+	}
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	eventID, err := uuid.NewV7()
+	if err != nil {
+		d.log.Error("failed to create event id", zap.Error(err))
+		return
+	}
+
+	now := time.Now().UTC()
+	payload, err := json.Marshal(webhookPayload{
+		ID:        eventID.String(),
+		Event:     event,
+		CreatedAt: now,
+		Data: webhookLink{
+			ShortURL:    d.returning + shortURL,
+			OriginalURL: originalURL,
+		},
+	})
+	if err != nil {
+		d.log.Error("failed to encode webhook payload", zap.Error(err))
+		return
+	}
+
+	deliveries := make([]entities.WebhookDelivery, 0, len(hooks))
+	for _, wh := range hooks {
+		id, err := uuid.NewV7()
+		if err != nil {
+			d.log.Error("failed to create delivery id", zap.Error(err))
+			return
+		}
+
+		deliveries = append(deliveries, entities.WebhookDelivery{
+			ID:        id.String(),
+			WebhookID: wh.ID,
+			Event:     event,
+			Payload:   payload,
+			Status:    entities.DeliveryPending,
+			CreatedAt: now,
+		})
+	}
+
+	if err = d.repo.EnqueueDeliveries(ctx, deliveries); err != nil {
+		d.log.Error("failed to enqueue webhook deliveries", zap.String("event", event), zap.Error(err))
+	}
+}
+
+// dispatch claims one batch of due deliveries and sends them concurrently.
+func (d *webhookDispatcher) dispatch(ctx context.Context) {
+	batch := d.cfg.BatchSize
+	if batch <= 0 {
+		batch = 1
+	}
+
+	deliveries, err := d.repo.ClaimDeliveries(ctx, time.Now().UTC(), d.lease(), batch)
+	if err != nil {
+		d.log.Error("failed to claim webhook deliveries", zap.Error(err))
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery entities.WebhookDelivery) {
+			defer wg.Done()
+			d.deliver(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+func (d *webhookDispatcher) deliver(ctx context.Context, delivery entities.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.ResponseCode, delivery.LastError = 0, ""
+
+	code, err := d.send(ctx, delivery)
+	delivery.ResponseCode = code
+
+	switch {
+	case err == nil:
+		delivery.Status = entities.DeliveryDelivered
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		delivery.Status = entities.DeliveryDead
+		delivery.LastError = err.Error()
+		d.log.Warn("webhook delivery dead-lettered",
+			zap.String("delivery", delivery.ID), zap.Int("attempts", delivery.Attempts), zap.Error(err))
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = time.Now().UTC().Add(d.backoff(delivery.Attempts))
+	}
+
+	if err = d.repo.UpdateDelivery(ctx, delivery); err != nil {
+		d.log.Error("failed to update webhook delivery", zap.String("delivery", delivery.ID), zap.Error(err))
+	}
+}
+
+func (d *webhookDispatcher) send(ctx context.Context, delivery entities.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookEvent, delivery.Event)
+	req.Header.Set(HeaderWebhookDelivery, delivery.ID)
+	req.Header.Set(HeaderWebhookSignature, SignWebhook(delivery.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (d *webhookDispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.BaseBackoff
+	for i := 1; i < attempts && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if d.cfg.MaxBackoff > 0 && delay > d.cfg.MaxBackoff {
+		delay = d.cfg.MaxBackoff
+	}
+
+	return delay
+}
+
+// lease must outlive a delivery attempt, otherwise another replica could claim
+// a delivery that is still in flight.
+func (d *webhookDispatcher) lease() time.Duration {
+	return 2*d.cfg.Timeout + time.Second
+}
+
+// SignWebhook returns the signature header value for a payload sent at ts:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>">". Receivers
+// recompute it with the webhook secret to authenticate the request.
+func SignWebhook(secret string, ts time.Time, payload []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (u *Usecase) CreateWebhook(ctx context.Context, userID, rawURL string, events []string) (entities.Webhook, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return entities.Webhook{}, ErrInvalidWebhookURL
+	}
+
+	// Receivers inside our network could be reached through the webhook.
+	host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+	if err = checkPrivate(host, u.webhooks.allowPrivate); err != nil {
+		return entities.Webhook{}, err
+	}
+
+	if len(events) == 0 {
+		events = webhookEvents
+	}
+	for _, event := range events {
+		if !slices.Contains(webhookEvents, event) {
+			return entities.Webhook{}, fmt.Errorf("%w: %s", ErrInvalidWebhookEvent, event)
+		}
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return entities.Webhook{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return entities.Webhook{}, err
+	}
+
+	wh := entities.Webhook{
+		ID:        id.String(),
+		UserID:    userID,
+		URL:       target.String(),
+		Events:    slices.Compact(slices.Sorted(slices.Values(events))),
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err = u.webhooks.repo.CreateWebhook(ctx, wh); err != nil {
+		u.log.Error("failed to create webhook", zap.Error(err))
+		return entities.Webhook{}, err
+	}
+
+	return wh, nil
+}
+
+func (u *Usecase) GetWebhooks(ctx context.Context, userID string) ([]entities.Webhook, error) {
+	hooks, err := u.webhooks.repo.GetWebhooks(ctx, userID)
+	if err != nil {
+		u.log.Error("failed to get webhooks", zap.Error(err))
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+func (u *Usecase) DeleteWebhook(ctx context.Context, id, userID string) error {
+	found, err := u.webhooks.repo.DeleteWebhook(ctx, id, userID)
+	if err != nil {
+		u.log.Error("failed to delete webhook", zap.String("webhook", id), zap.Error(err))
+		return err
+	}
+
+	if !found {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// GetWebhookDeliveries lists the latest deliveries of one of the user's
+// webhooks; webhooks of other users are not found.
+func (u *Usecase) GetWebhookDeliveries(ctx context.Context, id, userID string) ([]entities.WebhookDelivery, error) {
+	_, found, err := u.webhooks.repo.GetWebhook(ctx, id, userID)
+	if err != nil {
+		u.log.Error("failed to get webhook", zap.String("webhook", id), zap.Error(err))
+		return nil, err
+	}
+	if !found {
+		return nil, ErrWebhookNotFound
+	}
+
+	deliveries, err := u.webhooks.repo.GetDeliveries(ctx, id, userID, deliveriesLimit)
+	if err != nil {
+		u.log.Error("failed to get webhook deliveries", zap.String("webhook", id), zap.Error(err))
+		return nil, err
+	}
+
+	return deliveries, nil
+}
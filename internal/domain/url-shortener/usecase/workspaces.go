@@ -0,0 +1,236 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/entities"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+)
+
+// -----------------------------------------------------------------------------
+// Workspaces
+// -----------------------------------------------------------------------------
+
+const workspaceNameMax = 100
+
+var (
+	ErrWorkspaceNotFound = fmt.Errorf("workspace %w", ErrNotFound)
+	ErrMemberNotFound    = fmt.Errorf("member %w", ErrNotFound)
+	ErrUserNotFound      = fmt.Errorf("user %w", ErrNotFound)
+	// ErrInvalidWorkspace is returned for blank names and unknown roles.
+	ErrInvalidWorkspace = errors.New("invalid workspace")
+	ErrLastOwner        = fmt.Errorf("%w: a workspace keeps at least one owner", ErrConflict)
+	ErrViewer           = fmt.Errorf("%w: viewers may not change links", ErrForbidden)
+	ErrNotOwner         = fmt.Errorf("%w: only owners manage members", ErrForbidden)
+	ErrUnregistered     = fmt.Errorf("%w: sign up to use workspaces", ErrForbidden)
+)
+
+type workspaceRepo interface {
+	CreateWorkspace(ctx context.Context, ws entities.Workspace, owner entities.Member) error
+	GetWorkspaces(ctx context.Context, userID string) ([]entities.Workspace, error)
+	GetMember(ctx context.Context, workspaceID, userID string) (entities.Member, error)
+	GetMembers(ctx context.Context, workspaceID string) ([]entities.Member, error)
+	SetMember(ctx context.Context, m entities.Member) error
+	DeleteMember(ctx context.Context, workspaceID, userID string) (bool, error)
+}
+
+// CreateWorkspace creates a workspace owned by userID. Only registered users
+// take part in workspaces: an anonymous identity lasts as long as its cookie.
+func (u *Usecase) CreateWorkspace(ctx context.Context, userID, name string) (entities.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > workspaceNameMax {
+		return entities.Workspace{}, fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidWorkspace, workspaceNameMax)
+	}
+
+	registered, err := u.registered(ctx, userID)
+	if err != nil {
+		u.log.Error("failed to check account", zap.Error(err))
+		return entities.Workspace{}, err
+	}
+	if !registered {
+		return entities.Workspace{}, ErrUnregistered
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return entities.Workspace{}, err
+	}
+
+	now := time.Now().UTC()
+	ws := entities.Workspace{ID: id.String(), Name: name, Role: entities.RoleOwner, CreatedAt: now}
+	owner := entities.Member{WorkspaceID: ws.ID, UserID: userID, Role: entities.RoleOwner, CreatedAt: now}
+
+	if err = u.workspaces.CreateWorkspace(ctx, ws, owner); err != nil {
+		u.log.Error("failed to create workspace", zap.Error(err))
+		return entities.Workspace{}, err
+	}
+
+	return ws, nil
+}
+
+// GetWorkspaces lists the workspaces userID is a member of, with its role.
+func (u *Usecase) GetWorkspaces(ctx context.Context, userID string) ([]entities.Workspace, error) {
+	workspaces, err := u.workspaces.GetWorkspaces(ctx, userID)
+	if err != nil {
+		u.log.Error("failed to get workspaces", zap.Error(err))
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+// GetMembers lists the members of a workspace to any of its members.
+func (u *Usecase) GetMembers(ctx context.Context, workspaceID, userID string) ([]entities.Member, error) {
+	if _, err := u.role(ctx, workspaceID, userID); err != nil {
+		return nil, err
+	}
+
+	members, err := u.workspaces.GetMembers(ctx, workspaceID)
+	if err != nil {
+		u.log.Error("failed to get members", zap.String("workspace", workspaceID), zap.Error(err))
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SetMember adds a registered user to the workspace or changes the role of a
+// member. Only owners manage members.
+func (u *Usecase) SetMember(ctx context.Context, workspaceID, userID, memberID, role string) (entities.Member, error) {
+	if role != entities.RoleOwner && role != entities.RoleEditor && role != entities.RoleViewer {
+		return entities.Member{}, fmt.Errorf("%w: unknown role %q", ErrInvalidWorkspace, role)
+	}
+	if err := u.checkOwner(ctx, workspaceID, userID); err != nil {
+		return entities.Member{}, err
+	}
+
+	current, err := u.workspaces.GetMember(ctx, workspaceID, memberID)
+	switch {
+	case errors.Is(err, entities.ErrNotFound):
+		registered, err := u.registered(ctx, memberID)
+		if err != nil {
+			u.log.Error("failed to check account", zap.Error(err))
+			return entities.Member{}, err
+		}
+		if !registered {
+			return entities.Member{}, ErrUserNotFound
+		}
+	case err != nil:
+		u.log.Error("failed to get member", zap.String("workspace", workspaceID), zap.Error(err))
+		return entities.Member{}, err
+	}
+
+	m := entities.Member{WorkspaceID: workspaceID, UserID: memberID, Role: role, CreatedAt: time.Now().UTC()}
+	if !current.CreatedAt.IsZero() {
+		m.CreatedAt = current.CreatedAt
+	}
+
+	err = u.workspaces.SetMember(ctx, m)
+	if errors.Is(err, entities.ErrLastOwner) {
+		return entities.Member{}, ErrLastOwner
+	}
+	if err != nil {
+		u.log.Error("failed to set member", zap.String("workspace", workspaceID), zap.Error(err))
+		return entities.Member{}, err
+	}
+
+	return m, nil
+}
+
+// RemoveMember takes memberID out of the workspace. Owners remove anyone,
+// other members may only leave.
+func (u *Usecase) RemoveMember(ctx context.Context, workspaceID, userID, memberID string) error {
+	if memberID != userID {
+		if err := u.checkOwner(ctx, workspaceID, userID); err != nil {
+			return err
+		}
+	}
+
+	deleted, err := u.workspaces.DeleteMember(ctx, workspaceID, memberID)
+	if errors.Is(err, entities.ErrLastOwner) {
+		return ErrLastOwner
+	}
+	if err != nil {
+		u.log.Error("failed to delete member", zap.String("workspace", workspaceID), zap.Error(err))
+		return err
+	}
+	if !deleted {
+		if memberID == userID {
+			return ErrWorkspaceNotFound
+		}
+		return ErrMemberNotFound
+	}
+
+	return nil
+}
+
+// CreateWorkspaceURL shortens url as a link of the workspace. Its owners and
+// editors may do so.
+func (u *Usecase) CreateWorkspaceURL(ctx context.Context, url, userID, workspaceID string) (string, bool, error) {
+	role, err := u.role(ctx, workspaceID, userID)
+	if err != nil {
+		return "", false, err
+	}
+	if !entities.CanEdit(role) {
+		return "", false, ErrViewer
+	}
+
+	return u.createShortURL(ctx, url, userID, workspaceID)
+}
+
+// role returns the role of userID in the workspace. Workspaces the user is no
+// member of are ErrWorkspaceNotFound, so that they stay unseen.
+func (u *Usecase) role(ctx context.Context, workspaceID, userID string) (string, error) {
+	m, err := u.workspaces.GetMember(ctx, workspaceID, userID)
+	if errors.Is(err, entities.ErrNotFound) {
+		return "", ErrWorkspaceNotFound
+	}
+	if err != nil {
+		u.log.Error("failed to get member", zap.String("workspace", workspaceID), zap.Error(err))
+		return "", err
+	}
+
+	return m.Role, nil
+}
+
+func (u *Usecase) checkOwner(ctx context.Context, workspaceID, userID string) error {
+	role, err := u.role(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if role != entities.RoleOwner {
+		return ErrNotOwner
+	}
+
+	return nil
+}
+
+// checkCanEdit lets the creator of a personal link and the owners and editors
+// of a workspace link change it. Links of others are ErrLinkNotFound, like
+// workspaces.
+func (u *Usecase) checkCanEdit(ctx context.Context, item entities.Item, userID string) error {
+	if item.WorkspaceID == "" {
+		if item.UserID != userID {
+			return ErrLinkNotFound
+		}
+		return nil
+	}
+
+	role, err := u.role(ctx, item.WorkspaceID, userID)
+	if errors.Is(err, ErrWorkspaceNotFound) {
+		return ErrLinkNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !entities.CanEdit(role) {
+		return ErrViewer
+	}
+
+	return nil
+}
@@ -0,0 +1,746 @@
+// Package client is a Go SDK for the shortener REST API.
+//
+// The API identifies callers by the JWT in the "auth" cookie. A Client without
+// a token receives a new anonymous identity on its first call and keeps using
+// it; Token exposes it so that it can be persisted and passed back with
+// WithToken later.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	authCookie = "auth"
+
+	defaultTimeout = 30 * time.Second
+	defaultRetries = 2
+	defaultBackoff = 200 * time.Millisecond
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+	gzip       bool
+	apiKey     string
+
+	mu    sync.RWMutex
+	token string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces the default client. Redirects are never followed
+// regardless of its CheckRedirect, as they are the answer of Resolve.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithToken authenticates as the owner of a previously issued token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithAPIKey authenticates with an API key instead of the auth cookie.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithRetries sets how many times a failed request is repeated. Backoff
+// doubles after every attempt unless the server sends Retry-After.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.backoff = retries, backoff
+	}
+}
+
+// WithGzip compresses request bodies.
+func WithGzip() Option {
+	return func(c *Client) {
+		c.gzip = true
+	}
+}
+
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("base url must be an absolute http(s) url: %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	hc := *c.httpClient
+	hc.Jar = nil
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	c.httpClient = &hc
+
+	return c, nil
+}
+
+// Token returns the auth token the client currently uses.
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.token
+}
+
+// Shorten shortens a link through the plain-text endpoint. For a link that was
+// shortened before the existing short URL is returned with conflict set.
+func (c *Client) Shorten(ctx context.Context, longURL string) (string, bool, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/", "text/plain", []byte(longURL))
+	if err != nil {
+		return "", false, err
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusConflict {
+		return "", false, newAPIError(resp)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(body), resp.StatusCode == http.StatusConflict, nil
+}
+
+// ShortenJSON is Shorten through the JSON endpoint.
+func (c *Client) ShortenJSON(ctx context.Context, longURL string) (string, bool, error) {
+	var result struct {
+		ShortURL string `json:"result"`
+	}
+
+	status, err := c.doJSON(ctx, http.MethodPost, "/api/shorten", map[string]string{"url": longURL}, &result,
+		http.StatusCreated, http.StatusConflict)
+	if err != nil {
+		return "", false, err
+	}
+
+	return result.ShortURL, status == http.StatusConflict, nil
+}
+
+// ShortenBatch shortens several links at once.
+func (c *Client) ShortenBatch(ctx context.Context, items []BatchItem) ([]BatchItem, error) {
+	var result []BatchItem
+	if _, err := c.doJSON(ctx, http.MethodPost, "/api/shorten/batch", items, &result, http.StatusCreated); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Resolve returns the original URL of a short link id without following the
+// redirect. A deleted link reports ErrGone.
+func (c *Client) Resolve(ctx context.Context, id string) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/"+url.PathEscape(id), "", nil)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		return "", newAPIError(resp)
+	}
+	drain(resp)
+
+	return resp.Header.Get("Location"), nil
+}
+
+// Ping checks that the service and its storage are reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.doJSON(ctx, http.MethodGet, "/ping", nil, nil, http.StatusOK)
+	return err
+}
+
+// UserURLs lists the links shortened by the caller.
+// UserURLs returns all links of the caller, following every page.
+func (c *Client) UserURLs(ctx context.Context) ([]URL, error) {
+	var (
+		result []URL
+		opts   ListOptions
+	)
+	for {
+		page, err := c.ListURLs(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, page.URLs...)
+		if page.Next == "" {
+			return result, nil
+		}
+		opts.Cursor = page.Next
+	}
+}
+
+// ListURLs returns one page of the caller's links or of the links of
+// opts.Workspace.
+func (c *Client) ListURLs(ctx context.Context, opts ListOptions) (URLPage, error) {
+	path := "/api/user/urls"
+	if opts.Workspace != "" {
+		path = workspacePath(opts.Workspace) + "/urls"
+	}
+	if q := opts.query(); len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var page URLPage
+	next, err := c.page(ctx, path, &page.URLs)
+	page.Next = next
+
+	return page, err
+}
+
+// page fetches one page of a listing into out and returns the next cursor;
+// an empty page leaves out untouched.
+func (c *Client) page(ctx context.Context, path string, out any) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return "", newAPIError(resp)
+	}
+	defer resp.Body.Close()
+
+	next := nextCursor(resp.Header.Get("Link"))
+	if resp.StatusCode == http.StatusNoContent {
+		drain(resp)
+		return next, nil
+	}
+
+	return next, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// nextCursor extracts the cursor of the rel="next" link.
+func nextCursor(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+		if !ok || !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+
+		next, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+		if err != nil {
+			return ""
+		}
+		return next.Query().Get("cursor")
+	}
+
+	return ""
+}
+
+// DeleteURLs schedules deletion of the caller's links by id. The returned job
+// can be polled with DeletionJob.
+func (c *Client) DeleteURLs(ctx context.Context, ids []string) (DeletionJob, error) {
+	var job DeletionJob
+	_, err := c.doJSON(ctx, http.MethodDelete, "/api/user/urls", ids, &job, http.StatusAccepted)
+
+	return job, err
+}
+
+func (c *Client) DeletionJob(ctx context.Context, id string) (DeletionJob, error) {
+	var job DeletionJob
+	_, err := c.doJSON(ctx, http.MethodGet, "/api/user/jobs/"+url.PathEscape(id), nil, &job, http.StatusOK)
+
+	return job, err
+}
+
+// CreateWebhook subscribes target to the given events, or to all of them when
+// events is empty.
+func (c *Client) CreateWebhook(ctx context.Context, target string, events []string) (Webhook, error) {
+	req := struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events,omitempty"`
+	}{URL: target, Events: events}
+
+	var wh Webhook
+	_, err := c.doJSON(ctx, http.MethodPost, "/api/user/webhooks", req, &wh, http.StatusCreated)
+
+	return wh, err
+}
+
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	var hooks []Webhook
+	if _, err := c.doJSON(ctx, http.MethodGet, "/api/user/webhooks", nil, &hooks, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	_, err := c.doJSON(ctx, http.MethodDelete, "/api/user/webhooks/"+url.PathEscape(id), nil, nil, http.StatusNoContent)
+	return err
+}
+
+func (c *Client) WebhookDeliveries(ctx context.Context, id string) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	_, err := c.doJSON(ctx, http.MethodGet, "/api/user/webhooks/"+url.PathEscape(id)+"/deliveries", nil, &deliveries, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// SignUp registers an account and switches the client to it. Links shortened
+// by the client so far move into the account.
+func (c *Client) SignUp(ctx context.Context, email, password string) (Account, error) {
+	return c.credentials(ctx, "/api/auth/signup", email, password, http.StatusCreated)
+}
+
+// Login switches the client to an account. Links shortened anonymously by
+// the client so far move into the account.
+func (c *Client) Login(ctx context.Context, email, password string) (Account, error) {
+	return c.credentials(ctx, "/api/auth/login", email, password, http.StatusOK)
+}
+
+func (c *Client) credentials(ctx context.Context, path, email, password string, want int) (Account, error) {
+	req := struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}{Email: email, Password: password}
+
+	var account Account
+	_, err := c.doJSON(ctx, http.MethodPost, path, req, &account, want)
+
+	return account, err
+}
+
+// Logout forgets the auth token; the next request starts a new anonymous
+// identity.
+func (c *Client) Logout(ctx context.Context) error {
+	_, err := c.doJSON(ctx, http.MethodPost, "/api/auth/logout", nil, nil, http.StatusNoContent)
+
+	c.mu.Lock()
+	c.token = ""
+	c.mu.Unlock()
+
+	return err
+}
+
+// CreateAPIKey issues a key acting as the current user. The key itself is
+// only returned here.
+func (c *Client) CreateAPIKey(ctx context.Context, name string, readOnly bool) (APIKey, error) {
+	req := struct {
+		Name     string `json:"name,omitempty"`
+		ReadOnly bool   `json:"read_only,omitempty"`
+	}{Name: name, ReadOnly: readOnly}
+
+	var key APIKey
+	_, err := c.doJSON(ctx, http.MethodPost, "/api/user/keys", req, &key, http.StatusCreated)
+
+	return key, err
+}
+
+func (c *Client) APIKeys(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	if _, err := c.doJSON(ctx, http.MethodGet, "/api/user/keys", nil, &keys, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) error {
+	_, err := c.doJSON(ctx, http.MethodDelete, "/api/user/keys/"+url.PathEscape(id), nil, nil, http.StatusNoContent)
+	return err
+}
+
+// UpdateURL changes the original URL of a link and, when workspaceID is set,
+// moves it into that workspace. Empty arguments keep the current value.
+func (c *Client) UpdateURL(ctx context.Context, id, originalURL, workspaceID string) (URL, error) {
+	req := struct {
+		OriginalURL string `json:"original_url,omitempty"`
+		WorkspaceID string `json:"workspace_id,omitempty"`
+	}{OriginalURL: originalURL, WorkspaceID: workspaceID}
+
+	var link URL
+	_, err := c.doJSON(ctx, http.MethodPatch, "/api/user/urls/"+url.PathEscape(id), req, &link, http.StatusOK)
+
+	return link, err
+}
+
+// ExpireURL sets the expiry of a link; once it passes, the link answers
+// ErrGone instead of redirecting.
+func (c *Client) ExpireURL(ctx context.Context, id string, at time.Time) (URL, error) {
+	req := struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}{ExpiresAt: at}
+
+	var link URL
+	_, err := c.doJSON(ctx, http.MethodPatch, "/api/user/urls/"+url.PathEscape(id), req, &link, http.StatusOK)
+
+	return link, err
+}
+
+// CreateWorkspace creates a workspace owned by the caller, who needs an
+// account.
+func (c *Client) CreateWorkspace(ctx context.Context, name string) (Workspace, error) {
+	var ws Workspace
+	_, err := c.doJSON(ctx, http.MethodPost, "/api/user/workspaces", map[string]string{"name": name}, &ws, http.StatusCreated)
+
+	return ws, err
+}
+
+func (c *Client) Workspaces(ctx context.Context) ([]Workspace, error) {
+	var workspaces []Workspace
+	if _, err := c.doJSON(ctx, http.MethodGet, "/api/user/workspaces", nil, &workspaces, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+func (c *Client) WorkspaceMembers(ctx context.Context, workspaceID string) ([]Member, error) {
+	var members []Member
+	if _, err := c.doJSON(ctx, http.MethodGet, workspacePath(workspaceID)+"/members", nil, &members, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SetWorkspaceMember adds a user to the workspace or changes its role.
+func (c *Client) SetWorkspaceMember(ctx context.Context, workspaceID, userID, role string) (Member, error) {
+	var m Member
+	_, err := c.doJSON(ctx, http.MethodPut, workspacePath(workspaceID)+"/members/"+url.PathEscape(userID),
+		map[string]string{"role": role}, &m, http.StatusOK)
+
+	return m, err
+}
+
+func (c *Client) RemoveWorkspaceMember(ctx context.Context, workspaceID, userID string) error {
+	_, err := c.doJSON(ctx, http.MethodDelete, workspacePath(workspaceID)+"/members/"+url.PathEscape(userID), nil, nil, http.StatusNoContent)
+	return err
+}
+
+// ShortenInWorkspace is ShortenJSON for a link of the workspace.
+func (c *Client) ShortenInWorkspace(ctx context.Context, workspaceID, longURL string) (string, bool, error) {
+	var result struct {
+		ShortURL string `json:"result"`
+	}
+
+	status, err := c.doJSON(ctx, http.MethodPost, workspacePath(workspaceID)+"/urls", map[string]string{"url": longURL}, &result,
+		http.StatusCreated, http.StatusConflict)
+	if err != nil {
+		return "", false, err
+	}
+
+	return result.ShortURL, status == http.StatusConflict, nil
+}
+
+func workspacePath(id string) string {
+	return "/api/user/workspaces/" + url.PathEscape(id)
+}
+
+// SearchLinks pages through the links of all users, newest first. It needs
+// an admin account and is refused to API keys.
+func (c *Client) SearchLinks(ctx context.Context, opts SearchOptions) (AdminURLPage, error) {
+	path := "/api/admin/urls"
+	if q := opts.query(); len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var page AdminURLPage
+	next, err := c.page(ctx, path, &page.URLs)
+	page.Next = next
+
+	return page, err
+}
+
+// DisableURL stops redirects of the link; visitors see reason instead.
+func (c *Client) DisableURL(ctx context.Context, id, reason string) (AdminURL, error) {
+	return c.moderate(ctx, id, "disable", reason)
+}
+
+// EnableURL lets a disabled link redirect again; reason may be empty.
+func (c *Client) EnableURL(ctx context.Context, id, reason string) (AdminURL, error) {
+	return c.moderate(ctx, id, "enable", reason)
+}
+
+func (c *Client) moderate(ctx context.Context, id, action, reason string) (AdminURL, error) {
+	var link AdminURL
+	_, err := c.doJSON(ctx, http.MethodPost, "/api/admin/urls/"+url.PathEscape(id)+"/"+action,
+		map[string]string{"reason": reason}, &link, http.StatusOK)
+
+	return link, err
+}
+
+// DisableDomain disables every enabled link to domain or its subdomains and
+// returns how many were disabled.
+func (c *Client) DisableDomain(ctx context.Context, domain, reason string) (int, error) {
+	var result struct {
+		Disabled int `json:"disabled"`
+	}
+	_, err := c.doJSON(ctx, http.MethodPost, "/api/admin/domains/disable",
+		map[string]string{"domain": domain, "reason": reason}, &result, http.StatusOK)
+
+	return result.Disabled, err
+}
+
+// Audit pages through the audit log of all changes, newest first. It needs
+// an admin account.
+func (c *Client) Audit(ctx context.Context, opts AuditOptions) (AuditPage, error) {
+	path := "/api/admin/audit"
+	if q := opts.query(); len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var page AuditPage
+	next, err := c.page(ctx, path, &page.Entries)
+	page.Next = next
+
+	return page, err
+}
+
+// URLAudit returns the latest history of the link, newest first.
+func (c *Client) URLAudit(ctx context.Context, id string) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	_, err := c.doJSON(ctx, http.MethodGet, "/api/admin/urls/"+url.PathEscape(id)+"/audit", nil, &entries, http.StatusOK)
+
+	return entries, err
+}
+
+// StreamClicks calls fn for every click on the caller's links until ctx is
+// done, the server closes the stream or fn returns an error. The stream is not
+// retried and is bounded by the timeout of the underlying http.Client.
+func (c *Client) StreamClicks(ctx context.Context, fn func(ClickEvent) error) error {
+	resp, err := c.send(ctx, http.MethodGet, "/api/user/clicks/stream", "", nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp)
+	}
+	defer resp.Body.Close()
+
+	var event string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:") && event == "click":
+			var click ClickEvent
+			if err = json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &click); err != nil {
+				return err
+			}
+			if err = fn(click); err != nil {
+				return err
+			}
+		case line == "":
+			event = ""
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return scanner.Err()
+}
+
+// doJSON sends in as JSON and decodes the response into out when its status
+// is one of want. It returns the actual status.
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out any, want ...int) (int, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return 0, err
+		}
+	}
+
+	resp, err := c.do(ctx, method, path, "application/json", body)
+	if err != nil {
+		return 0, err
+	}
+
+	if !slices.Contains(want, resp.StatusCode) {
+		return resp.StatusCode, newAPIError(resp)
+	}
+	defer resp.Body.Close()
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		drain(resp)
+		return resp.StatusCode, nil
+	}
+
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do sends the request and repeats it on transport errors of idempotent
+// requests and on 429, 502, 503 and 504 responses.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, contentType, body)
+		if attempt >= c.retries || !retryable(method, resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := c.backoff << attempt
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 {
+				delay = after
+			}
+			drain(resp)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		if c.gzip {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			if _, err := zw.Write(body); err != nil {
+				return nil, err
+			}
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			body = buf.Bytes()
+		}
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+		if c.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	// Setting the header disables the transparent decompression of the
+	// transport, so the body is decoded below for every response.
+	req.Header.Set("Accept-Encoding", "gzip")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	} else if token := c.Token(); token != "" {
+		req.AddCookie(&http.Cookie{Name: authCookie, Value: token})
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == authCookie && cookie.Value != "" {
+			c.mu.Lock()
+			c.token = cookie.Value
+			c.mu.Unlock()
+		}
+	}
+
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		resp.Body = &gzipBody{body: resp.Body}
+		resp.Header.Del("Content-Encoding")
+	}
+
+	return resp, nil
+}
+
+func retryable(method string, resp *http.Response, err error) bool {
+	if err != nil {
+		return method == http.MethodGet || method == http.MethodDelete
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+}
+
+// gzipBody decompresses lazily: bodies of redirects and 204 responses may be
+// empty even with Content-Encoding set.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+}
+
+func (g *gzipBody) Read(p []byte) (int, error) {
+	if g.zr == nil {
+		zr, err := gzip.NewReader(g.body)
+		if errors.Is(err, io.EOF) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		g.zr = zr
+	}
+
+	return g.zr.Read(p)
+}
+
+func (g *gzipBody) Close() error {
+	return g.body.Close()
+}
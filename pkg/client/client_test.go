@@ -0,0 +1,582 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MV7VM/url-shortener/internal/config"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/auth"
+	httpdelivery "github.com/MV7VM/url-shortener/internal/domain/url-shortener/delivery/http"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/repository"
+	"github.com/MV7VM/url-shortener/internal/domain/url-shortener/usecase"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const returningURL = "http://short.test/"
+
+// newTestAPI serves the real handlers over the in-memory repository.
+func newTestAPI(t *testing.T, opts ...func(*config.Model)) http.Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Model{
+		HTTP: config.HTTPConfig{
+			ReturningURL: returningURL,
+		},
+		Auth: config.AuthConfig{Secret: "secret"},
+		Repo: config.RepoConfig{
+			CacheConfig: config.CacheConfig{SavingFilePath: filepath.Join(t.TempDir(), "data.json")},
+		},
+		Clicks:   config.ClicksConfig{Heartbeat: time.Second, FlushInterval: 10 * time.Millisecond},
+		Webhooks: config.WebhooksConfig{PollInterval: time.Hour, Timeout: time.Second, MaxAttempts: 1},
+		Deletion: config.DeletionConfig{
+			Workers:     1,
+			QueueSize:   16,
+			BatchWindow: 10 * time.Millisecond,
+			BatchSize:   100,
+			JobTTL:      time.Hour,
+		},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	repo, err := repository.NewRepo(context.Background(), cfg)
+	require.NoError(t, err)
+
+	uc, err := usecase.NewUsecase(zap.NewNop(), cfg, repo)
+	require.NoError(t, err)
+	require.NoError(t, uc.OnStart(context.Background()))
+	t.Cleanup(func() { _ = uc.OnStop(context.Background()) })
+
+	keys, err := auth.NewKeyring(zap.NewNop(), cfg)
+	require.NoError(t, err)
+
+	oidc, err := auth.NewOIDC(cfg)
+	require.NoError(t, err)
+
+	server, err := httpdelivery.NewServer(zap.NewNop(), cfg, uc, keys, oidc, nil)
+	require.NoError(t, err)
+
+	// Every exchange of the SDK tests is checked against the OpenAPI document.
+	handler, err := httpdelivery.OpenAPIValidator(server.Handler(), func(err error) {
+		t.Errorf("openapi: %v", err)
+	})
+	require.NoError(t, err)
+
+	return handler
+}
+
+func newTestClient(t *testing.T, handler http.Handler, opts ...Option) (*Client, *httptest.Server) {
+	t.Helper()
+
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	c, err := New(ts.URL, append([]Option{WithRetries(2, time.Millisecond)}, opts...)...)
+	require.NoError(t, err)
+
+	return c, ts
+}
+
+func TestNew_InvalidBaseURL(t *testing.T) {
+	_, err := New("localhost:8080")
+	assert.Error(t, err)
+}
+
+func TestClient_ShortenResolveAndList(t *testing.T) {
+	c, ts := newTestClient(t, newTestAPI(t), WithGzip())
+	ctx := context.Background()
+
+	short, conflict, err := c.Shorten(ctx, "https://example.com/a")
+	require.NoError(t, err)
+	assert.False(t, conflict)
+	assert.True(t, strings.HasPrefix(short, returningURL))
+	require.NotEmpty(t, c.Token())
+
+	jsonShort, conflict, err := c.ShortenJSON(ctx, "https://example.com/b")
+	require.NoError(t, err)
+	assert.False(t, conflict)
+
+	original, err := c.Resolve(ctx, strings.TrimPrefix(jsonShort, returningURL))
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/b", original)
+
+	// Newest first; the resolved link counts the click once it is flushed.
+	var urls []URL
+	require.Eventually(t, func() bool {
+		urls, err = c.UserURLs(ctx)
+		return err == nil && len(urls) == 2 && urls[0].Clicks == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, jsonShort, urls[0].ShortURL)
+	assert.Equal(t, "https://example.com/b", urls[0].OriginalURL)
+	assert.Equal(t, short, urls[1].ShortURL)
+	assert.Equal(t, "https://example.com/a", urls[1].OriginalURL)
+
+	// The token identifies the same owner from another client.
+	other, err := New(ts.URL, WithToken(c.Token()))
+	require.NoError(t, err)
+	urls, err = other.UserURLs(ctx)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+
+	// A fresh identity owns nothing.
+	fresh, err := New(ts.URL)
+	require.NoError(t, err)
+	urls, err = fresh.UserURLs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+}
+
+func TestClient_ListURLs(t *testing.T) {
+	c, _ := newTestClient(t, newTestAPI(t))
+	ctx := context.Background()
+
+	for _, path := range []string{"/go", "/rust", "/golang"} {
+		_, _, err := c.Shorten(ctx, "https://example.com"+path)
+		require.NoError(t, err)
+	}
+
+	page, err := c.ListURLs(ctx, ListOptions{Limit: 2, Ascending: true})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 2)
+	assert.Equal(t, "https://example.com/go", page.URLs[0].OriginalURL)
+	require.NotEmpty(t, page.Next)
+
+	page, err = c.ListURLs(ctx, ListOptions{Limit: 2, Ascending: true, Cursor: page.Next})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, "https://example.com/golang", page.URLs[0].OriginalURL)
+	assert.Empty(t, page.Next)
+
+	page, err = c.ListURLs(ctx, ListOptions{Search: "GO", Sort: SortClicks})
+	require.NoError(t, err)
+	assert.Len(t, page.URLs, 2)
+
+	_, err = c.ListURLs(ctx, ListOptions{Cursor: "broken"})
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+// Only the postgres repository detects duplicates, so the conflict answer is
+// stubbed.
+func TestClient_Shorten_Conflict(t *testing.T) {
+	conflict := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		if r.URL.Path == "/api/shorten" {
+			_, _ = w.Write([]byte(`{"result":"http://short.test/a"}`))
+			return
+		}
+		_, _ = w.Write([]byte("http://short.test/a"))
+	})
+	c, _ := newTestClient(t, conflict)
+
+	short, isConflict, err := c.Shorten(context.Background(), "https://example.com")
+	require.NoError(t, err)
+	assert.True(t, isConflict)
+	assert.Equal(t, "http://short.test/a", short)
+
+	short, isConflict, err = c.ShortenJSON(context.Background(), "https://example.com")
+	require.NoError(t, err)
+	assert.True(t, isConflict)
+	assert.Equal(t, "http://short.test/a", short)
+}
+
+func TestClient_ShortenBatch(t *testing.T) {
+	c, _ := newTestClient(t, newTestAPI(t))
+
+	items, err := c.ShortenBatch(context.Background(), []BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://one.example"},
+		{CorrelationID: "2", OriginalURL: "https://two.example"},
+	})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "2", items[1].CorrelationID)
+	assert.True(t, strings.HasPrefix(items[1].ShortURL, returningURL))
+}
+
+func TestClient_DeleteURLs(t *testing.T) {
+	c, _ := newTestClient(t, newTestAPI(t))
+	ctx := context.Background()
+
+	short, _, err := c.Shorten(ctx, "https://example.com/gone")
+	require.NoError(t, err)
+	id := strings.TrimPrefix(short, returningURL)
+
+	job, err := c.DeleteURLs(ctx, []string{id})
+	require.NoError(t, err)
+	assert.Equal(t, 1, job.Total)
+
+	require.Eventually(t, func() bool {
+		job, err = c.DeletionJob(ctx, job.ID)
+		return err == nil && job.Finished()
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, job.Deleted)
+
+	_, err = c.Resolve(ctx, id)
+	assert.ErrorIs(t, err, ErrGone)
+}
+
+func TestClient_TypedErrors(t *testing.T) {
+	c, ts := newTestClient(t, newTestAPI(t))
+	ctx := context.Background()
+
+	_, _, err := c.Shorten(ctx, "not a url")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "invalid_url", apiErr.Code)
+	assert.Equal(t, "invalid url", apiErr.Message)
+
+	_, err = c.DeletionJob(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = c.Resolve(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// /api/user/* requires an already issued token.
+	anonymous, err := New(ts.URL)
+	require.NoError(t, err)
+	_, err = anonymous.Webhooks(ctx)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestClient_Webhooks(t *testing.T) {
+	c, _ := newTestClient(t, newTestAPI(t))
+	ctx := context.Background()
+
+	_, _, err := c.Shorten(ctx, "https://example.com")
+	require.NoError(t, err)
+
+	wh, err := c.CreateWebhook(ctx, "https://hooks.example/in", []string{"link.created"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, wh.Secret)
+
+	hooks, err := c.Webhooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	assert.Equal(t, wh.ID, hooks[0].ID)
+
+	deliveries, err := c.WebhookDeliveries(ctx, wh.ID)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	require.NoError(t, c.DeleteWebhook(ctx, wh.ID))
+	assert.ErrorIs(t, c.DeleteWebhook(ctx, wh.ID), ErrNotFound)
+}
+
+func TestClient_APIKeys(t *testing.T) {
+	api := newTestAPI(t)
+	c, ts := newTestClient(t, api)
+	ctx := context.Background()
+
+	short, _, err := c.Shorten(ctx, "https://example.com")
+	require.NoError(t, err)
+
+	key, err := c.CreateAPIKey(ctx, "ci", false)
+	require.NoError(t, err)
+	require.NotEmpty(t, key.Key)
+	readOnly, err := c.CreateAPIKey(ctx, "reports", true)
+	require.NoError(t, err)
+
+	job, err := New(ts.URL, WithAPIKey(key.Key))
+	require.NoError(t, err)
+	urls, err := job.UserURLs(ctx)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, short, urls[0].ShortURL)
+	assert.Empty(t, job.Token(), "api key callers get no cookie")
+
+	// Keys cannot manage keys.
+	_, err = job.CreateAPIKey(ctx, "escalate", false)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	reports, err := New(ts.URL, WithAPIKey(readOnly.Key))
+	require.NoError(t, err)
+	_, err = reports.UserURLs(ctx)
+	require.NoError(t, err)
+	_, _, err = reports.Shorten(ctx, "https://example.org")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	keys, err := c.APIKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Empty(t, keys[0].Key)
+
+	require.NoError(t, c.RevokeAPIKey(ctx, key.ID))
+	_, err = job.UserURLs(ctx)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestClient_Accounts(t *testing.T) {
+	api := newTestAPI(t)
+	c, ts := newTestClient(t, api)
+	ctx := context.Background()
+
+	first, _, err := c.Shorten(ctx, "https://example.com/first")
+	require.NoError(t, err)
+	account, err := c.SignUp(ctx, "user@example.com", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", account.Email)
+
+	_, err = c.SignUp(ctx, "user@example.com", "correct horse")
+	assert.ErrorIs(t, err, ErrConflict)
+
+	// Cookies are gone, e.g. on another device.
+	require.NoError(t, c.Logout(ctx))
+	second, _, err := c.Shorten(ctx, "https://example.com/second")
+	require.NoError(t, err)
+
+	_, err = c.Login(ctx, "user@example.com", "wrong horse")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "invalid_credentials", apiErr.Code)
+
+	_, err = c.Login(ctx, "user@example.com", "correct horse")
+	require.NoError(t, err)
+
+	urls, err := c.UserURLs(ctx)
+	require.NoError(t, err)
+	got := make([]string, 0, len(urls))
+	for _, u := range urls {
+		got = append(got, u.ShortURL)
+	}
+	assert.ElementsMatch(t, []string{first, second}, got)
+
+	other, err := New(ts.URL, WithToken(c.Token()))
+	require.NoError(t, err)
+	urls, err = other.UserURLs(ctx)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2, "the account cookie works anywhere")
+}
+
+func TestClient_Workspaces(t *testing.T) {
+	api := newTestAPI(t)
+	owner, _ := newTestClient(t, api)
+	viewer, _ := newTestClient(t, api)
+	ctx := context.Background()
+
+	_, err := owner.SignUp(ctx, "owner@example.com", "correct horse")
+	require.NoError(t, err)
+	viewerAccount, err := viewer.SignUp(ctx, "viewer@example.com", "correct horse")
+	require.NoError(t, err)
+
+	ws, err := owner.CreateWorkspace(ctx, "Campaigns")
+	require.NoError(t, err)
+	assert.Equal(t, RoleOwner, ws.Role)
+	_, err = owner.SetWorkspaceMember(ctx, ws.ID, viewerAccount.ID, RoleViewer)
+	require.NoError(t, err)
+
+	members, err := viewer.WorkspaceMembers(ctx, ws.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	short, conflict, err := owner.ShortenInWorkspace(ctx, ws.ID, "https://example.com/campaign")
+	require.NoError(t, err)
+	assert.False(t, conflict)
+	id := strings.TrimPrefix(short, returningURL)
+
+	_, _, err = viewer.ShortenInWorkspace(ctx, ws.ID, "https://example.com/viewer")
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = viewer.UpdateURL(ctx, id, "https://example.com/changed", "")
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	link, err := owner.UpdateURL(ctx, id, "https://example.com/changed", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/changed", link.OriginalURL)
+
+	link, err = owner.ExpireURL(ctx, id, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.NotNil(t, link.ExpiresAt)
+	_, err = owner.ExpireURL(ctx, id, time.Now().Add(-time.Hour))
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	page, err := viewer.ListURLs(ctx, ListOptions{Workspace: ws.ID})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, ws.ID, page.URLs[0].WorkspaceID)
+
+	// Workspace links are not the personal links of their creator.
+	urls, err := owner.UserURLs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+
+	require.NoError(t, viewer.RemoveWorkspaceMember(ctx, ws.ID, viewerAccount.ID))
+	workspaces, err := viewer.Workspaces(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, workspaces)
+}
+
+func TestClient_Moderation(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Model) { cfg.Auth.Admins = []string{"admin"} })
+	user, ts := newTestClient(t, api)
+	ctx := context.Background()
+
+	token, _, err := auth.NewStaticKeyring([]byte("secret")).Issue("admin")
+	require.NoError(t, err)
+	admin, err := New(ts.URL, WithToken(token))
+	require.NoError(t, err)
+
+	short, _, err := user.Shorten(ctx, "https://spam.example.com/offer")
+	require.NoError(t, err)
+	id := strings.TrimPrefix(short, returningURL)
+
+	_, err = user.SearchLinks(ctx, SearchOptions{})
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	page, err := admin.SearchLinks(ctx, SearchOptions{Domain: "example.com"})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, short, page.URLs[0].ShortURL)
+	assert.NotEmpty(t, page.URLs[0].UserID)
+
+	link, err := admin.DisableURL(ctx, id, "phishing")
+	require.NoError(t, err)
+	assert.Equal(t, "phishing", link.DisabledReason)
+	assert.NotNil(t, link.DisabledAt)
+
+	_, err = user.Resolve(ctx, id)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = admin.EnableURL(ctx, id, "")
+	require.NoError(t, err)
+	original, err := user.Resolve(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "https://spam.example.com/offer", original)
+
+	n, err := admin.DisableDomain(ctx, "example.com", "spam campaign")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	entries, err := admin.URLAudit(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, "link.disabled", entries[0].Action)
+	assert.Equal(t, "spam campaign", entries[0].Reason)
+
+	audit, err := admin.Audit(ctx, AuditOptions{ActorID: page.URLs[0].UserID, Action: "link.created"})
+	require.NoError(t, err)
+	require.Len(t, audit.Entries, 1)
+	assert.Equal(t, id, audit.Entries[0].Target)
+	assert.NotEmpty(t, audit.Entries[0].RequestID)
+	assert.JSONEq(t, `{"original_url":"https://spam.example.com/offer"}`, string(audit.Entries[0].After))
+}
+
+func TestClient_StreamClicks(t *testing.T) {
+	c, _ := newTestClient(t, newTestAPI(t))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	short, _, err := c.Shorten(ctx, "https://example.com/clicked")
+	require.NoError(t, err)
+
+	clicks := make(chan ClickEvent, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.StreamClicks(ctx, func(event ClickEvent) error {
+			clicks <- event
+			return context.Canceled
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		if _, err := c.Resolve(ctx, strings.TrimPrefix(short, returningURL)); err != nil {
+			return false
+		}
+
+		select {
+		case event := <-clicks:
+			assert.Equal(t, "https://example.com/clicked", event.OriginalURL)
+			return true
+		default:
+			return false
+		}
+	}, 3*time.Second, 50*time.Millisecond)
+
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestClient_Retries(t *testing.T) {
+	api := newTestAPI(t)
+
+	var calls atomic.Int32
+	flaky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+
+	c, _ := newTestClient(t, flaky)
+	_, _, err := c.Shorten(context.Background(), "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+
+	down := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	c, _ = newTestClient(t, down)
+	_, err = c.UserURLs(context.Background())
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestClient_TooLarge(t *testing.T) {
+	c, _ := newTestClient(t, newTestAPI(t, func(cfg *config.Model) {
+		cfg.Limits = config.LimitsConfig{MaxBatchSize: 1, MaxURLLength: 32}
+	}))
+	ctx := context.Background()
+
+	_, _, err := c.Shorten(ctx, "https://example.com/"+strings.Repeat("a", 32))
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	_, err = c.ShortenBatch(ctx, []BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://one.example"},
+		{CorrelationID: "2", OriginalURL: "https://two.example"},
+	})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "too_large", apiErr.Code)
+}
+
+func TestClient_RateLimited(t *testing.T) {
+	c, _ := newTestClient(t, newTestAPI(t, func(cfg *config.Model) {
+		cfg.RateLimit.Create = config.LimitConfig{Rate: 0.01, Burst: 1}
+	}), WithRetries(0, time.Millisecond))
+	ctx := context.Background()
+
+	// The issued cookie moves the client from its IP bucket to its user one.
+	_, err := c.UserURLs(ctx)
+	require.NoError(t, err)
+
+	_, _, err = c.Shorten(ctx, "https://example.com/1")
+	require.NoError(t, err)
+
+	_, _, err = c.Shorten(ctx, "https://example.com/2")
+	assert.ErrorIs(t, err, ErrRateLimited)
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "rate_limited", apiErr.Code)
+	assert.Equal(t, 100*time.Second, apiErr.RetryAfter)
+}
+
+func TestClient_PolicyRefusesDestinations(t *testing.T) {
+	c, _ := newTestClient(t, newTestAPI(t))
+	ctx := context.Background()
+
+	_, _, err := c.Shorten(ctx, returningURL+"abc")
+	assert.ErrorIs(t, err, ErrURLNotAllowed)
+	_, _, err = c.ShortenJSON(ctx, "http://127.0.0.1:6379/")
+	assert.ErrorIs(t, err, ErrURLNotAllowed)
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sentinel errors matched by *APIError through errors.Is.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrGone         = errors.New("link is deleted")
+	ErrUnavailable  = errors.New("service unavailable")
+	ErrRateLimited  = errors.New("rate limit exceeded")
+	ErrTooLarge     = errors.New("request too large")
+	// ErrURLNotAllowed is a bad request for a destination the server's
+	// policy refuses, like a blocked domain or a private address.
+	ErrURLNotAllowed = errors.New("url not allowed")
+)
+
+// APIError is returned for every unexpected response status. Code is the
+// stable error code of the problem document, empty for non-problem answers.
+// RetryAfter is the wait the server asked for, zero when not given.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("shortener: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("shortener: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrGone:
+		return e.StatusCode == http.StatusGone
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	case ErrTooLarge:
+		return e.StatusCode == http.StatusRequestEntityTooLarge
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrURLNotAllowed:
+		return e.Code == "url_not_allowed"
+	default:
+		return false
+	}
+}
+
+// newAPIError consumes the response body. The API reports errors as RFC 7807
+// problem documents; anything else, e.g. from a proxy, is kept as plain text.
+func newAPIError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+
+	var problem struct {
+		Title  string `json:"title"`
+		Detail string `json:"detail"`
+		Code   string `json:"code"`
+	}
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		RetryAfter: retryAfter(resp),
+	}
+	if json.Unmarshal(body, &problem) == nil && problem.Code != "" {
+		apiErr.Code, apiErr.Message = problem.Code, problem.Detail
+		if apiErr.Message == "" {
+			apiErr.Message = problem.Title
+		}
+	}
+
+	return apiErr
+}
@@ -0,0 +1,283 @@
+package client
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// URL is a link owned by the caller.
+type URL struct {
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   time.Time  `json:"created_at,omitzero"`
+	Clicks      int64      `json:"clicks,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	IsDeleted   bool       `json:"is_deleted,omitempty"`
+	WorkspaceID string     `json:"workspace_id,omitempty"`
+	// DisabledReason and DisabledAt are set for links a moderator disabled.
+	DisabledReason string     `json:"disabled_reason,omitempty"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+}
+
+// Sort orders of ListOptions.
+const (
+	SortCreatedAt = "created_at"
+	SortClicks    = "clicks"
+)
+
+// ListOptions selects a page of ListURLs. The zero value lists the newest
+// links first with the server's default page size.
+type ListOptions struct {
+	// Workspace lists the links of the workspace instead of the caller's own.
+	Workspace string
+	Limit     int
+	Cursor    string
+	Sort      string
+	Ascending bool
+	// Search keeps links whose original URL contains it, case-insensitively.
+	Search string
+	// Deleted and Expired keep only links in the given state when set.
+	Deleted *bool
+	Expired *bool
+}
+
+func (o ListOptions) query() url.Values {
+	q := url.Values{}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	if o.Ascending {
+		q.Set("order", "asc")
+	}
+	if o.Search != "" {
+		q.Set("q", o.Search)
+	}
+	if o.Deleted != nil {
+		q.Set("deleted", strconv.FormatBool(*o.Deleted))
+	}
+	if o.Expired != nil {
+		q.Set("expired", strconv.FormatBool(*o.Expired))
+	}
+
+	return q
+}
+
+// Roles of workspace members: owners manage members, owners and editors
+// change links, viewers list them.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Workspace shares links between its members. Role is the caller's.
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Member struct {
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// URLPage is one page of ListURLs; Next is the cursor of the following page
+// and empty on the last one.
+type URLPage struct {
+	URLs []URL
+	Next string
+}
+
+// AdminURL is a link of any user as admins see it.
+type AdminURL struct {
+	URL
+	UserID string `json:"user_id,omitempty"`
+}
+
+// SearchOptions selects a page of SearchLinks; empty fields match any link.
+type SearchOptions struct {
+	// Search keeps links whose original URL contains it, case-insensitively.
+	Search string
+	// Domain keeps links to the domain and its subdomains.
+	Domain   string
+	Owner    string
+	Disabled *bool
+	Limit    int
+	Cursor   string
+}
+
+func (o SearchOptions) query() url.Values {
+	q := url.Values{}
+	if o.Search != "" {
+		q.Set("q", o.Search)
+	}
+	if o.Domain != "" {
+		q.Set("domain", o.Domain)
+	}
+	if o.Owner != "" {
+		q.Set("owner", o.Owner)
+	}
+	if o.Disabled != nil {
+		q.Set("disabled", strconv.FormatBool(*o.Disabled))
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+
+	return q
+}
+
+// AdminURLPage is one page of SearchLinks.
+type AdminURLPage struct {
+	URLs []AdminURL
+	Next string
+}
+
+// AuditEntry records an action of ActorID on Target, a short URL. Before and
+// After hold the fields of the link the action changed.
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	Action    string          `json:"action"`
+	ActorID   string          `json:"actor_id"`
+	Target    string          `json:"target"`
+	Reason    string          `json:"reason,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditOptions selects a page of Audit; empty fields match any entry.
+type AuditOptions struct {
+	ActorID string
+	Action  string
+	// Target is a short link id.
+	Target string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Cursor string
+}
+
+func (o AuditOptions) query() url.Values {
+	q := url.Values{}
+	if o.ActorID != "" {
+		q.Set("actor", o.ActorID)
+	}
+	if o.Action != "" {
+		q.Set("action", o.Action)
+	}
+	if o.Target != "" {
+		q.Set("target", o.Target)
+	}
+	if !o.Since.IsZero() {
+		q.Set("since", o.Since.Format(time.RFC3339))
+	}
+	if !o.Until.IsZero() {
+		q.Set("until", o.Until.Format(time.RFC3339))
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+
+	return q
+}
+
+// AuditPage is one page of Audit.
+type AuditPage struct {
+	Entries []AuditEntry
+	Next    string
+}
+
+// BatchItem is one link of a batch request; the response carries ShortURL
+// for the same CorrelationID.
+type BatchItem struct {
+	CorrelationID string `json:"correlation_id"`
+	OriginalURL   string `json:"original_url,omitempty"`
+	ShortURL      string `json:"short_url,omitempty"`
+}
+
+// DeletionJob tracks an asynchronous deletion accepted by DeleteURLs.
+type DeletionJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Deleted    int        `json:"deleted"`
+	Skipped    int        `json:"skipped"`
+	Failed     int        `json:"failed"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job will not change anymore.
+func (j DeletionJob) Finished() bool {
+	return j.FinishedAt != nil
+}
+
+// Webhook is a subscription to link events. Secret is only returned on
+// creation and is used to verify the X-Shortener-Signature header.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Account is a registered user. Its ID is the user id links are owned by.
+type Account struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKey authenticates backend jobs through WithAPIKey. Key is only returned
+// on creation.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	ReadOnly  bool      `json:"read_only"`
+	CreatedAt time.Time `json:"created_at"`
+	Key       string    `json:"key,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID            string          `json:"id"`
+	WebhookID     string          `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// ClickEvent is a redirect through one of the caller's links.
+type ClickEvent struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	Timestamp   time.Time `json:"timestamp"`
+}
@@ -0,0 +1,5 @@
+// Package shortenerv1 contains the generated gRPC contract of the shortener
+// service. The source of truth is api/shortener/v1/shortener.proto.
+package shortenerv1
+
+//go:generate protoc -I ../../../api --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative shortener/v1/shortener.proto